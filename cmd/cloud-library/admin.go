@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/password"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+func runCreateAdmin(args []string) {
+	flags := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	username := flags.String("username", "", "username of the administrator")
+	email := flags.String("email", "", "email address of the administrator")
+	tenant := flags.String("tenant", "", "slug of the tenant the administrator belongs to, the default tenant if empty")
+	superAdmin := flags.Bool("superadmin", false, "create a super administrator allowed to manage tenants")
+	flags.Parse(args)
+
+	secret := os.Getenv("APP_ADMIN_PASSWORD")
+	if *username == "" || secret == "" {
+		fmt.Fprintln(os.Stderr, "usage: cloud-library create-admin -username <name> [-email <address>] [-tenant <slug>] [-superadmin], password is read from APP_ADMIN_PASSWORD")
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+
+	passwordConfig := password.NewConfig()
+	passwords, err := password.NewPolicy(passwordConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = passwords.Validate(*username, secret); err != nil {
+		log.Fatal(err)
+	}
+	hasher, err := password.NewHasher(passwordConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := storage.NewConfig()
+	db := storage.NewPostgres(cfg.ConnectionString())
+	defer db.CloseConnection()
+
+	db.TestConnection()
+
+	if *superAdmin && *tenant != "" {
+		log.Fatal("super administrators belong to the default tenant")
+	}
+	tenantID := tenantIDFromSlug(db.NewTenantsStorage(), *tenant)
+
+	users := db.NewUsersStorage()
+	if _, err := users.GetUserByUsername(tenantID, *username); err == nil {
+		log.Fatalf("user %s already exists", *username)
+	}
+
+	hashedPassword, err := hasher.Hash(secret)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	dto := dbmodel.UserDTO{
+		Id:       uuid.NewString(),
+		Username: *username,
+		Password: hashedPassword,
+		Role:     dbmodel.UserRoleAdministrator,
+		Email:    *email,
+		Status:   dbmodel.UserStatusActive,
+		TenantId: tenantID,
+	}
+	if *superAdmin {
+		dto.Role = dbmodel.UserRoleSuperAdmin
+	}
+	id, err := users.CreateUser(dto)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Administrator %s created with id: %s\n", *username, id)
+}
+
+func tenantIDFromSlug(tenants storage.Tenants, slug string) string {
+	if slug == "" || slug == "default" {
+		return dbmodel.DefaultTenantId
+	}
+
+	tenant, err := tenants.GetTenantBySlug(slug)
+	if err != nil {
+		log.Fatalf("unable to find tenant %s: %v", slug, err)
+	}
+	return tenant.Id
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/szwedm/cloud-library/internal/catalog"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	manifestPath := flags.String("manifest", "", "path to the CSV or JSON manifest")
+	format := flags.String("format", "", "manifest format (csv or json), detected from the file extension by default")
+	filesPath := flags.String("files", "", "directory or ZIP archive containing the book files")
+	importID := flags.String("resume", "", "id of a previous import to resume")
+	tenant := flags.String("tenant", "", "slug of the tenant to import into, the default tenant if empty")
+	flags.Parse(args)
+
+	if *manifestPath == "" || *filesPath == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if *format == "" {
+		var err error
+		if *format, err = catalog.ManifestFormatFromFilename(*manifestPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	manifest, err := os.Open(*manifestPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rows, err := catalog.ParseManifest(manifest, *format)
+	manifest.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	files, closeFiles, err := openFiles(*filesPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer closeFiles()
+
+	cfg := storage.NewConfig()
+	db := storage.NewPostgres(cfg.ConnectionString())
+	defer db.CloseConnection()
+
+	db.TestConnection()
+
+	tenantID := tenantIDFromSlug(db.NewTenantsStorage(), *tenant)
+
+	books := db.NewBooksStorage()
+	importer := catalog.NewImporter(books,
+		catalog.NewCatalog(db.NewAuthorsStorage(), db.NewSubjectsStorage(), db.NewTagsStorage()),
+		db.NewImportsStorage())
+
+	report, err := importer.Import(tenantID, *importID, rows, files)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal(err)
+	}
+
+	if report.Failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d rows failed, fix them and rerun with -resume %s\n", report.Failed, report.ImportId)
+		closeFiles()
+		db.CloseConnection()
+		os.Exit(1)
+	}
+}
+
+func openFiles(path string) (fs.FS, func() error, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if info.IsDir() {
+		return os.DirFS(path), func() error { return nil }, nil
+	}
+
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open zip archive: %w", err)
+	}
+	return archive, archive.Close, nil
+}
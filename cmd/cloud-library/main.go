@@ -2,12 +2,26 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/szwedm/cloud-library/internal/server"
 	"github.com/szwedm/cloud-library/internal/storage"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImport(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "create-admin" {
+		runCreateAdmin(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "mock-idp" {
+		runMockIdP(os.Args[2:])
+		return
+	}
+
 	fmt.Println("Let's get started!")
 
 	cfg := storage.NewConfig()
@@ -16,6 +30,10 @@ func main() {
 
 	db.TestConnection()
 
-	srv := server.NewServer(db.NewBooksStorage(), db.NewUsersStorage())
+	srv := server.NewServer(db.NewBooksStorage(), db.NewAuthorsStorage(), db.NewSubjectsStorage(), db.NewTagsStorage(),
+		db.NewImportsStorage(), db.NewUsersStorage(), db.NewSessionsStorage(), db.NewSigningKeysStorage(), db.NewIdentitiesStorage(),
+		db.NewTwoFactorStorage(), db.NewLoginAttemptsStorage(), db.NewPasswordResetsStorage(),
+		db.NewEmailVerificationsStorage(), db.NewCollectionsStorage(), db.NewACLStorage(), db.NewGroupsStorage(),
+		db.NewAPIKeysStorage(), db.NewTenantsStorage(), db.NewAuditStorage(), db.NewBookRevisionsStorage())
 	srv.Run()
 }
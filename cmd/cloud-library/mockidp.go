@@ -0,0 +1,42 @@
+//go:build mockidp
+// +build mockidp
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/szwedm/cloud-library/internal/oidc"
+)
+
+func runMockIdP(args []string) {
+	flags := flag.NewFlagSet("mock-idp", flag.ExitOnError)
+	addr := flags.String("addr", ":9090", "address to listen on")
+	issuer := flags.String("issuer", "http://localhost:9090", "issuer URL advertised in discovery and tokens")
+	subject := flags.String("sub", "mock-user", "subject of the signed-in user, overridden by the login_hint parameter")
+	email := flags.String("email", "mock-user@example.com", "email claim of the signed-in user")
+	groups := flags.String("groups", "", "comma-separated groups claim of the signed-in user")
+	flags.Parse(args)
+
+	claims := map[string]interface{}{
+		"sub":                *subject,
+		"preferred_username": *subject,
+		"email":              *email,
+	}
+	if *groups != "" {
+		claims["groups"] = strings.Split(*groups, ",")
+	}
+
+	provider, err := oidc.NewMockProvider(strings.TrimSuffix(*issuer, "/"), claims)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Fprintf(os.Stdout, "Mock identity provider listening on %s with issuer %s\n", *addr, *issuer)
+	log.Fatal(http.ListenAndServe(*addr, provider))
+}
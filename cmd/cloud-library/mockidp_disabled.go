@@ -0,0 +1,10 @@
+//go:build !mockidp
+// +build !mockidp
+
+package main
+
+import "log"
+
+func runMockIdP(args []string) {
+	log.Fatal("the mock identity provider is not part of this build, rebuild with -tags mockidp")
+}
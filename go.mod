@@ -8,6 +8,14 @@ require github.com/gorilla/mux v1.8.0
 
 require github.com/google/uuid v1.3.0
 
-require golang.org/x/crypto v0.0.0-20211215153901-e495a2d5b3d3
+require golang.org/x/crypto v0.0.0-20220622213112-05595931fe9d
 
 require github.com/dgrijalva/jwt-go/v4 v4.0.0-preview1
+
+require github.com/go-ldap/ldap/v3 v3.4.4
+
+require (
+	github.com/Azure/go-ntlmssp v0.0.0-20220621081337-cb9428e4ac1e // indirect
+	github.com/go-asn1-ber/asn1-ber v1.5.4 // indirect
+	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
+)
@@ -0,0 +1,198 @@
+package catalog
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/model"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+const MaxBookFileSize int64 = 10 << 20
+
+type Catalog struct {
+	authors  storage.Authors
+	subjects storage.Subjects
+	tags     storage.Tags
+}
+
+func NewCatalog(a storage.Authors, s storage.Subjects, t storage.Tags) *Catalog {
+	return &Catalog{
+		authors:  a,
+		subjects: s,
+		tags:     t,
+	}
+}
+
+func (c *Catalog) BookWithRelations(dto dbmodel.BookDTO) (model.Book, error) {
+	book := model.BookFromDTO(dto)
+
+	authors, err := c.authors.GetAuthorsByBookID(dto.Id)
+	if err != nil {
+		return model.Book{}, err
+	}
+	for _, author := range authors {
+		book.Authors = append(book.Authors, model.AuthorFromDTO(author))
+	}
+
+	subjects, err := c.subjects.GetSubjectsByBookID(dto.Id)
+	if err != nil {
+		return model.Book{}, err
+	}
+	for _, subject := range subjects {
+		book.Subjects = append(book.Subjects, model.SubjectFromDTO(subject))
+	}
+
+	tags, err := c.tags.GetTagsByBookID(dto.Id)
+	if err != nil {
+		return model.Book{}, err
+	}
+	for _, tag := range tags {
+		book.Tags = append(book.Tags, model.TagFromDTO(tag))
+	}
+
+	return book, nil
+}
+
+func (c *Catalog) SetBookRelations(book model.Book) error {
+	if book.Authors != nil {
+		ids := make([]string, 0)
+		for _, author := range book.Authors {
+			if author.Id != "" {
+				dto, err := c.authors.GetAuthorByID(author.Id)
+				if err == nil && dto.TenantId != book.TenantId {
+					err = sql.ErrNoRows
+				}
+				if err != nil {
+					return fmt.Errorf("author with id: %s not found, %w", author.Id, err)
+				}
+				ids = append(ids, author.Id)
+				continue
+			}
+			name := NormalizeName(author.Name)
+			if name == "" {
+				continue
+			}
+			dto, err := c.authors.GetAuthorByName(book.TenantId, name)
+			if err != nil {
+				if _, ok := err.(*storage.AuthorNotFoundErr); !ok {
+					return err
+				}
+				dto = dbmodel.AuthorDTO{Id: uuid.NewString(), Name: name, TenantId: book.TenantId}
+				if _, err = c.authors.CreateAuthor(dto); err != nil {
+					return err
+				}
+			}
+			ids = append(ids, dto.Id)
+		}
+		if err := c.authors.SetBookAuthors(book.Id, ids); err != nil {
+			return err
+		}
+	}
+
+	if book.Subjects != nil {
+		ids := make([]string, 0)
+		for _, subject := range book.Subjects {
+			if subject.Id != "" {
+				dto, err := c.subjects.GetSubjectByID(subject.Id)
+				if err == nil && dto.TenantId != book.TenantId {
+					err = sql.ErrNoRows
+				}
+				if err != nil {
+					return fmt.Errorf("subject with id: %s not found, %w", subject.Id, err)
+				}
+				ids = append(ids, subject.Id)
+				continue
+			}
+			name := NormalizeName(subject.Name)
+			if name == "" {
+				continue
+			}
+			dto, err := c.subjects.GetSubjectByName(book.TenantId, name)
+			if err != nil {
+				if _, ok := err.(*storage.SubjectNotFoundErr); !ok {
+					return err
+				}
+				dto = dbmodel.SubjectDTO{Id: uuid.NewString(), Name: name, TenantId: book.TenantId}
+				if _, err = c.subjects.CreateSubject(dto); err != nil {
+					return err
+				}
+			}
+			ids = append(ids, dto.Id)
+		}
+		if err := c.subjects.SetBookSubjects(book.Id, ids); err != nil {
+			return err
+		}
+	}
+
+	if book.Tags != nil {
+		ids := make([]string, 0)
+		for _, tag := range book.Tags {
+			if tag.Id != "" {
+				dto, err := c.tags.GetTagByID(tag.Id)
+				if err == nil && dto.TenantId != book.TenantId {
+					err = sql.ErrNoRows
+				}
+				if err != nil {
+					return fmt.Errorf("tag with id: %s not found, %w", tag.Id, err)
+				}
+				ids = append(ids, tag.Id)
+				continue
+			}
+			name := NormalizeName(tag.Name)
+			if name == "" {
+				continue
+			}
+			dto, err := c.tags.GetTagByName(book.TenantId, name)
+			if err != nil {
+				if _, ok := err.(*storage.TagNotFoundErr); !ok {
+					return err
+				}
+				dto = dbmodel.TagDTO{Id: uuid.NewString(), Name: name, TenantId: book.TenantId}
+				if _, err = c.tags.CreateTag(dto); err != nil {
+					return err
+				}
+			}
+			ids = append(ids, dto.Id)
+		}
+		if err := c.tags.SetBookTags(book.Id, ids); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func NormalizeBookDetails(book *model.Book) error {
+	if book.Isbn10 != "" {
+		book.Isbn10 = model.NormalizeISBN(book.Isbn10)
+		if err := model.ValidateISBN10(book.Isbn10); err != nil {
+			return fmt.Errorf("isbn10 %s: %w", book.Isbn10, err)
+		}
+	}
+	if book.Isbn13 != "" {
+		book.Isbn13 = model.NormalizeISBN(book.Isbn13)
+		if err := model.ValidateISBN13(book.Isbn13); err != nil {
+			return fmt.Errorf("isbn13 %s: %w", book.Isbn13, err)
+		}
+	}
+	if book.Isbn10 != "" && book.Isbn13 == "" {
+		book.Isbn13 = model.ISBN13FromISBN10(book.Isbn10)
+	}
+	if book.PublicationYear < 0 {
+		return errors.New("publication year must not be negative")
+	}
+	if book.SeriesIndex < 0 {
+		return errors.New("series index must not be negative")
+	}
+	book.Language = strings.ToLower(strings.TrimSpace(book.Language))
+	return nil
+}
+
+func NormalizeName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
@@ -0,0 +1,191 @@
+package catalog
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/szwedm/cloud-library/internal/model"
+)
+
+const FormatDublinCore string = "dc"
+
+type dcCollection struct {
+	XMLName xml.Name   `xml:"records"`
+	Records []dcRecord `xml:"oai_dc:dc"`
+}
+
+type dcRecord struct {
+	XmlnsOAIDC   string   `xml:"xmlns:oai_dc,attr"`
+	XmlnsDC      string   `xml:"xmlns:dc,attr"`
+	Titles       []string `xml:"dc:title"`
+	Creators     []string `xml:"dc:creator"`
+	Subjects     []string `xml:"dc:subject"`
+	Descriptions []string `xml:"dc:description"`
+	Publishers   []string `xml:"dc:publisher"`
+	Dates        []string `xml:"dc:date"`
+	Types        []string `xml:"dc:type"`
+	Formats      []string `xml:"dc:format"`
+	Identifiers  []string `xml:"dc:identifier"`
+	Languages    []string `xml:"dc:language"`
+	Relations    []string `xml:"dc:relation"`
+}
+
+type dcRecordInput struct {
+	Titles       []string `xml:"title"`
+	Creators     []string `xml:"creator"`
+	Subjects     []string `xml:"subject"`
+	Descriptions []string `xml:"description"`
+	Publishers   []string `xml:"publisher"`
+	Dates        []string `xml:"date"`
+	Identifiers  []string `xml:"identifier"`
+	Languages    []string `xml:"language"`
+	Relations    []string `xml:"relation"`
+}
+
+func MarshalDublinCore(books []model.Book) ([]byte, error) {
+	collection := dcCollection{Records: make([]dcRecord, 0)}
+	for _, book := range books {
+		record := dcRecord{
+			XmlnsOAIDC:  "http://www.openarchives.org/OAI/2.0/oai_dc/",
+			XmlnsDC:     "http://purl.org/dc/elements/1.1/",
+			Titles:      []string{book.Title},
+			Types:       []string{"Text"},
+			Formats:     []string{"application/pdf"},
+			Identifiers: []string{"urn:uuid:" + book.Id},
+		}
+		for _, author := range book.Authors {
+			record.Creators = append(record.Creators, author.Name)
+		}
+		for _, subject := range book.Subjects {
+			record.Subjects = append(record.Subjects, subject.Name)
+		}
+		for _, tag := range book.Tags {
+			record.Subjects = append(record.Subjects, tag.Name)
+		}
+		if book.Description != "" {
+			record.Descriptions = append(record.Descriptions, book.Description)
+		}
+		if book.Publisher != "" {
+			record.Publishers = append(record.Publishers, book.Publisher)
+		}
+		if book.PublicationYear > 0 {
+			record.Dates = append(record.Dates, strconv.Itoa(book.PublicationYear))
+		}
+		if book.Isbn13 != "" {
+			record.Identifiers = append(record.Identifiers, "urn:isbn:"+book.Isbn13)
+		}
+		if book.Isbn10 != "" {
+			record.Identifiers = append(record.Identifiers, "urn:isbn:"+book.Isbn10)
+		}
+		if book.Language != "" {
+			record.Languages = append(record.Languages, book.Language)
+		}
+		if book.Series != "" {
+			series := book.Series
+			if book.SeriesIndex > 0 {
+				series += "; " + strconv.Itoa(book.SeriesIndex)
+			}
+			record.Relations = append(record.Relations, series)
+		}
+		collection.Records = append(collection.Records, record)
+	}
+
+	body, err := xml.MarshalIndent(collection, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+func UnmarshalDublinCore(r io.Reader) ([]model.Book, error) {
+	books := make([]model.Book, 0)
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode dublin core record: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "dc" {
+			continue
+		}
+
+		var record dcRecordInput
+		if err := decoder.DecodeElement(&record, &start); err != nil {
+			return nil, fmt.Errorf("unable to decode dublin core record: %w", err)
+		}
+		books = append(books, bookFromDublinCore(record))
+	}
+	return books, nil
+}
+
+func bookFromDublinCore(record dcRecordInput) model.Book {
+	book := model.Book{
+		Authors:  make([]model.Author, 0),
+		Subjects: make([]model.Subject, 0),
+		Tags:     make([]model.Tag, 0),
+	}
+
+	if len(record.Titles) > 0 {
+		book.Title = strings.TrimSpace(record.Titles[0])
+	}
+	for _, creator := range record.Creators {
+		if creator = strings.TrimSpace(creator); creator != "" {
+			book.Authors = append(book.Authors, model.Author{Name: creator})
+		}
+	}
+	for _, subject := range record.Subjects {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			book.Subjects = append(book.Subjects, model.Subject{Name: subject})
+		}
+	}
+	if len(record.Descriptions) > 0 {
+		book.Description = strings.TrimSpace(record.Descriptions[0])
+	}
+	if len(record.Publishers) > 0 {
+		book.Publisher = strings.TrimSpace(record.Publishers[0])
+	}
+	for _, date := range record.Dates {
+		date = strings.TrimSpace(date)
+		if len(date) >= 4 {
+			if year, err := strconv.Atoi(date[:4]); err == nil {
+				book.PublicationYear = year
+				break
+			}
+		}
+	}
+	for _, identifier := range record.Identifiers {
+		identifier = strings.TrimSpace(identifier)
+		lower := strings.ToLower(identifier)
+		if !strings.HasPrefix(lower, "urn:isbn:") && !strings.HasPrefix(lower, "isbn") {
+			continue
+		}
+		isbn := model.NormalizeISBN(identifier[strings.LastIndex(identifier, ":")+1:])
+		if len(isbn) == 13 {
+			book.Isbn13 = isbn
+		} else if len(isbn) == 10 {
+			book.Isbn10 = isbn
+		}
+	}
+	if len(record.Languages) > 0 {
+		book.Language = strings.TrimSpace(record.Languages[0])
+	}
+	if len(record.Relations) > 0 {
+		parts := strings.SplitN(record.Relations[0], ";", 2)
+		book.Series = strings.TrimSpace(parts[0])
+		if len(parts) == 2 {
+			if index, err := strconv.Atoi(strings.TrimSpace(parts[1])); err == nil {
+				book.SeriesIndex = index
+			}
+		}
+	}
+
+	return book
+}
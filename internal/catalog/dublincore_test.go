@@ -0,0 +1,40 @@
+package catalog
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/szwedm/cloud-library/internal/model"
+)
+
+func TestDublinCoreRoundTrip(t *testing.T) {
+	want := testBook()
+	body, err := MarshalDublinCore(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if books, err := UnmarshalDublinCore(bytes.NewReader(body)); err != nil || len(books) != 0 {
+		t.Fatalf("empty export decoded to %v, %v", books, err)
+	}
+
+	body, err = MarshalDublinCore([]model.Book{want})
+	if err != nil {
+		t.Fatal(err)
+	}
+	books, err := UnmarshalDublinCore(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 1 {
+		t.Fatalf("decoded %d records, want 1", len(books))
+	}
+
+	// Dublin Core has no element for editions, tags are exported as subjects
+	want.Edition = ""
+	want.Subjects = append(want.Subjects, model.Subject{Name: "classic"})
+	want.Tags = []model.Tag{}
+	if got := books[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,24 @@
+package catalog
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+func BookFilePath(tenantID, bookID string) string {
+	dir := os.Getenv("APP_BOOKS_STORAGE_PATH")
+	if tenantID != "" && tenantID != dbmodel.DefaultTenantId {
+		dir = filepath.Join(dir, tenantID)
+	}
+	return filepath.Clean(dir + string(os.PathSeparator) + bookID + ".pdf")
+}
+
+func CreateBookFile(tenantID, bookID string) (*os.File, error) {
+	path := BookFilePath(tenantID, bookID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
@@ -0,0 +1,428 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/model"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+const (
+	ManifestFormatCSV  string = "csv"
+	ManifestFormatJSON string = "json"
+)
+
+type ManifestRow struct {
+	Title           string   `json:"title"`
+	Authors         []string `json:"authors"`
+	Subjects        []string `json:"subjects"`
+	Tags            []string `json:"tags"`
+	Isbn10          string   `json:"isbn10"`
+	Isbn13          string   `json:"isbn13"`
+	Publisher       string   `json:"publisher"`
+	PublicationYear int      `json:"publicationYear"`
+	Edition         string   `json:"edition"`
+	Language        string   `json:"language"`
+	Series          string   `json:"series"`
+	SeriesIndex     int      `json:"seriesIndex"`
+	Description     string   `json:"description"`
+	File            string   `json:"file"`
+
+	err error
+}
+
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type ImportReport struct {
+	ImportId string           `json:"importId"`
+	Status   string           `json:"status"`
+	Total    int              `json:"total"`
+	Imported int              `json:"imported"`
+	Skipped  int              `json:"skipped"`
+	Failed   int              `json:"failed"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+type Importer struct {
+	books   storage.Books
+	catalog *Catalog
+	imports storage.Imports
+}
+
+func NewImporter(b storage.Books, c *Catalog, i storage.Imports) *Importer {
+	return &Importer{
+		books:   b,
+		catalog: c,
+		imports: i,
+	}
+}
+
+func ManifestFormatFromFilename(filename string) (string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return ManifestFormatCSV, nil
+	case ".json":
+		return ManifestFormatJSON, nil
+	default:
+		return "", fmt.Errorf("unsupported manifest file: %s", filename)
+	}
+}
+
+func ParseManifest(r io.Reader, format string) ([]ManifestRow, error) {
+	switch format {
+	case ManifestFormatJSON:
+		rows := make([]ManifestRow, 0)
+		if err := json.NewDecoder(r).Decode(&rows); err != nil {
+			return nil, fmt.Errorf("unable to decode json manifest: %w", err)
+		}
+		return rows, nil
+	case ManifestFormatCSV:
+		return parseCSVManifest(r)
+	default:
+		return nil, fmt.Errorf("unsupported manifest format: %s", format)
+	}
+}
+
+func parseCSVManifest(r io.Reader) ([]ManifestRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read csv manifest header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("csv manifest must have a title column")
+	}
+	if _, ok := columns["file"]; !ok {
+		return nil, errors.New("csv manifest must have a file column")
+	}
+
+	rows := make([]ManifestRow, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); ok {
+				rows = append(rows, ManifestRow{err: err})
+				continue
+			}
+			return nil, err
+		}
+
+		value := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		list := func(name string) []string {
+			values := make([]string, 0)
+			for _, v := range strings.Split(value(name), ";") {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+			return values
+		}
+
+		row := ManifestRow{
+			Title:       value("title"),
+			Authors:     list("authors"),
+			Subjects:    list("subjects"),
+			Tags:        list("tags"),
+			Isbn10:      value("isbn10"),
+			Isbn13:      value("isbn13"),
+			Publisher:   value("publisher"),
+			Edition:     value("edition"),
+			Language:    value("language"),
+			Series:      value("series"),
+			Description: value("description"),
+			File:        value("file"),
+		}
+		if year := value("publicationYear"); year != "" {
+			if row.PublicationYear, err = strconv.Atoi(year); err != nil {
+				row.err = fmt.Errorf("invalid publication year: %s", year)
+			}
+		}
+		if index := value("seriesIndex"); index != "" {
+			if row.SeriesIndex, err = strconv.Atoi(index); err != nil {
+				row.err = fmt.Errorf("invalid series index: %s", index)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func (i *Importer) Import(tenantID, importID string, rows []ManifestRow, files fs.FS) (ImportReport, error) {
+	done := make(map[int]bool)
+
+	var job dbmodel.ImportDTO
+	if importID == "" {
+		job = dbmodel.ImportDTO{
+			Id:       uuid.NewString(),
+			Status:   dbmodel.ImportStatusRunning,
+			Total:    len(rows),
+			TenantId: tenantID,
+		}
+		if _, err := i.imports.CreateImport(job); err != nil {
+			return ImportReport{}, err
+		}
+	} else {
+		var err error
+		job, err = i.imports.GetImportByID(importID)
+		if err != nil {
+			return ImportReport{}, err
+		}
+		if job.TenantId != tenantID {
+			return ImportReport{}, fmt.Errorf("import %s belongs to another tenant", importID)
+		}
+
+		previous, err := i.imports.GetImportRows(importID)
+		if err != nil {
+			return ImportReport{}, err
+		}
+		for _, row := range previous {
+			if row.Status == dbmodel.ImportRowStatusImported {
+				done[row.Row] = true
+			}
+		}
+
+		job.Status = dbmodel.ImportStatusRunning
+		job.Total = len(rows)
+		if err = i.imports.UpdateImport(job); err != nil {
+			return ImportReport{}, err
+		}
+	}
+
+	report := ImportReport{
+		ImportId: job.Id,
+		Total:    len(rows),
+		Errors:   make([]ImportRowError, 0),
+	}
+
+	for n, row := range rows {
+		number := n + 1
+		if done[number] {
+			report.Skipped++
+			continue
+		}
+
+		result := dbmodel.ImportRowDTO{
+			ImportId: job.Id,
+			Row:      number,
+			Status:   dbmodel.ImportRowStatusImported,
+		}
+
+		bookID, err := i.importRow(tenantID, row, files)
+		if err != nil {
+			result.Status = dbmodel.ImportRowStatusFailed
+			result.Error = err.Error()
+			report.Failed++
+			report.Errors = append(report.Errors, ImportRowError{Row: number, Error: err.Error()})
+		} else {
+			result.BookId = bookID
+			report.Imported++
+		}
+
+		if err := i.imports.SaveImportRow(result); err != nil {
+			return ImportReport{}, err
+		}
+	}
+
+	job.Imported = report.Imported + report.Skipped
+	job.Failed = report.Failed
+	job.Status = dbmodel.ImportStatusCompleted
+	if report.Failed > 0 {
+		job.Status = dbmodel.ImportStatusIncomplete
+	}
+	if err := i.imports.UpdateImport(job); err != nil {
+		return ImportReport{}, err
+	}
+
+	report.Status = job.Status
+	return report, nil
+}
+
+func (i *Importer) importRow(tenantID string, row ManifestRow, files fs.FS) (string, error) {
+	if row.err != nil {
+		return "", row.err
+	}
+
+	book := model.Book{
+		Id:              uuid.NewString(),
+		Title:           NormalizeName(row.Title),
+		Isbn10:          row.Isbn10,
+		Isbn13:          row.Isbn13,
+		Publisher:       row.Publisher,
+		PublicationYear: row.PublicationYear,
+		Edition:         row.Edition,
+		Language:        row.Language,
+		Series:          row.Series,
+		SeriesIndex:     row.SeriesIndex,
+		Description:     row.Description,
+		Authors:         make([]model.Author, 0),
+		Subjects:        make([]model.Subject, 0),
+		Tags:            make([]model.Tag, 0),
+		TenantId:        tenantID,
+	}
+	for _, name := range row.Authors {
+		book.Authors = append(book.Authors, model.Author{Name: name})
+	}
+	for _, name := range row.Subjects {
+		book.Subjects = append(book.Subjects, model.Subject{Name: name})
+	}
+	for _, name := range row.Tags {
+		book.Tags = append(book.Tags, model.Tag{Name: name})
+	}
+
+	if err := i.validate(&book); err != nil {
+		return "", err
+	}
+
+	size, err := i.storeFile(tenantID, book.Id, row.File, files)
+	if err != nil {
+		return "", err
+	}
+	book.FileSize = size
+
+	if _, err := i.books.CreateBook(model.DTOFromBook(book)); err != nil {
+		i.removeFile(tenantID, book.Id)
+		return "", err
+	}
+
+	if err := i.catalog.SetBookRelations(book); err != nil {
+		i.books.DeleteBookByID(book.Id)
+		i.removeFile(tenantID, book.Id)
+		return "", err
+	}
+
+	return book.Id, nil
+}
+
+func (i *Importer) ImportRecords(tenantID string, records []model.Book) ImportReport {
+	report := ImportReport{
+		Total:  len(records),
+		Errors: make([]ImportRowError, 0),
+	}
+
+	for n, book := range records {
+		book.Id = uuid.NewString()
+		book.Title = NormalizeName(book.Title)
+		book.TenantId = tenantID
+
+		err := i.validate(&book)
+		if err == nil {
+			if _, err = i.books.CreateBook(model.DTOFromBook(book)); err == nil {
+				if err = i.catalog.SetBookRelations(book); err != nil {
+					i.books.DeleteBookByID(book.Id)
+				}
+			}
+		}
+
+		if err != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, ImportRowError{Row: n + 1, Error: err.Error()})
+			continue
+		}
+		report.Imported++
+	}
+
+	report.Status = dbmodel.ImportStatusCompleted
+	if report.Failed > 0 {
+		report.Status = dbmodel.ImportStatusIncomplete
+	}
+	return report
+}
+
+func (i *Importer) validate(book *model.Book) error {
+	if book.Title == "" {
+		return errors.New("title is required")
+	}
+	if err := NormalizeBookDetails(book); err != nil {
+		return err
+	}
+	if book.Isbn13 != "" {
+		existing, err := i.books.GetBooks(dbmodel.BookFilter{TenantId: book.TenantId, Isbn: book.Isbn13})
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			return fmt.Errorf("book with isbn %s already exists with id: %s", book.Isbn13, existing[0].Id)
+		}
+	}
+	return nil
+}
+
+func (i *Importer) storeFile(tenantID, id, name string, files fs.FS) (int64, error) {
+	name = path.Clean(strings.TrimPrefix(filepath.ToSlash(name), "/"))
+	if name == "" || name == "." || !fs.ValidPath(name) {
+		return 0, fmt.Errorf("invalid file path: %s", name)
+	}
+
+	file, err := files.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() > MaxBookFileSize {
+		return 0, fmt.Errorf("file %s exceeds maximum size of %d bytes", name, MaxBookFileSize)
+	}
+
+	buff := make([]byte, 512)
+	n, err := io.ReadFull(file, buff)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	if fileType := http.DetectContentType(buff[:n]); fileType != "application/pdf" {
+		return 0, fmt.Errorf("file %s is not a pdf", name)
+	}
+
+	dst, err := CreateBookFile(tenantID, id)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	if _, err = dst.Write(buff[:n]); err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(dst, file)
+	if err != nil {
+		return 0, err
+	}
+	return int64(n) + written, nil
+}
+
+func (i *Importer) removeFile(tenantID, id string) {
+	os.Remove(BookFilePath(tenantID, id))
+}
@@ -0,0 +1,89 @@
+package catalog
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestManifestFormatFromFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+		wantErr  bool
+	}{
+		{filename: "books.csv", want: ManifestFormatCSV},
+		{filename: "BOOKS.JSON", want: ManifestFormatJSON},
+		{filename: "books.xml", wantErr: true},
+		{filename: "books", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ManifestFormatFromFilename(tt.filename)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ManifestFormatFromFilename(%q): expected error", tt.filename)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ManifestFormatFromFilename(%q) = %q, %v, want %q", tt.filename, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseCSVManifest(t *testing.T) {
+	manifest := strings.Join([]string{
+		"title,authors,tags,publicationYear,seriesIndex,file",
+		"Dune, Frank Herbert , sf; classic ;,1965,1,dune.epub",
+		"Bad year,,,nineteen,,bad.epub",
+		"Short row",
+	}, "\n")
+
+	rows, err := ParseManifest(strings.NewReader(manifest), ManifestFormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("parsed %d rows, want 3", len(rows))
+	}
+
+	want := ManifestRow{
+		Title:           "Dune",
+		Authors:         []string{"Frank Herbert"},
+		Subjects:        []string{},
+		Tags:            []string{"sf", "classic"},
+		PublicationYear: 1965,
+		SeriesIndex:     1,
+		File:            "dune.epub",
+	}
+	if !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("row 1 = %+v, want %+v", rows[0], want)
+	}
+	if rows[1].err == nil {
+		t.Error("row 2: expected an error for the publication year")
+	}
+	if rows[2].Title != "Short row" || rows[2].File != "" {
+		t.Errorf("row 3 = %+v, want a title without a file", rows[2])
+	}
+}
+
+func TestParseManifestErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		format   string
+	}{
+		{name: "missing title column", manifest: "file\nbook.epub", format: ManifestFormatCSV},
+		{name: "missing file column", manifest: "title\nDune", format: ManifestFormatCSV},
+		{name: "empty csv", manifest: "", format: ManifestFormatCSV},
+		{name: "malformed json", manifest: `[{"title": `, format: ManifestFormatJSON},
+		{name: "unknown format", manifest: "", format: "xml"},
+	}
+
+	for _, tt := range tests {
+		if _, err := ParseManifest(strings.NewReader(tt.manifest), tt.format); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
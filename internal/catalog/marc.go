@@ -0,0 +1,245 @@
+package catalog
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/szwedm/cloud-library/internal/model"
+)
+
+const FormatMARC string = "marc"
+
+type marcCollection struct {
+	XMLName xml.Name     `xml:"http://www.loc.gov/MARC21/slim collection"`
+	Records []marcRecord `xml:"record"`
+}
+
+type marcRecord struct {
+	Leader        string             `xml:"leader"`
+	ControlFields []marcControlField `xml:"controlfield"`
+	DataFields    []marcDataField    `xml:"datafield"`
+}
+
+type marcControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcDataField struct {
+	Tag       string         `xml:"tag,attr"`
+	Ind1      string         `xml:"ind1,attr"`
+	Ind2      string         `xml:"ind2,attr"`
+	Subfields []marcSubfield `xml:"subfield"`
+}
+
+type marcSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (f marcDataField) subfield(code string) string {
+	for _, s := range f.Subfields {
+		if s.Code == code {
+			return strings.TrimSpace(s.Value)
+		}
+	}
+	return ""
+}
+
+func newMARCDataField(tag, ind1, ind2 string, subfields ...string) marcDataField {
+	field := marcDataField{Tag: tag, Ind1: ind1, Ind2: ind2}
+	for i := 0; i+1 < len(subfields); i += 2 {
+		if subfields[i+1] != "" {
+			field.Subfields = append(field.Subfields, marcSubfield{Code: subfields[i], Value: subfields[i+1]})
+		}
+	}
+	return field
+}
+
+func MarshalMARC(books []model.Book) ([]byte, error) {
+	collection := marcCollection{Records: make([]marcRecord, 0)}
+	for _, book := range books {
+		record := marcRecord{
+			Leader: "00000nam a2200000 i 4500",
+			ControlFields: []marcControlField{
+				{Tag: "001", Value: book.Id},
+			},
+		}
+
+		year := "    "
+		if book.PublicationYear > 0 {
+			year = fmt.Sprintf("%04d", book.PublicationYear)
+		}
+		language := "   "
+		if len(book.Language) == 3 {
+			language = book.Language
+		}
+		record.ControlFields = append(record.ControlFields,
+			marcControlField{Tag: "008", Value: "      s" + year + "    xx            000 0 " + language + " d"})
+
+		fields := make([]marcDataField, 0)
+		if book.Isbn13 != "" {
+			fields = append(fields, newMARCDataField("020", " ", " ", "a", book.Isbn13))
+		}
+		if book.Isbn10 != "" {
+			fields = append(fields, newMARCDataField("020", " ", " ", "a", book.Isbn10))
+		}
+		if book.Language != "" {
+			fields = append(fields, newMARCDataField("041", " ", " ", "a", book.Language))
+		}
+		for i, author := range book.Authors {
+			tag := "700"
+			if i == 0 {
+				tag = "100"
+			}
+			fields = append(fields, newMARCDataField(tag, "1", " ", "a", author.Name))
+		}
+		titleInd1 := "0"
+		if len(book.Authors) > 0 {
+			titleInd1 = "1"
+		}
+		fields = append(fields, newMARCDataField("245", titleInd1, "0", "a", book.Title))
+		if book.Edition != "" {
+			fields = append(fields, newMARCDataField("250", " ", " ", "a", book.Edition))
+		}
+		if book.Publisher != "" || book.PublicationYear > 0 {
+			var date string
+			if book.PublicationYear > 0 {
+				date = strconv.Itoa(book.PublicationYear)
+			}
+			fields = append(fields, newMARCDataField("264", " ", "1", "b", book.Publisher, "c", date))
+		}
+		if book.Series != "" {
+			var index string
+			if book.SeriesIndex > 0 {
+				index = strconv.Itoa(book.SeriesIndex)
+			}
+			fields = append(fields, newMARCDataField("490", "0", " ", "a", book.Series, "v", index))
+		}
+		if book.Description != "" {
+			fields = append(fields, newMARCDataField("520", " ", " ", "a", book.Description))
+		}
+		for _, subject := range book.Subjects {
+			fields = append(fields, newMARCDataField("650", " ", "4", "a", subject.Name))
+		}
+		for _, tag := range book.Tags {
+			fields = append(fields, newMARCDataField("653", " ", " ", "a", tag.Name))
+		}
+		record.DataFields = fields
+
+		collection.Records = append(collection.Records, record)
+	}
+
+	body, err := xml.MarshalIndent(collection, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+func UnmarshalMARC(r io.Reader) ([]model.Book, error) {
+	books := make([]model.Book, 0)
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode marc record: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		var record marcRecord
+		if err := decoder.DecodeElement(&record, &start); err != nil {
+			return nil, fmt.Errorf("unable to decode marc record: %w", err)
+		}
+		books = append(books, bookFromMARC(record))
+	}
+	return books, nil
+}
+
+func bookFromMARC(record marcRecord) model.Book {
+	book := model.Book{
+		Authors:  make([]model.Author, 0),
+		Subjects: make([]model.Subject, 0),
+		Tags:     make([]model.Tag, 0),
+	}
+
+	for _, field := range record.ControlFields {
+		if field.Tag != "008" || len(field.Value) < 38 {
+			continue
+		}
+		if year, err := strconv.Atoi(field.Value[7:11]); err == nil {
+			book.PublicationYear = year
+		}
+		if language := strings.TrimSpace(field.Value[35:38]); language != "" {
+			book.Language = language
+		}
+	}
+
+	for _, field := range record.DataFields {
+		switch field.Tag {
+		case "020":
+			values := strings.Fields(field.subfield("a"))
+			if len(values) == 0 {
+				continue
+			}
+			isbn := model.NormalizeISBN(values[0])
+			if len(isbn) == 13 {
+				book.Isbn13 = isbn
+			} else if len(isbn) == 10 {
+				book.Isbn10 = isbn
+			}
+		case "041":
+			if language := field.subfield("a"); language != "" {
+				book.Language = language
+			}
+		case "100", "700":
+			if name := strings.TrimRight(field.subfield("a"), ",."); name != "" {
+				book.Authors = append(book.Authors, model.Author{Name: name})
+			}
+		case "245":
+			title := strings.TrimRight(field.subfield("a"), " /:;")
+			if subtitle := strings.TrimRight(field.subfield("b"), " /:;"); subtitle != "" {
+				title += ": " + subtitle
+			}
+			book.Title = title
+		case "250":
+			book.Edition = field.subfield("a")
+		case "260", "264":
+			if publisher := strings.TrimRight(field.subfield("b"), " ,:;"); publisher != "" {
+				book.Publisher = publisher
+			}
+			if year, err := strconv.Atoi(strings.Trim(field.subfield("c"), " .[]c©")); err == nil {
+				book.PublicationYear = year
+			}
+		case "490", "830":
+			if series := strings.TrimRight(field.subfield("a"), " ;"); series != "" {
+				book.Series = series
+			}
+			if index, err := strconv.Atoi(strings.Trim(field.subfield("v"), " .v")); err == nil {
+				book.SeriesIndex = index
+			}
+		case "520":
+			book.Description = field.subfield("a")
+		case "650":
+			if name := strings.TrimRight(field.subfield("a"), "."); name != "" {
+				book.Subjects = append(book.Subjects, model.Subject{Name: name})
+			}
+		case "653":
+			if name := field.subfield("a"); name != "" {
+				book.Tags = append(book.Tags, model.Tag{Name: name})
+			}
+		}
+	}
+
+	return book
+}
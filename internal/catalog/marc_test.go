@@ -0,0 +1,51 @@
+package catalog
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/szwedm/cloud-library/internal/model"
+)
+
+func testBook() model.Book {
+	return model.Book{
+		Title:           "The Left Hand of Darkness",
+		Isbn10:          "0441478123",
+		Isbn13:          "9780441478125",
+		Publisher:       "Ace Books",
+		PublicationYear: 1969,
+		Edition:         "1st",
+		Language:        "eng",
+		Series:          "Hainish Cycle",
+		SeriesIndex:     4,
+		Description:     "A human envoy visits the planet Gethen.",
+		Authors:         []model.Author{{Name: "Ursula K. Le Guin"}},
+		Subjects:        []model.Subject{{Name: "Science fiction"}},
+		Tags:            []model.Tag{{Name: "classic"}},
+	}
+}
+
+func TestMARCRoundTrip(t *testing.T) {
+	body, err := MarshalMARC([]model.Book{testBook()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	books, err := UnmarshalMARC(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 1 {
+		t.Fatalf("decoded %d records, want 1", len(books))
+	}
+	if want := testBook(); !reflect.DeepEqual(books[0], want) {
+		t.Errorf("round trip = %+v, want %+v", books[0], want)
+	}
+}
+
+func TestUnmarshalMARCInvalid(t *testing.T) {
+	if _, err := UnmarshalMARC(bytes.NewReader([]byte(`<collection><record><datafield`))); err == nil {
+		t.Error("expected error for truncated record")
+	}
+}
@@ -0,0 +1,146 @@
+package catalog
+
+import (
+	"encoding/xml"
+	"strconv"
+	"time"
+
+	"github.com/szwedm/cloud-library/internal/model"
+)
+
+const (
+	OPDSNavigationType  string = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	OPDSAcquisitionType string = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	OpenSearchType      string = "application/opensearchdescription+xml"
+)
+
+type OPDSFeed struct {
+	XMLName   xml.Name    `xml:"feed"`
+	Xmlns     string      `xml:"xmlns,attr"`
+	XmlnsDC   string      `xml:"xmlns:dc,attr"`
+	XmlnsOPDS string      `xml:"xmlns:opds,attr"`
+	Id        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Links     []OPDSLink  `xml:"link"`
+	Entries   []OPDSEntry `xml:"entry"`
+}
+
+type OPDSLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type OPDSAuthor struct {
+	Name string `xml:"name"`
+	Uri  string `xml:"uri,omitempty"`
+}
+
+type OPDSCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type OPDSContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type OPDSEntry struct {
+	Id         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Authors    []OPDSAuthor   `xml:"author"`
+	Categories []OPDSCategory `xml:"category"`
+	Language   string         `xml:"dc:language,omitempty"`
+	Publisher  string         `xml:"dc:publisher,omitempty"`
+	Issued     string         `xml:"dc:issued,omitempty"`
+	Identifier []string       `xml:"dc:identifier"`
+	Content    *OPDSContent   `xml:"content"`
+	Links      []OPDSLink     `xml:"link"`
+}
+
+type OpenSearchDescription struct {
+	XMLName     xml.Name      `xml:"OpenSearchDescription"`
+	Xmlns       string        `xml:"xmlns,attr"`
+	ShortName   string        `xml:"ShortName"`
+	Description string        `xml:"Description"`
+	Url         OpenSearchUrl `xml:"Url"`
+}
+
+type OpenSearchUrl struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+func NewOPDSFeed(id, title, self, kind string) OPDSFeed {
+	return OPDSFeed{
+		Xmlns:     "http://www.w3.org/2005/Atom",
+		XmlnsDC:   "http://purl.org/dc/terms/",
+		XmlnsOPDS: "http://opds-spec.org/2010/catalog",
+		Id:        id,
+		Title:     title,
+		Updated:   time.Now().UTC().Format(time.RFC3339),
+		Links: []OPDSLink{
+			{Rel: "self", Href: self, Type: kind},
+			{Rel: "start", Href: "/opds", Type: OPDSNavigationType},
+			{Rel: "search", Href: "/opds/search.xml", Type: OpenSearchType},
+		},
+		Entries: make([]OPDSEntry, 0),
+	}
+}
+
+func NewOPDSNavigationEntry(id, title, href, kind string) OPDSEntry {
+	return OPDSEntry{
+		Id:      id,
+		Title:   title,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Links: []OPDSLink{
+			{Rel: "subsection", Href: href, Type: kind},
+		},
+	}
+}
+
+func NewOPDSBookEntry(book model.Book) OPDSEntry {
+	entry := OPDSEntry{
+		Id:         "urn:uuid:" + book.Id,
+		Title:      book.Title,
+		Updated:    time.Now().UTC().Format(time.RFC3339),
+		Language:   book.Language,
+		Publisher:  book.Publisher,
+		Identifier: make([]string, 0),
+		Links: []OPDSLink{
+			{Rel: "http://opds-spec.org/acquisition", Href: "/books/" + book.Id, Type: "application/pdf"},
+		},
+	}
+	for _, author := range book.Authors {
+		entry.Authors = append(entry.Authors, OPDSAuthor{Name: author.Name, Uri: "/opds/authors/" + author.Id})
+	}
+	for _, subject := range book.Subjects {
+		entry.Categories = append(entry.Categories, OPDSCategory{Term: subject.Id, Label: subject.Name})
+	}
+	if book.PublicationYear > 0 {
+		entry.Issued = strconv.Itoa(book.PublicationYear)
+	}
+	if book.Isbn13 != "" {
+		entry.Identifier = append(entry.Identifier, "urn:isbn:"+book.Isbn13)
+	}
+	if book.Description != "" {
+		entry.Content = &OPDSContent{Type: "text", Value: book.Description}
+	}
+	return entry
+}
+
+func NewOpenSearchDescription() OpenSearchDescription {
+	return OpenSearchDescription{
+		Xmlns:       "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:   "cloud-library",
+		Description: "Search the cloud-library catalog",
+		Url: OpenSearchUrl{
+			Type:     OPDSAcquisitionType,
+			Template: "/opds/books?q={searchTerms}",
+		},
+	}
+}
@@ -1,20 +1,281 @@
 package dbmodel
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type BookDTO struct {
-	Id      string `json:"id"`
-	Title   string `json:"title"`
-	Author  string `json:"author"`
-	Subject string `json:"subject"`
+	Id              string    `json:"id"`
+	Title           string    `json:"title"`
+	Isbn10          string    `json:"isbn10"`
+	Isbn13          string    `json:"isbn13"`
+	Publisher       string    `json:"publisher"`
+	PublicationYear int       `json:"publicationYear"`
+	Edition         string    `json:"edition"`
+	Language        string    `json:"language"`
+	Series          string    `json:"series"`
+	SeriesIndex     int       `json:"seriesIndex"`
+	Description     string    `json:"description"`
+	TenantId        string    `json:"tenantId"`
+	FileSize        int64     `json:"fileSize"`
+	UploadedBy      string    `json:"uploadedBy"`
+	DeletedAt       time.Time `json:"deletedAt"`
+}
+
+type BookFilter struct {
+	TenantId        string
+	Title           string
+	Isbn            string
+	Publisher       string
+	PublicationYear int
+	Edition         string
+	Language        string
+	Series          string
+	SeriesIndex     int
+	Description     string
+}
+
+type StorageUsageDTO struct {
+	UserId string `json:"userId"`
+	Books  int    `json:"books"`
+	Bytes  int64  `json:"bytes"`
+}
+
+type AuthorDTO struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	TenantId string `json:"tenantId"`
+}
+
+type SubjectDTO struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Code     string `json:"code"`
+	ParentId string `json:"parentId"`
+	TenantId string `json:"tenantId"`
+}
+
+type TagDTO struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	TenantId string `json:"tenantId"`
+}
+
+type CollectionDTO struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Restricted  bool   `json:"restricted"`
+	TenantId    string `json:"tenantId"`
+}
+
+const (
+	GrantResourceBook       string = "book"
+	GrantResourceCollection string = "collection"
+	GrantPrincipalUser      string = "user"
+	GrantPrincipalGroup     string = "group"
+)
+
+type GrantDTO struct {
+	Id            string    `json:"id"`
+	ResourceType  string    `json:"resourceType"`
+	ResourceId    string    `json:"resourceId"`
+	PrincipalType string    `json:"principalType"`
+	PrincipalId   string    `json:"principalId"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type GroupDTO struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Role        string `json:"role"`
+	TenantId    string `json:"tenantId"`
 }
 
 const (
 	UserRoleReader        string = "reader"
+	UserRoleLibrarian     string = "librarian"
 	UserRoleAdministrator string = "administrator"
+	UserRoleSuperAdmin    string = "superadmin"
+)
+
+const (
+	UserStatusActive              string = "active"
+	UserStatusPendingVerification string = "pending_verification"
+	UserStatusPendingApproval     string = "pending_approval"
 )
 
 type UserDTO struct {
+	Id           string    `json:"id"`
+	Username     string    `json:"username"`
+	Password     string    `json:"password,omitempty"`
+	Role         string    `json:"role"`
+	TokenVersion int       `json:"tokenVersion"`
+	Email        string    `json:"email"`
+	Status       string    `json:"status"`
+	TenantId     string    `json:"tenantId"`
+	DeletedAt    time.Time `json:"deletedAt"`
+}
+
+const DefaultTenantId = "00000000-0000-0000-0000-000000000000"
+
+const (
+	TenantStatusActive    string = "active"
+	TenantStatusSuspended string = "suspended"
+)
+
+type TenantDTO struct {
+	Id         string    `json:"id"`
+	Slug       string    `json:"slug"`
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	QuotaBytes int64     `json:"quotaBytes"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+const (
+	ImportStatusRunning    string = "running"
+	ImportStatusCompleted  string = "completed"
+	ImportStatusIncomplete string = "incomplete"
+
+	ImportRowStatusImported string = "imported"
+	ImportRowStatusFailed   string = "failed"
+)
+
+type ImportDTO struct {
 	Id       string `json:"id"`
-	Username string `json:"username"`
-	Password string `json:"password,omitempty"`
-	Role     string `json:"role"`
+	Status   string `json:"status"`
+	Total    int    `json:"total"`
+	Imported int    `json:"imported"`
+	Failed   int    `json:"failed"`
+	TenantId string `json:"tenantId"`
+}
+
+type ImportRowDTO struct {
+	ImportId string `json:"importId"`
+	Row      int    `json:"row"`
+	BookId   string `json:"bookId"`
+	Status   string `json:"status"`
+	Error    string `json:"error"`
+}
+
+type SessionDTO struct {
+	Id         string    `json:"id"`
+	UserId     string    `json:"userId"`
+	Device     string    `json:"device"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Revoked    bool      `json:"revoked"`
+}
+
+type RefreshTokenDTO struct {
+	Hash      string    `json:"hash"`
+	SessionId string    `json:"sessionId"`
+	Used      bool      `json:"used"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type APIKeyDTO struct {
+	Id         string    `json:"id"`
+	UserId     string    `json:"userId"`
+	Name       string    `json:"name"`
+	Prefix     string    `json:"prefix"`
+	Hash       string    `json:"-"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Revoked    bool      `json:"revoked"`
+}
+
+type SigningKeyDTO struct {
+	Kid        string    `json:"kid"`
+	Algorithm  string    `json:"algorithm"`
+	PrivateKey string    `json:"-"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+type IdentityDTO struct {
+	Id        string    `json:"id"`
+	UserId    string    `json:"userId"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type LoginStateDTO struct {
+	State     string    `json:"state"`
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"-"`
+	UserId    string    `json:"userId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type TwoFactorDTO struct {
+	UserId    string    `json:"userId"`
+	Secret    string    `json:"-"`
+	Enabled   bool      `json:"enabled"`
+	LastStep  int64     `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type LoginAttemptDTO struct {
+	Key           string    `json:"key"`
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"lastFailureAt"`
+	LockedUntil   time.Time `json:"lockedUntil"`
+}
+
+type PasswordResetDTO struct {
+	Hash      string    `json:"hash"`
+	UserId    string    `json:"userId"`
+	Used      bool      `json:"used"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type EmailVerificationDTO struct {
+	Hash      string    `json:"hash"`
+	UserId    string    `json:"userId"`
+	Email     string    `json:"email"`
+	Used      bool      `json:"used"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type AuditEventDTO struct {
+	Id         string          `json:"id"`
+	TenantId   string          `json:"tenantId"`
+	ActorId    string          `json:"actorId,omitempty"`
+	ActorName  string          `json:"actorName,omitempty"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"targetType,omitempty"`
+	TargetId   string          `json:"targetId,omitempty"`
+	Changes    json.RawMessage `json:"changes,omitempty"`
+	Ip         string          `json:"ip"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+type AuditFilter struct {
+	TenantId   string
+	ActorId    string
+	Action     string
+	TargetType string
+	TargetId   string
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+type BookRevisionDTO struct {
+	Id            string          `json:"id"`
+	BookId        string          `json:"bookId"`
+	Revision      int             `json:"revision"`
+	Snapshot      json.RawMessage `json:"snapshot"`
+	ChangedBy     string          `json:"changedBy,omitempty"`
+	ChangedByName string          `json:"changedByName,omitempty"`
+	CreatedAt     time.Time       `json:"createdAt"`
 }
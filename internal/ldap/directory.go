@@ -0,0 +1,129 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrUserNotFound       = errors.New("user not found in directory")
+	ErrInvalidCredentials = errors.New("invalid directory credentials")
+)
+
+type Config struct {
+	URL            string
+	BindDN         string
+	BindPassword   string
+	BaseDN         string
+	UserFilter     string
+	UserAttribute  string
+	GroupAttribute string
+	StartTLS       bool
+	SkipVerify     bool
+}
+
+type Entry struct {
+	DN       string
+	Username string
+	Groups   []string
+}
+
+type Directory struct {
+	config Config
+}
+
+func NewDirectory(config Config) *Directory {
+	if config.UserFilter == "" {
+		config.UserFilter = "(uid=%s)"
+	}
+	if config.UserAttribute == "" {
+		config.UserAttribute = "uid"
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = "memberOf"
+	}
+	return &Directory{config: config}
+}
+
+func (d *Directory) Enabled() bool {
+	return d.config.URL != "" && d.config.BaseDN != ""
+}
+
+func (d *Directory) Authenticate(username, password string) (Entry, error) {
+	if username == "" || password == "" {
+		return Entry{}, ErrInvalidCredentials
+	}
+
+	conn, err := d.dial()
+	if err != nil {
+		return Entry{}, err
+	}
+	defer conn.Close()
+
+	if d.config.BindDN != "" {
+		err = conn.Bind(d.config.BindDN, d.config.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return Entry{}, fmt.Errorf("unable to bind service account: %w", err)
+	}
+
+	request := ldap.NewSearchRequest(
+		d.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(d.config.UserFilter, ldap.EscapeFilter(username)),
+		[]string{"dn", d.config.UserAttribute, d.config.GroupAttribute},
+		nil,
+	)
+	result, err := conn.Search(request)
+	if err != nil {
+		return Entry{}, fmt.Errorf("unable to search directory: %w", err)
+	}
+	if len(result.Entries) == 0 {
+		return Entry{}, ErrUserNotFound
+	}
+	if len(result.Entries) > 1 {
+		return Entry{}, fmt.Errorf("directory returned %d entries for %s", len(result.Entries), username)
+	}
+
+	entry := result.Entries[0]
+	if err = conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return Entry{}, ErrInvalidCredentials
+		}
+		return Entry{}, err
+	}
+
+	name := entry.GetAttributeValue(d.config.UserAttribute)
+	if name == "" {
+		name = username
+	}
+
+	return Entry{
+		DN:       entry.DN,
+		Username: name,
+		Groups:   entry.GetAttributeValues(d.config.GroupAttribute),
+	}, nil
+}
+
+func (d *Directory) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: d.config.SkipVerify}
+
+	conn, err := ldap.DialURL(d.config.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to directory: %w", err)
+	}
+
+	if d.config.StartTLS && !strings.HasPrefix(strings.ToLower(d.config.URL), "ldaps://") {
+		if err = conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("unable to start TLS: %w", err)
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,53 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewDirectoryDefaults(t *testing.T) {
+	d := NewDirectory(Config{})
+	if d.config.UserFilter != "(uid=%s)" || d.config.UserAttribute != "uid" || d.config.GroupAttribute != "memberOf" {
+		t.Errorf("defaults = %+v", d.config)
+	}
+
+	d = NewDirectory(Config{UserFilter: "(sAMAccountName=%s)", UserAttribute: "sAMAccountName"})
+	if d.config.UserFilter != "(sAMAccountName=%s)" || d.config.UserAttribute != "sAMAccountName" {
+		t.Errorf("configured values were replaced: %+v", d.config)
+	}
+}
+
+func TestDirectoryEnabled(t *testing.T) {
+	tests := []struct {
+		config Config
+		want   bool
+	}{
+		{config: Config{URL: "ldap://localhost", BaseDN: "dc=example,dc=com"}, want: true},
+		{config: Config{URL: "ldap://localhost"}, want: false},
+		{config: Config{BaseDN: "dc=example,dc=com"}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := NewDirectory(tt.config).Enabled(); got != tt.want {
+			t.Errorf("Enabled(%+v) = %v, want %v", tt.config, got, tt.want)
+		}
+	}
+}
+
+func TestAuthenticateEmptyCredentials(t *testing.T) {
+	// an empty password would be an unauthenticated bind that always succeeds
+	d := NewDirectory(Config{URL: "ldap://127.0.0.1:1", BaseDN: "dc=example,dc=com"})
+	for _, credentials := range [][2]string{{"", "secret"}, {"alice", ""}} {
+		if _, err := d.Authenticate(credentials[0], credentials[1]); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Authenticate(%q, %q) = %v, want %v", credentials[0], credentials[1], err, ErrInvalidCredentials)
+		}
+	}
+}
+
+func TestAuthenticateUnreachableDirectory(t *testing.T) {
+	d := NewDirectory(Config{URL: "ldap://127.0.0.1:1", BaseDN: "dc=example,dc=com"})
+	_, err := d.Authenticate("alice", "secret")
+	if err == nil || errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate on an unreachable directory = %v, want a connection error", err)
+	}
+}
@@ -0,0 +1,120 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	TransportSMTP = "smtp"
+	TransportFile = "file"
+	TransportLog  = "log"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+type Config struct {
+	Transport string
+	From      string
+	Host      string
+	Port      string
+	Username  string
+	Password  string
+	Dir       string
+}
+
+func NewMailer(config Config) (Mailer, error) {
+	if config.From == "" {
+		config.From = "cloud-library@localhost"
+	}
+
+	switch config.Transport {
+	case TransportSMTP:
+		if config.Host == "" {
+			return nil, fmt.Errorf("smtp host is required")
+		}
+		if config.Port == "" {
+			config.Port = "587"
+		}
+		return &smtpMailer{config: config}, nil
+	case TransportFile:
+		if config.Dir == "" {
+			return nil, fmt.Errorf("mail directory is required")
+		}
+		if err := os.MkdirAll(config.Dir, 0o700); err != nil {
+			return nil, err
+		}
+		return &fileMailer{from: config.From, dir: config.Dir}, nil
+	case TransportLog, "":
+		return &logMailer{from: config.From}, nil
+	default:
+		return nil, fmt.Errorf("unsupported mail transport: %s", config.Transport)
+	}
+}
+
+type smtpMailer struct {
+	config Config
+}
+
+func (m *smtpMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+
+	addr := net.JoinHostPort(m.config.Host, m.config.Port)
+	return smtp.SendMail(addr, auth, m.config.From, []string{msg.To}, encode(m.config.From, msg))
+}
+
+type fileMailer struct {
+	from string
+	dir  string
+}
+
+func (m *fileMailer) Send(msg Message) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.NewString())
+	return os.WriteFile(filepath.Join(m.dir, name), encode(m.from, msg), 0o600)
+}
+
+type logMailer struct {
+	from string
+}
+
+func (m *logMailer) Send(msg Message) error {
+	log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+func encode(from string, msg Message) []byte {
+	var buff bytes.Buffer
+	fmt.Fprintf(&buff, "From: %s\r\n", from)
+	fmt.Fprintf(&buff, "To: %s\r\n", sanitizeHeader(msg.To))
+	fmt.Fprintf(&buff, "Subject: %s\r\n", sanitizeHeader(msg.Subject))
+	fmt.Fprintf(&buff, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buff.WriteString("MIME-Version: 1.0\r\n")
+	buff.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buff.WriteString("\r\n")
+	buff.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buff.Bytes()
+}
+
+func sanitizeHeader(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
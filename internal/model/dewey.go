@@ -0,0 +1,34 @@
+package model
+
+type SubjectImport struct {
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	ParentCode string `json:"parentCode"`
+}
+
+var DeweyClassification = []SubjectImport{
+	{Code: "000", Name: "Computer science, information & general works"},
+	{Code: "004", Name: "Computer science", ParentCode: "000"},
+	{Code: "005", Name: "Computer programming, programs & data", ParentCode: "004"},
+	{Code: "005.74", Name: "Databases", ParentCode: "005"},
+	{Code: "006", Name: "Special computer methods", ParentCode: "004"},
+	{Code: "020", Name: "Library & information sciences", ParentCode: "000"},
+	{Code: "100", Name: "Philosophy & psychology"},
+	{Code: "150", Name: "Psychology", ParentCode: "100"},
+	{Code: "200", Name: "Religion"},
+	{Code: "300", Name: "Social sciences"},
+	{Code: "330", Name: "Economics", ParentCode: "300"},
+	{Code: "340", Name: "Law", ParentCode: "300"},
+	{Code: "400", Name: "Language"},
+	{Code: "500", Name: "Science"},
+	{Code: "510", Name: "Mathematics", ParentCode: "500"},
+	{Code: "530", Name: "Physics", ParentCode: "500"},
+	{Code: "540", Name: "Chemistry", ParentCode: "500"},
+	{Code: "570", Name: "Biology", ParentCode: "500"},
+	{Code: "600", Name: "Technology"},
+	{Code: "610", Name: "Medicine & health", ParentCode: "600"},
+	{Code: "620", Name: "Engineering", ParentCode: "600"},
+	{Code: "700", Name: "Arts & recreation"},
+	{Code: "800", Name: "Literature"},
+	{Code: "900", Name: "History & geography"},
+}
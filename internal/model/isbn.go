@@ -0,0 +1,82 @@
+package model
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidISBN = errors.New("invalid isbn")
+
+func NormalizeISBN(isbn string) string {
+	var b strings.Builder
+	for _, c := range strings.ToUpper(isbn) {
+		if (c >= '0' && c <= '9') || c == 'X' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+func ValidateISBN10(isbn string) error {
+	if len(isbn) != 10 {
+		return ErrInvalidISBN
+	}
+
+	sum := 0
+	for i, c := range isbn {
+		var digit int
+		switch {
+		case c >= '0' && c <= '9':
+			digit = int(c - '0')
+		case c == 'X' && i == 9:
+			digit = 10
+		default:
+			return ErrInvalidISBN
+		}
+		sum += (10 - i) * digit
+	}
+
+	if sum%11 != 0 {
+		return ErrInvalidISBN
+	}
+	return nil
+}
+
+func ValidateISBN13(isbn string) error {
+	if len(isbn) != 13 {
+		return ErrInvalidISBN
+	}
+
+	sum := 0
+	for i, c := range isbn {
+		if c < '0' || c > '9' {
+			return ErrInvalidISBN
+		}
+		digit := int(c - '0')
+		if i%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+
+	if sum%10 != 0 {
+		return ErrInvalidISBN
+	}
+	return nil
+}
+
+func ISBN13FromISBN10(isbn string) string {
+	body := "978" + isbn[:9]
+
+	sum := 0
+	for i, c := range body {
+		digit := int(c - '0')
+		if i%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	check := (10 - sum%10) % 10
+
+	return body + string(rune('0'+check))
+}
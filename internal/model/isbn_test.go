@@ -0,0 +1,91 @@
+package model
+
+import "testing"
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "0-306-40615-2", want: "0306406152"},
+		{in: "978 0 306 40615 7", want: "9780306406157"},
+		{in: "0-8044-2957-x", want: "080442957X"},
+		{in: "ISBN: 080442957X", want: "080442957X"},
+		{in: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeISBN(tt.in); got != tt.want {
+			t.Errorf("NormalizeISBN(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValidateISBN10(t *testing.T) {
+	tests := []struct {
+		isbn  string
+		valid bool
+	}{
+		{isbn: "0306406152", valid: true},
+		{isbn: "080442957X", valid: true},
+		{isbn: "0306406153", valid: false},
+		{isbn: "08044295X7", valid: false},
+		{isbn: "030640615", valid: false},
+		{isbn: "03064061522", valid: false},
+		{isbn: "030640615A", valid: false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateISBN10(tt.isbn)
+		if tt.valid && err != nil {
+			t.Errorf("ValidateISBN10(%q) = %v, want nil", tt.isbn, err)
+		}
+		if !tt.valid && err != ErrInvalidISBN {
+			t.Errorf("ValidateISBN10(%q) = %v, want %v", tt.isbn, err, ErrInvalidISBN)
+		}
+	}
+}
+
+func TestValidateISBN13(t *testing.T) {
+	tests := []struct {
+		isbn  string
+		valid bool
+	}{
+		{isbn: "9780306406157", valid: true},
+		{isbn: "9780804429573", valid: true},
+		{isbn: "9780306406158", valid: false},
+		{isbn: "978030640615", valid: false},
+		{isbn: "97803064061570", valid: false},
+		{isbn: "978030640615X", valid: false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateISBN13(tt.isbn)
+		if tt.valid && err != nil {
+			t.Errorf("ValidateISBN13(%q) = %v, want nil", tt.isbn, err)
+		}
+		if !tt.valid && err != ErrInvalidISBN {
+			t.Errorf("ValidateISBN13(%q) = %v, want %v", tt.isbn, err, ErrInvalidISBN)
+		}
+	}
+}
+
+func TestISBN13FromISBN10(t *testing.T) {
+	tests := []struct {
+		isbn10 string
+		want   string
+	}{
+		{isbn10: "0306406152", want: "9780306406157"},
+		{isbn10: "080442957X", want: "9780804429573"},
+	}
+
+	for _, tt := range tests {
+		got := ISBN13FromISBN10(tt.isbn10)
+		if got != tt.want {
+			t.Errorf("ISBN13FromISBN10(%q) = %q, want %q", tt.isbn10, got, tt.want)
+		}
+		if err := ValidateISBN13(got); err != nil {
+			t.Errorf("ISBN13FromISBN10(%q) produced invalid isbn13 %q", tt.isbn10, got)
+		}
+	}
+}
@@ -1,17 +1,72 @@
 package model
 
-import "github.com/szwedm/cloud-library/internal/dbmodel"
+import (
+	"time"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
 
 type Book struct {
-	Id      string `json:"id"`
-	Title   string `json:"title"`
-	Author  string `json:"author"`
-	Subject string `json:"subject"`
+	Id              string    `json:"id"`
+	Title           string    `json:"title"`
+	Isbn10          string    `json:"isbn10"`
+	Isbn13          string    `json:"isbn13"`
+	Publisher       string    `json:"publisher"`
+	PublicationYear int       `json:"publicationYear"`
+	Edition         string    `json:"edition"`
+	Language        string    `json:"language"`
+	Series          string    `json:"series"`
+	SeriesIndex     int       `json:"seriesIndex"`
+	Description     string    `json:"description"`
+	Authors         []Author  `json:"authors"`
+	Subjects        []Subject `json:"subjects"`
+	Tags            []Tag     `json:"tags"`
+	FileSize        int64     `json:"fileSize"`
+	TenantId        string    `json:"-"`
+}
+
+type Author struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	TenantId string `json:"-"`
+}
+
+type Subject struct {
+	Id       string    `json:"id"`
+	Name     string    `json:"name"`
+	Code     string    `json:"code,omitempty"`
+	ParentId string    `json:"parentId,omitempty"`
+	Children []Subject `json:"children,omitempty"`
+	TenantId string    `json:"-"`
+}
+
+type Tag struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	TenantId string `json:"-"`
+}
+
+type Collection struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Restricted  bool   `json:"restricted"`
+	TenantId    string `json:"-"`
+}
+
+type Group struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Role        string `json:"role,omitempty"`
+	TenantId    string `json:"-"`
 }
 
 const (
 	UserRoleReader        string = "reader"
+	UserRoleLibrarian     string = "librarian"
 	UserRoleAdministrator string = "administrator"
+	UserRoleSuperAdmin    string = "superadmin"
 )
 
 type User struct {
@@ -19,24 +74,159 @@ type User struct {
 	Username string `json:"username"`
 	Password string `json:"password,omitempty"`
 	Role     string `json:"role"`
+	Email    string `json:"email,omitempty"`
+	Status   string `json:"status,omitempty"`
+	TenantId string `json:"tenantId,omitempty"`
+}
+
+type Tenant struct {
+	Id         string    `json:"id"`
+	Slug       string    `json:"slug"`
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	QuotaBytes int64     `json:"quotaBytes"`
+	CreatedAt  time.Time `json:"createdAt"`
 }
 
 func BookFromDTO(dto dbmodel.BookDTO) (b Book) {
 	b = Book{
-		Id:      dto.Id,
-		Title:   dto.Title,
-		Author:  dto.Author,
-		Subject: dto.Subject,
+		Id:              dto.Id,
+		Title:           dto.Title,
+		Isbn10:          dto.Isbn10,
+		Isbn13:          dto.Isbn13,
+		Publisher:       dto.Publisher,
+		PublicationYear: dto.PublicationYear,
+		Edition:         dto.Edition,
+		Language:        dto.Language,
+		Series:          dto.Series,
+		SeriesIndex:     dto.SeriesIndex,
+		Description:     dto.Description,
+		FileSize:        dto.FileSize,
+		TenantId:        dto.TenantId,
+		Authors:         make([]Author, 0),
+		Subjects:        make([]Subject, 0),
+		Tags:            make([]Tag, 0),
 	}
 	return
 }
 
 func DTOFromBook(book Book) (dto dbmodel.BookDTO) {
 	dto = dbmodel.BookDTO{
-		Id:      book.Id,
-		Title:   book.Title,
-		Author:  book.Author,
-		Subject: book.Subject,
+		Id:              book.Id,
+		Title:           book.Title,
+		Isbn10:          book.Isbn10,
+		Isbn13:          book.Isbn13,
+		Publisher:       book.Publisher,
+		PublicationYear: book.PublicationYear,
+		Edition:         book.Edition,
+		Language:        book.Language,
+		Series:          book.Series,
+		SeriesIndex:     book.SeriesIndex,
+		Description:     book.Description,
+		FileSize:        book.FileSize,
+		TenantId:        book.TenantId,
+	}
+	return
+}
+
+func AuthorFromDTO(dto dbmodel.AuthorDTO) (a Author) {
+	a = Author{
+		Id:       dto.Id,
+		Name:     dto.Name,
+		TenantId: dto.TenantId,
+	}
+	return
+}
+
+func DTOFromAuthor(author Author) (dto dbmodel.AuthorDTO) {
+	dto = dbmodel.AuthorDTO{
+		Id:       author.Id,
+		Name:     author.Name,
+		TenantId: author.TenantId,
+	}
+	return
+}
+
+func SubjectFromDTO(dto dbmodel.SubjectDTO) (s Subject) {
+	s = Subject{
+		Id:       dto.Id,
+		Name:     dto.Name,
+		Code:     dto.Code,
+		ParentId: dto.ParentId,
+		TenantId: dto.TenantId,
+	}
+	return
+}
+
+func DTOFromSubject(subject Subject) (dto dbmodel.SubjectDTO) {
+	dto = dbmodel.SubjectDTO{
+		Id:       subject.Id,
+		Name:     subject.Name,
+		Code:     subject.Code,
+		ParentId: subject.ParentId,
+		TenantId: subject.TenantId,
+	}
+	return
+}
+
+func TagFromDTO(dto dbmodel.TagDTO) (t Tag) {
+	t = Tag{
+		Id:       dto.Id,
+		Name:     dto.Name,
+		TenantId: dto.TenantId,
+	}
+	return
+}
+
+func DTOFromTag(tag Tag) (dto dbmodel.TagDTO) {
+	dto = dbmodel.TagDTO{
+		Id:       tag.Id,
+		Name:     tag.Name,
+		TenantId: tag.TenantId,
+	}
+	return
+}
+
+func CollectionFromDTO(dto dbmodel.CollectionDTO) (c Collection) {
+	c = Collection{
+		Id:          dto.Id,
+		Name:        dto.Name,
+		Description: dto.Description,
+		Restricted:  dto.Restricted,
+		TenantId:    dto.TenantId,
+	}
+	return
+}
+
+func DTOFromCollection(collection Collection) (dto dbmodel.CollectionDTO) {
+	dto = dbmodel.CollectionDTO{
+		Id:          collection.Id,
+		Name:        collection.Name,
+		Description: collection.Description,
+		Restricted:  collection.Restricted,
+		TenantId:    collection.TenantId,
+	}
+	return
+}
+
+func GroupFromDTO(dto dbmodel.GroupDTO) (g Group) {
+	g = Group{
+		Id:          dto.Id,
+		Name:        dto.Name,
+		Description: dto.Description,
+		Role:        dto.Role,
+		TenantId:    dto.TenantId,
+	}
+	return
+}
+
+func DTOFromGroup(group Group) (dto dbmodel.GroupDTO) {
+	dto = dbmodel.GroupDTO{
+		Id:          group.Id,
+		Name:        group.Name,
+		Description: group.Description,
+		Role:        group.Role,
+		TenantId:    group.TenantId,
 	}
 	return
 }
@@ -45,8 +235,10 @@ func UserFromDTO(dto dbmodel.UserDTO) (u User) {
 	u = User{
 		Id:       dto.Id,
 		Username: dto.Username,
-		Password: dto.Password,
 		Role:     dto.Role,
+		Email:    dto.Email,
+		Status:   dto.Status,
+		TenantId: dto.TenantId,
 	}
 	return
 }
@@ -57,6 +249,33 @@ func DTOFromUser(user User) (dto dbmodel.UserDTO) {
 		Username: user.Username,
 		Password: user.Password,
 		Role:     user.Role,
+		Email:    user.Email,
+		Status:   user.Status,
+		TenantId: user.TenantId,
+	}
+	return
+}
+
+func TenantFromDTO(dto dbmodel.TenantDTO) (t Tenant) {
+	t = Tenant{
+		Id:         dto.Id,
+		Slug:       dto.Slug,
+		Name:       dto.Name,
+		Status:     dto.Status,
+		QuotaBytes: dto.QuotaBytes,
+		CreatedAt:  dto.CreatedAt,
+	}
+	return
+}
+
+func DTOFromTenant(tenant Tenant) (dto dbmodel.TenantDTO) {
+	dto = dbmodel.TenantDTO{
+		Id:         tenant.Id,
+		Slug:       tenant.Slug,
+		Name:       tenant.Name,
+		Status:     tenant.Status,
+		QuotaBytes: tenant.QuotaBytes,
+		CreatedAt:  tenant.CreatedAt,
 	}
 	return
 }
@@ -0,0 +1,179 @@
+//go:build mockidp
+// +build mockidp
+
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/google/uuid"
+	"github.com/szwedm/cloud-library/internal/signing"
+)
+
+type mockCode struct {
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	claims      map[string]interface{}
+	expiresAt   time.Time
+}
+
+type MockProvider struct {
+	issuer string
+	claims map[string]interface{}
+	kid    string
+	key    *rsa.PrivateKey
+	mux    *http.ServeMux
+
+	mu    sync.Mutex
+	codes map[string]mockCode
+}
+
+func NewMockProvider(issuer string, claims map[string]interface{}) (*MockProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MockProvider{
+		issuer: issuer,
+		claims: claims,
+		kid:    uuid.NewString(),
+		key:    key,
+		mux:    http.NewServeMux(),
+		codes:  make(map[string]mockCode),
+	}
+	m.mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	m.mux.HandleFunc("/authorize", m.authorize)
+	m.mux.HandleFunc("/token", m.token)
+	m.mux.HandleFunc("/jwks", m.jwks)
+	return m, nil
+}
+
+func (m *MockProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mux.ServeHTTP(w, r)
+}
+
+func (m *MockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, discovery{
+		Issuer:                m.issuer,
+		AuthorizationEndpoint: m.issuer + "/authorize",
+		TokenEndpoint:         m.issuer + "/token",
+		JWKSURI:               m.issuer + "/jwks",
+	})
+}
+
+func (m *MockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "only the authorization code flow with S256 PKCE is supported", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	claims := make(map[string]interface{})
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+	if hint := query.Get("login_hint"); hint != "" {
+		claims["sub"] = hint
+		claims["preferred_username"] = hint
+	}
+
+	code := uuid.NewString()
+	m.mu.Lock()
+	m.codes[code] = mockCode{
+		clientID:    query.Get("client_id"),
+		redirectURI: query.Get("redirect_uri"),
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+		claims:      claims,
+		expiresAt:   time.Now().Add(time.Minute),
+	}
+	m.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (m *MockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, tokenResponse{Error: "invalid_request"})
+		return
+	}
+
+	m.mu.Lock()
+	code, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	if !ok || time.Now().After(code.expiresAt) || code.redirectURI != r.PostForm.Get("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, tokenResponse{Error: "invalid_grant"})
+		return
+	}
+	if CodeChallenge(r.PostForm.Get("code_verifier")) != code.challenge {
+		writeJSON(w, http.StatusBadRequest, tokenResponse{Error: "invalid_grant", Description: "PKCE verification failed"})
+		return
+	}
+
+	token := jwt.New(jwt.SigningMethodRS256)
+	token.Header["kid"] = m.kid
+	claims := token.Claims.(jwt.MapClaims)
+	for k, v := range code.claims {
+		claims[k] = v
+	}
+	claims["iss"] = m.issuer
+	claims["aud"] = code.clientID
+	claims["nonce"] = code.nonce
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = time.Now().Add(5 * time.Minute).Unix()
+
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, tokenResponse{Error: "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken: uuid.NewString(),
+		IDToken:     idToken,
+		TokenType:   "Bearer",
+	})
+}
+
+func (m *MockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, signing.JSONWebKeySet{
+		Keys: []signing.JSONWebKey{{
+			Kty: "RSA",
+			Kid: m.kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(payload)
+}
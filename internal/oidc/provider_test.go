@@ -0,0 +1,176 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/szwedm/cloud-library/internal/signing"
+)
+
+// testIdP issues id_tokens for a single authorization, claims overrides
+// what a well behaved provider would put into the token.
+type testIdP struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &testIdP{key: key, claims: jwt.MapClaims{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(discovery{
+			Issuer:                idp.URL,
+			AuthorizationEndpoint: idp.URL + "/authorize",
+			TokenEndpoint:         idp.URL + "/token",
+			JWKSURI:               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(signing.JSONWebKeySet{Keys: []signing.JSONWebKey{{
+			Kty: "RSA",
+			Kid: "test",
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *testIdP) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	if CodeChallenge(r.PostForm.Get("code_verifier")) != idp.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tokenResponse{Error: "invalid_grant", Description: "PKCE verification failed"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   idp.URL,
+		"aud":   r.PostForm.Get("client_id"),
+		"sub":   "alice",
+		"nonce": idp.nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, _ := token.SignedString(idp.key)
+	json.NewEncoder(w).Encode(tokenResponse{AccessToken: "access", IDToken: idToken, TokenType: "Bearer"})
+}
+
+// authorize plays the browser leg of the flow and remembers what the
+// provider sent to the authorization endpoint.
+func (idp *testIdP) authorize(t *testing.T, p *Provider, state, nonce, verifier string) url.Values {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	idp.challenge = query.Get("code_challenge")
+	idp.nonce = query.Get("nonce")
+	return query
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := newTestIdP(t)
+	p := NewProvider(Config{Issuer: idp.URL, ClientID: "library", RedirectURL: "https://library.example.com/oidc/callback"})
+
+	query := idp.authorize(t, p, "state", "nonce", "verifier")
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "library",
+		"state":                 "state",
+		"nonce":                 "nonce",
+		"code_challenge":        CodeChallenge("verifier"),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := query.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if strings.Contains(query.Encode(), "verifier") {
+		t.Error("the code verifier was sent to the authorization endpoint")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		verifier string
+		nonce    string
+		wantErr  string
+	}{
+		{name: "valid"},
+		{name: "wrong code verifier", verifier: "another-verifier", wantErr: "PKCE"},
+		{name: "wrong nonce", nonce: "another-nonce", wantErr: "nonce"},
+		{name: "wrong issuer", claims: jwt.MapClaims{"iss": "https://evil.example.com"}, wantErr: "issuer"},
+		{name: "wrong audience", claims: jwt.MapClaims{"aud": "another-client"}, wantErr: "invalid id_token"},
+		{name: "expired", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}, wantErr: "invalid id_token"},
+		{name: "no subject", claims: jwt.MapClaims{"sub": ""}, wantErr: "subject"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newTestIdP(t)
+			idp.claims = tt.claims
+			p := NewProvider(Config{Issuer: idp.URL, ClientID: "library", RedirectURL: "https://library.example.com/oidc/callback"})
+			idp.authorize(t, p, "state", "nonce", "verifier")
+
+			verifier, nonce := "verifier", "nonce"
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			claims, err := p.Exchange("code", verifier, nonce)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if claims["sub"] != "alice" {
+					t.Errorf("sub = %v, want alice", claims["sub"])
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Exchange() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
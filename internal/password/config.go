@@ -0,0 +1,59 @@
+package password
+
+import (
+	"os"
+	"strconv"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+type Config struct {
+	Algorithm      string
+	BcryptCost     int
+	Argon2Time     uint32
+	Argon2Memory   uint32
+	Argon2Threads  uint8
+	MinLength      int
+	MaxLength      int
+	BreachedList   string
+	RejectUsername bool
+}
+
+func NewConfig() Config {
+	cfg := Config{
+		Algorithm:      AlgorithmArgon2id,
+		BcryptCost:     10,
+		Argon2Time:     3,
+		Argon2Memory:   64 * 1024,
+		Argon2Threads:  2,
+		MinLength:      8,
+		MaxLength:      128,
+		BreachedList:   os.Getenv("APP_PASSWORD_BREACHED_LIST"),
+		RejectUsername: os.Getenv("APP_PASSWORD_ALLOW_USERNAME") != "true",
+	}
+	if algorithm := os.Getenv("APP_PASSWORD_HASH"); algorithm != "" {
+		cfg.Algorithm = algorithm
+	}
+	if n, err := strconv.Atoi(os.Getenv("APP_BCRYPT_COST")); err == nil && n > 0 {
+		cfg.BcryptCost = n
+	}
+	if n, err := strconv.ParseUint(os.Getenv("APP_ARGON2_TIME"), 10, 32); err == nil && n > 0 {
+		cfg.Argon2Time = uint32(n)
+	}
+	if n, err := strconv.ParseUint(os.Getenv("APP_ARGON2_MEMORY"), 10, 32); err == nil && n > 0 {
+		cfg.Argon2Memory = uint32(n)
+	}
+	if n, err := strconv.ParseUint(os.Getenv("APP_ARGON2_THREADS"), 10, 8); err == nil && n > 0 {
+		cfg.Argon2Threads = uint8(n)
+	}
+	if n, err := strconv.Atoi(os.Getenv("APP_PASSWORD_MIN_LENGTH")); err == nil && n > 0 {
+		cfg.MinLength = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("APP_PASSWORD_MAX_LENGTH")); err == nil && n > 0 {
+		cfg.MaxLength = n
+	}
+	return cfg
+}
@@ -0,0 +1,108 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const bcryptMaxLength = 72
+
+var (
+	ErrTooShort         = errors.New("password is too short")
+	ErrTooLong          = errors.New("password is too long")
+	ErrBreached         = errors.New("password appears in a list of breached passwords")
+	ErrContainsUsername = errors.New("password must not contain the username")
+)
+
+type Policy struct {
+	minLength      int
+	maxLength      int
+	maxBytes       int
+	rejectUsername bool
+	breached       map[string]bool
+}
+
+func NewPolicy(cfg Config) (*Policy, error) {
+	p := &Policy{
+		minLength:      cfg.MinLength,
+		maxLength:      cfg.MaxLength,
+		rejectUsername: cfg.RejectUsername,
+		breached:       make(map[string]bool),
+	}
+	if cfg.Algorithm == AlgorithmBcrypt {
+		p.maxBytes = bcryptMaxLength
+	}
+
+	if cfg.BreachedList == "" {
+		return p, nil
+	}
+
+	file, err := os.Open(cfg.BreachedList)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read breached password list: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.breached[breachedKey(line)] = true
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read breached password list: %w", err)
+	}
+	return p, nil
+}
+
+func (p *Policy) Validate(username, password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		return fmt.Errorf("%w, at least %d characters are required", ErrTooShort, p.minLength)
+	}
+	if p.maxLength > 0 && length > p.maxLength {
+		return fmt.Errorf("%w, at most %d characters are allowed", ErrTooLong, p.maxLength)
+	}
+	if p.maxBytes > 0 && len(password) > p.maxBytes {
+		return fmt.Errorf("%w, at most %d bytes are allowed", ErrTooLong, p.maxBytes)
+	}
+	if p.rejectUsername && username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return ErrContainsUsername
+	}
+	if p.breached[sha1Hex(password)] {
+		return ErrBreached
+	}
+	return nil
+}
+
+func breachedKey(line string) string {
+	hash := line
+	if i := strings.Index(line, ":"); i >= 0 {
+		hash = line[:i]
+	}
+	if isSHA1(hash) {
+		return strings.ToUpper(hash)
+	}
+	return sha1Hex(line)
+}
+
+func isSHA1(s string) bool {
+	if len(s) != sha1.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,159 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		username string
+		password string
+		want     error
+	}{
+		{
+			name:     "valid",
+			cfg:      Config{MinLength: 8, MaxLength: 16},
+			password: "correct-horse",
+		},
+		{
+			name:     "too short",
+			cfg:      Config{MinLength: 8},
+			password: "short",
+			want:     ErrTooShort,
+		},
+		{
+			name:     "length counts characters not bytes",
+			cfg:      Config{MinLength: 8},
+			password: "zażółćgę",
+		},
+		{
+			name:     "too long",
+			cfg:      Config{MinLength: 1, MaxLength: 10},
+			password: "much-too-long",
+			want:     ErrTooLong,
+		},
+		{
+			name:     "no max length",
+			cfg:      Config{MinLength: 1},
+			password: strings.Repeat("a", 200),
+		},
+		{
+			name:     "bcrypt byte limit",
+			cfg:      Config{Algorithm: AlgorithmBcrypt, MinLength: 1, MaxLength: 128},
+			password: strings.Repeat("ą", 40),
+			want:     ErrTooLong,
+		},
+		{
+			name:     "argon2id has no byte limit",
+			cfg:      Config{Algorithm: AlgorithmArgon2id, MinLength: 1, MaxLength: 128},
+			password: strings.Repeat("ą", 40),
+		},
+		{
+			name:     "contains username",
+			cfg:      Config{MinLength: 8, RejectUsername: true},
+			username: "Alice",
+			password: "my-alice-password",
+			want:     ErrContainsUsername,
+		},
+		{
+			name:     "username allowed",
+			cfg:      Config{MinLength: 8},
+			username: "alice",
+			password: "my-alice-password",
+		},
+		{
+			name:     "empty username is ignored",
+			cfg:      Config{MinLength: 8, RejectUsername: true},
+			password: "my-alice-password",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPolicy(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewPolicy: unexpected error: %v", err)
+			}
+			err = p.Validate(tt.username, tt.password)
+			if tt.want == nil && err != nil {
+				t.Errorf("Validate(%q) = %v, want nil", tt.password, err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Validate(%q) = %v, want %v", tt.password, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyBreachedList(t *testing.T) {
+	list := strings.Join([]string{
+		"# breached passwords",
+		"",
+		"letmein123",
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493",
+		strings.ToLower(sha1Hex("qwertyuiop")),
+	}, "\n")
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(list), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPolicy(Config{MinLength: 1, BreachedList: path})
+	if err != nil {
+		t.Fatalf("NewPolicy: unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		password string
+		breached bool
+	}{
+		{password: "letmein123", breached: true},
+		{password: "password", breached: true},
+		{password: "qwertyuiop", breached: true},
+		{password: "# breached passwords", breached: false},
+		{password: "correct-horse", breached: false},
+	}
+
+	for _, tt := range tests {
+		err := p.Validate("", tt.password)
+		if tt.breached && !errors.Is(err, ErrBreached) {
+			t.Errorf("Validate(%q) = %v, want %v", tt.password, err, ErrBreached)
+		}
+		if !tt.breached && err != nil {
+			t.Errorf("Validate(%q) = %v, want nil", tt.password, err)
+		}
+	}
+}
+
+func TestNewPolicyMissingBreachedList(t *testing.T) {
+	_, err := NewPolicy(Config{BreachedList: filepath.Join(t.TempDir(), "missing.txt")})
+	if err == nil {
+		t.Error("expected error for missing breached password list")
+	}
+}
+
+func TestBreachedKey(t *testing.T) {
+	sum := sha1.Sum([]byte("password"))
+	want := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	tests := []string{
+		"password",
+		want,
+		strings.ToLower(want),
+		want + ":42",
+	}
+
+	for _, line := range tests {
+		if got := breachedKey(line); got != want {
+			t.Errorf("breachedKey(%q) = %s, want %s", line, got, want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package rbac
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/szwedm/cloud-library/internal/model"
+)
+
+type Permission string
+
+const (
+	BooksRead     Permission = "books:read"
+	BooksWrite    Permission = "books:write"
+	BooksDelete   Permission = "books:delete"
+	BooksImport   Permission = "books:import"
+	CatalogManage Permission = "catalog:manage"
+	UsersManage   Permission = "users:manage"
+	AclManage     Permission = "acl:manage"
+	TenantsManage Permission = "tenants:manage"
+	AuditRead     Permission = "audit:read"
+)
+
+var AllPermissions = []Permission{
+	BooksRead,
+	BooksWrite,
+	BooksDelete,
+	BooksImport,
+	CatalogManage,
+	UsersManage,
+	AclManage,
+	TenantsManage,
+	AuditRead,
+}
+
+type Policy struct {
+	roles map[string][]string
+}
+
+type policyFile struct {
+	Roles map[string][]string `json:"roles"`
+}
+
+func NewPolicy() *Policy {
+	return &Policy{
+		roles: map[string][]string{
+			model.UserRoleReader:        {string(BooksRead)},
+			model.UserRoleLibrarian:     {string(BooksRead), string(BooksWrite), string(BooksImport), string(CatalogManage)},
+			model.UserRoleAdministrator: {"books:*", "catalog:*", "users:*", "acl:*", "audit:*"},
+			model.UserRoleSuperAdmin:    {"*"},
+		},
+	}
+}
+
+func LoadPolicy(path string) (*Policy, error) {
+	p := NewPolicy()
+	if path == "" {
+		return p, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read role definitions: %w", err)
+	}
+
+	var file policyFile
+	if err = json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("unable to parse role definitions: %w", err)
+	}
+
+	for role, permissions := range file.Roles {
+		for _, permission := range permissions {
+			if !ValidPattern(permission) {
+				return nil, fmt.Errorf("role %s: unknown permission %s", role, permission)
+			}
+		}
+		p.roles[role] = permissions
+	}
+	return p, nil
+}
+
+func (p *Policy) Allowed(role string, permission Permission) bool {
+	for _, pattern := range p.roles[role] {
+		if matches(pattern, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) AllowedAny(roles []string, permission Permission) bool {
+	for _, role := range roles {
+		if p.Allowed(role, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) CanAssign(roles []string, role string) bool {
+	for _, permission := range p.Permissions(role) {
+		if !p.AllowedAny(roles, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Policy) HasRole(role string) bool {
+	_, ok := p.roles[role]
+	return ok
+}
+
+func (p *Policy) Roles() map[string][]Permission {
+	roles := make(map[string][]Permission, len(p.roles))
+	for role := range p.roles {
+		roles[role] = p.Permissions(role)
+	}
+	return roles
+}
+
+func (p *Policy) Permissions(role string) []Permission {
+	permissions := make([]Permission, 0)
+	for _, permission := range AllPermissions {
+		if p.Allowed(role, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i] < permissions[j] })
+	return permissions
+}
+
+func Permits(patterns []string, permission Permission) bool {
+	for _, pattern := range patterns {
+		if matches(pattern, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+func matches(pattern string, permission Permission) bool {
+	if pattern == "*" || pattern == string(permission) {
+		return true
+	}
+	if strings.HasSuffix(pattern, ":*") {
+		return strings.HasPrefix(string(permission), strings.TrimSuffix(pattern, "*"))
+	}
+	return false
+}
+
+func ValidPattern(pattern string) bool {
+	for _, permission := range AllPermissions {
+		if matches(pattern, permission) {
+			return true
+		}
+	}
+	return false
+}
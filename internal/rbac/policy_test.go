@@ -0,0 +1,180 @@
+package rbac
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/szwedm/cloud-library/internal/model"
+)
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		permission Permission
+		want       bool
+	}{
+		{pattern: "*", permission: TenantsManage, want: true},
+		{pattern: "books:read", permission: BooksRead, want: true},
+		{pattern: "books:read", permission: BooksWrite, want: false},
+		{pattern: "books:*", permission: BooksDelete, want: true},
+		{pattern: "books:*", permission: CatalogManage, want: false},
+		{pattern: "book:*", permission: BooksRead, want: false},
+		{pattern: "books*", permission: BooksRead, want: false},
+		{pattern: "*:read", permission: BooksRead, want: false},
+		{pattern: "", permission: BooksRead, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := matches(tt.pattern, tt.permission); got != tt.want {
+			t.Errorf("matches(%q, %s) = %v, want %v", tt.pattern, tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestValidPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{pattern: "*", want: true},
+		{pattern: "books:*", want: true},
+		{pattern: "audit:read", want: true},
+		{pattern: "audit:write", want: false},
+		{pattern: "shelves:*", want: false},
+		{pattern: "", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidPattern(tt.pattern); got != tt.want {
+			t.Errorf("ValidPattern(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyAllowed(t *testing.T) {
+	p := NewPolicy()
+
+	tests := []struct {
+		role       string
+		permission Permission
+		want       bool
+	}{
+		{role: model.UserRoleReader, permission: BooksRead, want: true},
+		{role: model.UserRoleReader, permission: BooksWrite, want: false},
+		{role: model.UserRoleLibrarian, permission: CatalogManage, want: true},
+		{role: model.UserRoleLibrarian, permission: BooksDelete, want: false},
+		{role: model.UserRoleAdministrator, permission: BooksDelete, want: true},
+		{role: model.UserRoleAdministrator, permission: AuditRead, want: true},
+		{role: model.UserRoleAdministrator, permission: TenantsManage, want: false},
+		{role: model.UserRoleSuperAdmin, permission: TenantsManage, want: true},
+		{role: "unknown", permission: BooksRead, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := p.Allowed(tt.role, tt.permission); got != tt.want {
+			t.Errorf("Allowed(%s, %s) = %v, want %v", tt.role, tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyAllowedAny(t *testing.T) {
+	p := NewPolicy()
+
+	tests := []struct {
+		roles      []string
+		permission Permission
+		want       bool
+	}{
+		{roles: []string{model.UserRoleReader, model.UserRoleLibrarian}, permission: BooksImport, want: true},
+		{roles: []string{model.UserRoleReader}, permission: BooksImport, want: false},
+		{roles: []string{"unknown", model.UserRoleSuperAdmin}, permission: AclManage, want: true},
+		{roles: nil, permission: BooksRead, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := p.AllowedAny(tt.roles, tt.permission); got != tt.want {
+			t.Errorf("AllowedAny(%v, %s) = %v, want %v", tt.roles, tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyCanAssign(t *testing.T) {
+	p := NewPolicy()
+
+	tests := []struct {
+		roles []string
+		role  string
+		want  bool
+	}{
+		{roles: []string{model.UserRoleAdministrator}, role: model.UserRoleLibrarian, want: true},
+		{roles: []string{model.UserRoleAdministrator}, role: model.UserRoleAdministrator, want: true},
+		{roles: []string{model.UserRoleAdministrator}, role: model.UserRoleSuperAdmin, want: false},
+		{roles: []string{model.UserRoleLibrarian}, role: model.UserRoleAdministrator, want: false},
+		{roles: []string{model.UserRoleReader, model.UserRoleLibrarian}, role: model.UserRoleLibrarian, want: true},
+		{roles: []string{model.UserRoleSuperAdmin}, role: model.UserRoleSuperAdmin, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := p.CanAssign(tt.roles, tt.role); got != tt.want {
+			t.Errorf("CanAssign(%v, %s) = %v, want %v", tt.roles, tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestPermits(t *testing.T) {
+	tests := []struct {
+		patterns   []string
+		permission Permission
+		want       bool
+	}{
+		{patterns: []string{"books:read", "catalog:*"}, permission: CatalogManage, want: true},
+		{patterns: []string{"books:read"}, permission: BooksWrite, want: false},
+		{patterns: []string{"*"}, permission: UsersManage, want: true},
+		{patterns: nil, permission: BooksRead, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := Permits(tt.patterns, tt.permission); got != tt.want {
+			t.Errorf("Permits(%v, %s) = %v, want %v", tt.patterns, tt.permission, got, tt.want)
+		}
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "custom role", content: `{"roles": {"curator": ["books:read", "catalog:*"]}}`},
+		{name: "unknown permission", content: `{"roles": {"curator": ["shelves:*"]}}`, wantErr: true},
+		{name: "malformed", content: `{"roles": [`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "roles.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := LoadPolicy(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !p.Allowed("curator", CatalogManage) || p.Allowed("curator", BooksWrite) {
+				t.Errorf("curator permissions = %v", p.Permissions("curator"))
+			}
+			if !p.Allowed(model.UserRoleReader, BooksRead) {
+				t.Error("built-in roles must be kept")
+			}
+		})
+	}
+}
@@ -0,0 +1,447 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/model"
+	"github.com/szwedm/cloud-library/internal/rbac"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+type accessControl struct {
+	acl    storage.ACL
+	books  storage.Books
+	policy *rbac.Policy
+}
+
+func newAccessControl(a storage.ACL, b storage.Books, p *rbac.Policy) *accessControl {
+	return &accessControl{
+		acl:    a,
+		books:  b,
+		policy: p,
+	}
+}
+
+func (a *accessControl) visibleBooks(r *http.Request, dtos []dbmodel.BookDTO) ([]dbmodel.BookDTO, error) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+	tenant := tenantFromRequest(r)
+	inTenant := make([]dbmodel.BookDTO, 0, len(dtos))
+	for _, dto := range dtos {
+		if dto.TenantId == tenant {
+			inTenant = append(inTenant, dto)
+		}
+	}
+	dtos = inTenant
+
+	if a.policy.AllowedAny(rolesFromClaims(props), rbac.AclManage) || len(dtos) == 0 {
+		return dtos, nil
+	}
+
+	ids := make([]string, 0, len(dtos))
+	for _, dto := range dtos {
+		ids = append(ids, dto.Id)
+	}
+
+	userID, _ := props["id"].(string)
+	hidden, err := a.acl.GetHiddenBookIDs(ids, userID, groupsFromClaims(props))
+	if err != nil {
+		return nil, err
+	}
+	if len(hidden) == 0 {
+		return dtos, nil
+	}
+
+	skip := make(map[string]bool, len(hidden))
+	for _, id := range hidden {
+		skip[id] = true
+	}
+
+	visible := make([]dbmodel.BookDTO, 0, len(dtos)-len(hidden))
+	for _, dto := range dtos {
+		if !skip[dto.Id] {
+			visible = append(visible, dto)
+		}
+	}
+	return visible, nil
+}
+
+func (a *accessControl) canAccessBook(r *http.Request, bookID string) (bool, error) {
+	dto, err := a.books.GetBookByID(bookID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	visible, err := a.visibleBooks(r, []dbmodel.BookDTO{dto})
+	if err != nil {
+		return false, err
+	}
+	return len(visible) == 1, nil
+}
+
+func groupsFromClaims(props jwt.MapClaims) []string {
+	return stringsFromClaim(props["groups"])
+}
+
+func rolesFromClaims(props jwt.MapClaims) []string {
+	roles := make([]string, 0)
+	if role, _ := props["role"].(string); role != "" {
+		roles = append(roles, role)
+	}
+	return append(roles, stringsFromClaim(props["groupRoles"])...)
+}
+
+func stringsFromClaim(claim interface{}) []string {
+	values := make([]string, 0)
+	switch v := claim.(type) {
+	case []string:
+		values = append(values, v...)
+	case []interface{}:
+		for _, item := range v {
+			if value, ok := item.(string); ok {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+type aclHandler struct {
+	acl         storage.ACL
+	books       storage.Books
+	collections storage.Collections
+	users       storage.Users
+	groups      storage.Groups
+	audit       *auditor
+}
+
+func newACLHandler(a storage.ACL, b storage.Books, c storage.Collections, u storage.Users, g storage.Groups, au *auditor) *aclHandler {
+	return &aclHandler{
+		acl:         a,
+		books:       b,
+		collections: c,
+		users:       u,
+		groups:      g,
+		audit:       au,
+	}
+}
+
+type bookACL struct {
+	Restricted  bool               `json:"restricted"`
+	Collections []model.Collection `json:"collections"`
+	Grants      []dbmodel.GrantDTO `json:"grants"`
+}
+
+type grantRequest struct {
+	PrincipalType string `json:"principalType"`
+	PrincipalId   string `json:"principalId"`
+}
+
+func (h *aclHandler) getBookACL(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("book id is required"))
+		return
+	}
+
+	if _, err := bookInTenant(h.books, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("book with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	restricted, err := h.acl.IsBookRestricted(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	collections, err := h.collections.GetCollectionsByBookID(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	grants, err := h.acl.GetGrants(dbmodel.GrantResourceBook, vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := bookACL{
+		Restricted:  restricted,
+		Collections: make([]model.Collection, 0),
+		Grants:      grants,
+	}
+	for _, dto := range collections {
+		resp.Collections = append(resp.Collections, model.CollectionFromDTO(dto))
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *aclHandler) updateBookACL(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("book id is required"))
+		return
+	}
+
+	var req bookACL
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	dto, err := bookInTenant(h.books, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("book with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	restricted, err := h.acl.IsBookRestricted(dto.Id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err = h.acl.SetBookRestricted(dto.Id, req.Restricted); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditBookACLUpdate, "book", dto.Id, bookACL{Restricted: restricted}, bookACL{Restricted: req.Restricted})
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "book access updated"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *aclHandler) getCollectionGrants(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("collection id is required"))
+		return
+	}
+
+	if _, err := collectionInTenant(h.collections, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("collection with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	grants, err := h.acl.GetGrants(dbmodel.GrantResourceCollection, vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	body, err := json.Marshal(grants)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *aclHandler) createBookGrant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("book id is required"))
+		return
+	}
+
+	if _, err := bookInTenant(h.books, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("book with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.createGrant(w, r, dbmodel.GrantResourceBook, vars["id"])
+}
+
+func (h *aclHandler) createCollectionGrant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("collection id is required"))
+		return
+	}
+
+	if _, err := collectionInTenant(h.collections, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("collection with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.createGrant(w, r, dbmodel.GrantResourceCollection, vars["id"])
+}
+
+func (h *aclHandler) deleteBookGrant(w http.ResponseWriter, r *http.Request) {
+	h.deleteGrant(w, r, dbmodel.GrantResourceBook)
+}
+
+func (h *aclHandler) deleteCollectionGrant(w http.ResponseWriter, r *http.Request) {
+	h.deleteGrant(w, r, dbmodel.GrantResourceCollection)
+}
+
+func (h *aclHandler) createGrant(w http.ResponseWriter, r *http.Request, resourceType, resourceID string) {
+	var req grantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	switch req.PrincipalType {
+	case dbmodel.GrantPrincipalUser:
+		if _, err := userInTenant(h.users, r, req.PrincipalId); err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusBadRequest, fmt.Errorf("user with id: %s not found", req.PrincipalId))
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	case dbmodel.GrantPrincipalGroup:
+		if _, err := groupInTenant(h.groups, r, req.PrincipalId); err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusBadRequest, fmt.Errorf("group with id: %s not found", req.PrincipalId))
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	default:
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("unsupported principal type: %s", req.PrincipalType))
+		return
+	}
+
+	dto := dbmodel.GrantDTO{
+		Id:            uuid.NewString(),
+		ResourceType:  resourceType,
+		ResourceId:    resourceID,
+		PrincipalType: req.PrincipalType,
+		PrincipalId:   req.PrincipalId,
+		CreatedAt:     time.Now(),
+	}
+	id, err := h.acl.CreateGrant(dto)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditGrantCreate, "grant", id, nil, dto)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "grant created with id: " + id}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, body)
+}
+
+func (h *aclHandler) deleteGrant(w http.ResponseWriter, r *http.Request, resourceType string) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" || vars["grantId"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("resource id and grant id are required"))
+		return
+	}
+
+	var err error
+	if resourceType == dbmodel.GrantResourceBook {
+		_, err = bookInTenant(h.books, r, vars["id"])
+	} else {
+		_, err = collectionInTenant(h.collections, r, vars["id"])
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("%s with id: %s not found, %w", resourceType, vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	grant, err := h.acl.GetGrantByID(vars["grantId"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("grant with id: %s not found, %w", vars["grantId"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if grant.ResourceType != resourceType || grant.ResourceId != vars["id"] {
+		respondWithError(w, http.StatusNotFound, fmt.Errorf("grant with id: %s not found", vars["grantId"]))
+		return
+	}
+
+	if err = h.acl.DeleteGrantByID(grant.Id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditGrantDelete, "grant", grant.Id, grant, nil)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "grant deleted"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/model"
+)
+
+func bookTitles(t *testing.T, s *server, authorization string) []string {
+	t.Helper()
+	r := newRequest("GET", "/books", "")
+	r.Header.Set("Authorization", authorization)
+	w := serve(s, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /books = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	var books []model.Book
+	if err := json.Unmarshal(w.Body.Bytes(), &books); err != nil {
+		t.Fatal(err)
+	}
+	titles := make([]string, 0, len(books))
+	for _, book := range books {
+		titles = append(titles, book.Title)
+	}
+	sort.Strings(titles)
+	return titles
+}
+
+func TestBookVisibility(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	reader := st.addUser("reader", dbmodel.UserRoleReader)
+	admin := st.addUser("admin", dbmodel.UserRoleAdministrator)
+	acme := st.tenants.add("acme", dbmodel.TenantStatusActive)
+
+	st.books.add(dbmodel.DefaultTenantId, "open")
+	thesis := st.books.add(dbmodel.DefaultTenantId, "thesis")
+	st.books.add(acme.Id, "other tenant")
+	st.acl.hidden[thesis.Id] = true
+
+	if got := bookTitles(t, s, bearer(t, s, reader)); len(got) != 1 || got[0] != "open" {
+		t.Errorf("reader sees %v, want [open]", got)
+	}
+	if len(st.acl.asked) != 1 || st.acl.asked[0] != reader.Id {
+		t.Errorf("hidden books were looked up for %v, want the reader", st.acl.asked)
+	}
+	if got := bookTitles(t, s, bearer(t, s, admin)); len(got) != 2 || got[0] != "open" || got[1] != "thesis" {
+		t.Errorf("acl manager sees %v, want [open thesis]", got)
+	}
+
+	r := newRequest("GET", "/books/"+thesis.Id, "")
+	r.Header.Set("Authorization", bearer(t, s, reader))
+	if w := serve(s, r); w.Code != http.StatusNotFound {
+		t.Errorf("download of a hidden book = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/rbac"
+)
+
+const (
+	apiKeyPrefix = "clk_"
+	// apiKeyTouchInterval limits last_used_at writes to one per key and
+	// interval, a busy integration would otherwise write on every request
+	apiKeyTouchInterval = time.Minute
+)
+
+var errInvalidAPIKey = errors.New("invalid api key")
+
+type apiKeyRequest struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type apiKey struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	Key        string     `json:"key,omitempty"`
+}
+
+func apiKeyFromDTO(dto dbmodel.APIKeyDTO) apiKey {
+	key := apiKey{
+		Id:        dto.Id,
+		Name:      dto.Name,
+		Prefix:    dto.Prefix,
+		Scopes:    dto.Scopes,
+		CreatedAt: dto.CreatedAt,
+	}
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+	if !dto.LastUsedAt.IsZero() {
+		key.LastUsedAt = &dto.LastUsedAt
+	}
+	if !dto.ExpiresAt.IsZero() {
+		key.ExpiresAt = &dto.ExpiresAt
+	}
+	return key
+}
+
+func (h *authHandler) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+	userID, _ := props["id"].(string)
+
+	h.respondWithAPIKeys(w, userID)
+}
+
+func (h *authHandler) getUserAPIKeys(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("user id is required"))
+		return
+	}
+
+	if _, err := userInTenant(h.storage, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("user with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respondWithAPIKeys(w, vars["id"])
+}
+
+func (h *authHandler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+	if _, ok := props["key"]; ok {
+		respondWithError(w, http.StatusForbidden, errors.New("api keys cannot be used to create api keys"))
+		return
+	}
+	userID, _ := props["id"].(string)
+
+	var req apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("api key name is required"))
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !rbac.ValidPattern(scope) {
+			respondWithError(w, http.StatusBadRequest, fmt.Errorf("unknown scope: %s", scope))
+			return
+		}
+	}
+	now := time.Now()
+	if !req.ExpiresAt.IsZero() && !req.ExpiresAt.After(now) {
+		respondWithError(w, http.StatusBadRequest, errors.New("api key expiry must be in the future"))
+		return
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	key := apiKeyPrefix + secret
+
+	dto := dbmodel.APIKeyDTO{
+		Id:        uuid.NewString(),
+		UserId:    userID,
+		Name:      req.Name,
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		Hash:      hashToken(key),
+		Scopes:    req.Scopes,
+		CreatedAt: now,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if _, err = h.apiKeys.CreateAPIKey(dto); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditAPIKeyCreate, "apikey", dto.Id, nil, apiKeyFromDTO(dto))
+
+	resp := apiKeyFromDTO(dto)
+	resp.Key = key
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, body)
+}
+
+func (h *authHandler) deleteAPIKeyByID(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("api key id is required"))
+		return
+	}
+
+	dto, err := h.apiKeys.GetAPIKeyByID(vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("api key with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if dto.UserId != props["id"] || dto.Revoked {
+		respondWithError(w, http.StatusNotFound, fmt.Errorf("api key with id: %s not found", vars["id"]))
+		return
+	}
+
+	if err = h.apiKeys.RevokeAPIKey(dto.Id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditAPIKeyRevoke, "apikey", dto.Id, apiKeyFromDTO(dto), nil)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "api key revoked"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) deleteUserAPIKeys(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("user id is required"))
+		return
+	}
+
+	if _, err := userInTenant(h.storage, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("user with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.apiKeys.RevokeAPIKeysByUserID(vars["id"]); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditAPIKeyRevoke, "user", vars["id"], nil, nil)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "api keys revoked"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) respondWithAPIKeys(w http.ResponseWriter, userID string) {
+	dtos, err := h.apiKeys.GetAPIKeysByUserID(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	keys := make([]apiKey, 0)
+	for _, dto := range dtos {
+		if dto.Revoked || (!dto.ExpiresAt.IsZero() && time.Now().After(dto.ExpiresAt)) {
+			continue
+		}
+		keys = append(keys, apiKeyFromDTO(dto))
+	}
+
+	body, err := json.Marshal(keys)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) apiKeyClaims(key string) (jwt.MapClaims, error) {
+	dto, err := h.apiKeys.GetAPIKeyByHash(hashToken(key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errInvalidAPIKey
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if dto.Revoked || (!dto.ExpiresAt.IsZero() && now.After(dto.ExpiresAt)) {
+		return nil, errInvalidAPIKey
+	}
+
+	user, err := h.storage.GetUserByID(dto.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errInvalidAPIKey
+		}
+		return nil, err
+	}
+	if user.Status != "" && user.Status != dbmodel.UserStatusActive {
+		return nil, errAccountInactive
+	}
+
+	claims, err := h.groupClaims(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	claims["id"] = user.Id
+	claims["username"] = user.Username
+	claims["role"] = user.Role
+	claims["tenant"] = user.TenantId
+	claims["authorized"] = true
+	claims["key"] = dto.Id
+	if len(dto.Scopes) > 0 {
+		claims["scopes"] = dto.Scopes
+	}
+
+	if now.Sub(dto.LastUsedAt) >= apiKeyTouchInterval {
+		if err = h.apiKeys.TouchAPIKey(dto.Id, now); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); strings.HasPrefix(token, apiKeyPrefix) {
+		return token
+	}
+	return ""
+}
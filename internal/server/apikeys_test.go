@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+func TestAPIKeyLastUsedWrites(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	alice := st.addUser("alice", dbmodel.UserRoleReader)
+	key := st.addAPIKey(alice)
+
+	use := func() {
+		t.Helper()
+		r := newRequest("GET", "/tags", "")
+		r.Header.Set("X-API-Key", key)
+		if w := serve(s, r); w.Code != http.StatusOK {
+			t.Fatalf("GET /tags = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		use()
+	}
+	if st.apiKeys.touches != 1 {
+		t.Errorf("last used was written %d times, want once per %s", st.apiKeys.touches, apiKeyTouchInterval)
+	}
+
+	for id, dto := range st.apiKeys.keys {
+		dto.LastUsedAt = dto.LastUsedAt.Add(-apiKeyTouchInterval)
+		st.apiKeys.keys[id] = dto
+	}
+	use()
+	if st.apiKeys.touches != 2 {
+		t.Errorf("last used was written %d times after %s, want 2", st.apiKeys.touches, apiKeyTouchInterval)
+	}
+}
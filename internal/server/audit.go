@@ -0,0 +1,249 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/google/uuid"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+const (
+	auditBookCreate       = "book.create"
+	auditBookUpdate       = "book.update"
+	auditBookDelete       = "book.delete"
+	auditBookImport       = "book.import"
+	auditBookACLUpdate    = "book.acl_update"
+	auditBookRestore      = "book.restore"
+	auditBookPurge        = "book.purge"
+	auditBookRevert       = "book.revert"
+	auditCollectionCreate = "collection.create"
+	auditCollectionUpdate = "collection.update"
+	auditCollectionDelete = "collection.delete"
+	auditGrantCreate      = "grant.create"
+	auditGrantDelete      = "grant.delete"
+	auditUserCreate       = "user.create"
+	auditUserRegister     = "user.register"
+	auditUserUpdate       = "user.update"
+	auditUserDelete       = "user.delete"
+	auditUserApprove      = "user.approve"
+	auditUserRestore      = "user.restore"
+	auditUserPurge        = "user.purge"
+	auditGroupCreate      = "group.create"
+	auditGroupUpdate      = "group.update"
+	auditGroupDelete      = "group.delete"
+	auditGroupMemberAdd   = "group.member_add"
+	auditGroupMemberDrop  = "group.member_remove"
+	auditTenantCreate     = "tenant.create"
+	auditTenantUpdate     = "tenant.update"
+	auditTenantDelete     = "tenant.delete"
+	auditAPIKeyCreate     = "apikey.create"
+	auditAPIKeyRevoke     = "apikey.revoke"
+	auditSignin           = "auth.signin"
+	auditSigninFailed     = "auth.signin_failed"
+	auditTwoFactorFailed  = "auth.2fa_failed"
+	auditTwoFactorReset   = "auth.2fa_reset"
+	auditPasswordReset    = "auth.password_reset"
+	auditUnlock           = "auth.unlock"
+)
+
+const defaultAuditLimit = 100
+
+var redactedAuditFields = []string{"password", "tokenVersion"}
+
+type auditChange struct {
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+type auditor struct {
+	storage  storage.Audit
+	throttle *throttle
+}
+
+func newAuditor(a storage.Audit, t *throttle) *auditor {
+	return &auditor{
+		storage:  a,
+		throttle: t,
+	}
+}
+
+func (a *auditor) record(r *http.Request, action, targetType, targetID string, before, after interface{}) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+	actorID, _ := props["id"].(string)
+	actorName, _ := props["username"].(string)
+	a.write(a.throttle.clientIP(r), tenantFromRequest(r), actorID, actorName, action, targetType, targetID, before, after)
+}
+
+func (a *auditor) security(r *http.Request, tenantID, username, userID, action string) {
+	a.write(a.throttle.clientIP(r), tenantID, userID, username, action, "user", userID, nil, nil)
+}
+
+func (a *auditor) system(tenantID, action, targetType, targetID string, before interface{}) {
+	a.write("", tenantID, "", "system", action, targetType, targetID, before, nil)
+}
+
+func (a *auditor) write(ip, tenantID, actorID, actorName, action, targetType, targetID string, before, after interface{}) {
+	changes, err := auditDiff(before, after)
+	if err != nil {
+		log.Printf("unable to record audit event %s: %v", action, err)
+		return
+	}
+
+	dto := dbmodel.AuditEventDTO{
+		Id:         uuid.NewString(),
+		TenantId:   tenantID,
+		ActorId:    actorID,
+		ActorName:  actorName,
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   targetID,
+		Changes:    changes,
+		Ip:         ip,
+		CreatedAt:  time.Now(),
+	}
+	if err = a.storage.CreateAuditEvent(dto); err != nil {
+		log.Printf("unable to record audit event %s: %v", action, err)
+	}
+}
+
+func auditDiff(before, after interface{}) (json.RawMessage, error) {
+	oldFields, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]auditChange)
+	for key, value := range oldFields {
+		if !reflect.DeepEqual(value, newFields[key]) {
+			changes[key] = auditChange{Before: value, After: newFields[key]}
+		}
+	}
+	for key, value := range newFields {
+		if _, ok := oldFields[key]; !ok {
+			changes[key] = auditChange{After: value}
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(changes)
+}
+
+func auditFields(v interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	if v == nil {
+		return fields, nil
+	}
+
+	content, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &fields); err != nil {
+		return nil, err
+	}
+	for _, key := range redactedAuditFields {
+		delete(fields, key)
+	}
+	return fields, nil
+}
+
+type auditHandler struct {
+	storage storage.Audit
+}
+
+func newAuditHandler(a storage.Audit) *auditHandler {
+	return &auditHandler{
+		storage: a,
+	}
+}
+
+func (h *auditHandler) getAuditEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilterFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditLimit
+	}
+
+	dtos, err := h.storage.GetAuditEvents(filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	body, err := json.Marshal(dtos)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *auditHandler) exportAuditEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilterFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	dtos, err := h.storage.GetAuditEvents(filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"audit.jsonl\"")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	for _, dto := range dtos {
+		if err := encoder.Encode(dto); err != nil {
+			return
+		}
+	}
+}
+
+func auditFilterFromRequest(r *http.Request) (dbmodel.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := dbmodel.AuditFilter{
+		TenantId:   tenantFromRequest(r),
+		ActorId:    query.Get("actorId"),
+		Action:     query.Get("action"),
+		TargetType: query.Get("targetType"),
+		TargetId:   query.Get("targetId"),
+	}
+
+	var err error
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return dbmodel.AuditFilter{}, fmt.Errorf("invalid from timestamp, %w", err)
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return dbmodel.AuditFilter{}, fmt.Errorf("invalid to timestamp, %w", err)
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+			return dbmodel.AuditFilter{}, fmt.Errorf("invalid limit: %s", limit)
+		}
+	}
+	return filter, nil
+}
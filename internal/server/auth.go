@@ -1,36 +1,92 @@
 package server
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/google/uuid"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/mail"
+	"github.com/szwedm/cloud-library/internal/password"
+	"github.com/szwedm/cloud-library/internal/signing"
 	"github.com/szwedm/cloud-library/internal/storage"
-	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	errInvalidPassword    = errors.New("invalid password")
+	errTokenRevoked       = errors.New("token has been revoked")
+	errUsernameTaken      = errors.New("username already exists")
+	errWrongTokenType     = errors.New("token cannot be used for this request")
+	errInvalidCredentials = errors.New("invalid username or password")
+	errAccountInactive    = errors.New("account is not active")
+)
+
+const (
+	tokenTypeChallenge  = "2fa-challenge"
+	tokenTypeEnrollment = "2fa-enrollment"
+	// tokenTypeAPIKey is never issued as a JWT, it only marks routes that accept API keys
+	tokenTypeAPIKey = "api-key"
 )
 
 type authentication struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Device   string `json:"device"`
 }
 
 type token struct {
-	Id       string `json:"id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
-	Token    string `json:"token"`
+	Id           string `json:"id"`
+	Username     string `json:"username"`
+	Role         string `json:"role"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	SessionId    string `json:"sessionId"`
 }
 
 type authHandler struct {
-	storage storage.Users
+	storage        storage.Users
+	sessions       storage.Sessions
+	identities     storage.Identities
+	groups         storage.Groups
+	apiKeys        storage.APIKeys
+	twoFactor      storage.TwoFactor
+	throttle       *throttle
+	resets         storage.PasswordResets
+	mailer         mail.Mailer
+	mails          *mailQueue
+	keyring        *signing.Keyring
+	authenticators []authenticator
+	provider       identityProvider
+	hasher         *password.Hasher
+	passwords      *password.Policy
+	tenants        *tenantResolver
+	audit          *auditor
 }
 
-func newAuthHandler(u storage.Users) *authHandler {
+func newAuthHandler(u storage.Users, s storage.Sessions, i storage.Identities, g storage.Groups, ak storage.APIKeys, f storage.TwoFactor, t *throttle, pr storage.PasswordResets, m mail.Mailer, k *signing.Keyring, p identityProvider, ph *password.Hasher, pp *password.Policy, tr *tenantResolver, au *auditor) *authHandler {
 	return &authHandler{
-		storage: u,
+		storage:        u,
+		sessions:       s,
+		identities:     i,
+		groups:         g,
+		apiKeys:        ak,
+		twoFactor:      f,
+		throttle:       t,
+		resets:         pr,
+		mailer:         m,
+		mails:          newMailQueue(mailQueueSize, mailWorkers),
+		keyring:        k,
+		authenticators: newAuthenticators(u, i, ph),
+		provider:       p,
+		hasher:         ph,
+		passwords:      pp,
+		tenants:        tr,
+		audit:          au,
 	}
 }
 
@@ -43,32 +99,89 @@ func (h *authHandler) signin(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	dto, err := h.storage.GetUserByUsername(authDetails.Username)
+	tenant, err := h.tenants.active(r)
+	if err != nil {
+		respondWithTenantError(w, err)
+		return
+	}
+
+	keys := h.throttle.keys(r, tenant.Id, authDetails.Username)
+	if err := h.throttle.attempt(keys...); err != nil {
+		respondWithThrottled(w, err)
+		return
+	}
+
+	dto, err := h.authenticate(tenant.Id, authDetails.Username, authDetails.Password)
+	if err == nil && dto.TenantId != tenant.Id {
+		err = errInvalidPassword
+	}
 	if err != nil {
-		if _, ok := err.(*storage.UserNotFoundErr); ok {
-			respondWithError(w, http.StatusNotFound, fmt.Errorf("user %s not found", authDetails.Username))
+		if _, ok := err.(*storage.UserNotFoundErr); ok || errors.Is(err, errInvalidPassword) {
+			h.audit.security(r, tenant.Id, authDetails.Username, "", auditSigninFailed)
+			if err = h.throttle.fail(keys...); err != nil {
+				respondWithError(w, http.StatusInternalServerError, err)
+				return
+			}
+			respondWithError(w, http.StatusUnauthorized, errInvalidCredentials)
 			return
 		}
+		if errors.Is(err, errAccountInactive) {
+			respondWithError(w, http.StatusForbidden, err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	device := authDetails.Device
+	if device == "" {
+		device = r.UserAgent()
+	}
+
+	// the password was right, a second factor is throttled on its own
+	if err = h.throttle.forgive(keys...); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if h.challengeTwoFactor(w, dto, device) {
+		return
+	}
+
+	if err = h.throttle.succeed(usernameKey(tenant.Id, authDetails.Username)); err != nil {
 		respondWithError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	if err = bcrypt.CompareHashAndPassword([]byte(dto.Password), []byte(authDetails.Password)); err != nil {
-		respondWithError(w, http.StatusUnauthorized, err)
+	sessionID, err := h.createSession(dto.Id, device)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
 		return
 	}
+	h.audit.security(r, dto.TenantId, dto.Username, dto.Id, auditSignin)
 
-	validToken, err := h.generateJWT(dto.Id, dto.Username, dto.Role)
+	h.respondWithTokens(w, http.StatusCreated, dto, sessionID)
+}
+
+func (h *authHandler) respondWithTokens(w http.ResponseWriter, code int, dto dbmodel.UserDTO, sessionID string) {
+	refreshToken, err := h.generateRefreshToken(sessionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	validToken, err := h.generateJWT(dto, sessionID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	token := token{
-		Id:       dto.Id,
-		Username: dto.Username,
-		Role:     dto.Role,
-		Token:    validToken,
+		Id:           dto.Id,
+		Username:     dto.Username,
+		Role:         dto.Role,
+		Token:        validToken,
+		RefreshToken: refreshToken,
+		SessionId:    sessionID,
 	}
 
 	body, err := json.Marshal(token)
@@ -77,19 +190,58 @@ func (h *authHandler) signin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, body)
+	respondWithJSON(w, code, body)
 }
 
-func (h *authHandler) generateJWT(id, username, role string) (string, error) {
-	signingKey := []byte(os.Getenv("APP_JWT_SIGN_KEY"))
-	token := jwt.New(jwt.SigningMethodHS256)
+func (h *authHandler) generateJWT(dto dbmodel.UserDTO, sessionID string) (string, error) {
+	claims, err := h.groupClaims(dto.Id)
+	if err != nil {
+		return "", fmt.Errorf("unable to sign JWT: %w", err)
+	}
+	claims["sid"] = sessionID
+	return h.signToken(dto, time.Minute*30, claims)
+}
+
+func (h *authHandler) groupClaims(userID string) (jwt.MapClaims, error) {
+	dtos, err := h.groups.GetGroupsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]string, 0, len(dtos))
+	roles := make([]string, 0)
+	for _, dto := range dtos {
+		groups = append(groups, dto.Id)
+		if dto.Role != "" && !containsString(roles, dto.Role) {
+			roles = append(roles, dto.Role)
+		}
+	}
+	return jwt.MapClaims{"groups": groups, "groupRoles": roles}, nil
+}
+
+func (h *authHandler) signToken(dto dbmodel.UserDTO, ttl time.Duration, extra jwt.MapClaims) (string, error) {
+	kid, method, signingKey, err := h.keyring.SigningKey()
+	if err != nil {
+		return "", fmt.Errorf("unable to sign JWT: %w", err)
+	}
+
+	token := jwt.New(method)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
 	claims := token.Claims.(jwt.MapClaims)
 
-	claims["id"] = id
-	claims["username"] = username
-	claims["role"] = role
+	claims["jti"] = uuid.NewString()
+	claims["id"] = dto.Id
+	claims["username"] = dto.Username
+	claims["role"] = dto.Role
+	claims["tenant"] = dto.TenantId
+	claims["ver"] = dto.TokenVersion
 	claims["authorized"] = true
-	claims["exp"] = time.Now().Add(time.Minute * 30).Unix()
+	claims["exp"] = time.Now().Add(ttl).Unix()
+	for k, v := range extra {
+		claims[k] = v
+	}
 
 	tokenString, err := token.SignedString(signingKey)
 	if err != nil {
@@ -97,3 +249,104 @@ func (h *authHandler) generateJWT(id, username, role string) (string, error) {
 	}
 	return tokenString, nil
 }
+
+func (h *authHandler) getJWKS(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(h.keyring.JWKS())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) signout(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+
+	if jti, ok := props["jti"].(string); ok {
+		expiresAt := time.Now().Add(time.Minute * 30)
+		if exp, ok := props["exp"].(float64); ok {
+			expiresAt = time.Unix(int64(exp), 0)
+		}
+		if err := h.sessions.RevokeToken(jti, expiresAt); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if sessionID, ok := props["sid"].(string); ok && sessionID != "" {
+		session, err := h.sessions.GetSessionByID(sessionID)
+		if err != nil && err != sql.ErrNoRows {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err == nil {
+			session.Revoked = true
+			if err = h.sessions.UpdateSession(session); err != nil {
+				respondWithError(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+	}
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "signed out"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) validateClaims(claims jwt.MapClaims) error {
+	if jti, ok := claims["jti"].(string); ok {
+		revoked, err := h.sessions.IsTokenRevoked(jti)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return errTokenRevoked
+		}
+	}
+
+	userID, _ := claims["id"].(string)
+	dto, err := h.storage.GetUserByID(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errTokenRevoked
+		}
+		return err
+	}
+	if version, _ := claims["ver"].(float64); int(version) != dto.TokenVersion {
+		return errTokenRevoked
+	}
+
+	if sessionID, ok := claims["sid"].(string); ok && sessionID != "" {
+		session, err := h.sessions.GetSessionByID(sessionID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == sql.ErrNoRows || session.Revoked {
+			return errTokenRevoked
+		}
+	}
+
+	groups, err := h.groupClaims(dto.Id)
+	if err != nil {
+		return err
+	}
+	for k, v := range groups {
+		claims[k] = v
+	}
+
+	claims["username"] = dto.Username
+	claims["role"] = dto.Role
+	claims["tenant"] = dto.TenantId
+	return nil
+}
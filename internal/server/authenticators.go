@@ -0,0 +1,280 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/ldap"
+	"github.com/szwedm/cloud-library/internal/model"
+	"github.com/szwedm/cloud-library/internal/password"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+type authenticator interface {
+	authenticate(tenantID, username, password string) (dbmodel.UserDTO, error)
+}
+
+type localAuthenticator struct {
+	storage   storage.Users
+	hasher    *password.Hasher
+	dummyOnce sync.Once
+	dummyHash string
+}
+
+func (a *localAuthenticator) authenticate(tenantID, username, secret string) (dbmodel.UserDTO, error) {
+	dto, err := a.storage.GetUserByUsername(tenantID, username)
+	if err != nil {
+		if _, ok := err.(*storage.UserNotFoundErr); ok {
+			a.hasher.Compare(a.dummy(), secret)
+		}
+		return dbmodel.UserDTO{}, err
+	}
+
+	if err = a.hasher.Compare(dto.Password, secret); err != nil {
+		return dbmodel.UserDTO{}, fmt.Errorf("%w: %v", errInvalidPassword, err)
+	}
+
+	if a.hasher.NeedsRehash(dto.Password) {
+		if hashedPassword, err := a.hasher.Hash(secret); err != nil {
+			log.Printf("unable to rehash password for %s: %v", dto.Username, err)
+		} else {
+			dto.Password = hashedPassword
+			if err = a.storage.UpdateUser(dto); err != nil {
+				log.Printf("unable to store rehashed password for %s: %v", dto.Username, err)
+			}
+		}
+	}
+	return dto, nil
+}
+
+func (a *localAuthenticator) dummy() string {
+	a.dummyOnce.Do(func() {
+		a.dummyHash, _ = a.hasher.Hash("cloud-library")
+	})
+	return a.dummyHash
+}
+
+// ldapIssuer marks the identities of accounts provisioned from the
+// directory, only those are signed in with directory credentials.
+const ldapIssuer = "ldap"
+
+type ldapDirectory interface {
+	Authenticate(username, password string) (ldap.Entry, error)
+}
+
+type ldapAuthenticator struct {
+	directory    ldapDirectory
+	storage      storage.Users
+	identities   storage.Identities
+	hasher       *password.Hasher
+	adminGroups  []string
+	readerGroups []string
+}
+
+func newLDAPAuthenticator(d ldapDirectory, u storage.Users, i storage.Identities, h *password.Hasher) *ldapAuthenticator {
+	return &ldapAuthenticator{
+		directory:    d,
+		storage:      u,
+		identities:   i,
+		hasher:       h,
+		adminGroups:  splitList(os.Getenv("APP_LDAP_ADMIN_GROUPS")),
+		readerGroups: splitList(os.Getenv("APP_LDAP_READER_GROUPS")),
+	}
+}
+
+func (a *ldapAuthenticator) authenticate(tenantID, username, password string) (dbmodel.UserDTO, error) {
+	entry, err := a.directory.Authenticate(username, password)
+	if err != nil {
+		if errors.Is(err, ldap.ErrUserNotFound) {
+			return dbmodel.UserDTO{}, &storage.UserNotFoundErr{}
+		}
+		if errors.Is(err, ldap.ErrInvalidCredentials) {
+			return dbmodel.UserDTO{}, fmt.Errorf("%w: %v", errInvalidPassword, err)
+		}
+		return dbmodel.UserDTO{}, err
+	}
+
+	role := a.role(entry.Groups)
+	if role == "" {
+		return dbmodel.UserDTO{}, fmt.Errorf("%w: %s is not a member of any permitted group", errInvalidPassword, entry.Username)
+	}
+
+	subject := tenantID + ":" + entry.DN
+	identity, err := a.identities.GetIdentity(ldapIssuer, subject)
+	if err == sql.ErrNoRows {
+		return a.provision(tenantID, subject, entry.Username, role)
+	}
+	if err != nil {
+		return dbmodel.UserDTO{}, err
+	}
+
+	dto, err := a.storage.GetUserByID(identity.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return dbmodel.UserDTO{}, &storage.UserNotFoundErr{}
+		}
+		return dbmodel.UserDTO{}, err
+	}
+
+	if dto.Role != role {
+		dto.Role = role
+		dto.TokenVersion++
+		if err = a.storage.UpdateUser(dto); err != nil {
+			return dbmodel.UserDTO{}, err
+		}
+	}
+	return dto, nil
+}
+
+// provision creates the account of a directory user signing in for the
+// first time. A local account with the same name is left alone, it keeps
+// signing in with its own password.
+func (a *ldapAuthenticator) provision(tenantID, subject, username, role string) (dbmodel.UserDTO, error) {
+	if _, err := a.storage.GetUserByUsername(tenantID, username); err == nil {
+		return dbmodel.UserDTO{}, &storage.UserNotFoundErr{}
+	} else if _, ok := err.(*storage.UserNotFoundErr); !ok {
+		return dbmodel.UserDTO{}, err
+	}
+
+	hashedPassword, err := unusablePassword(a.hasher)
+	if err != nil {
+		return dbmodel.UserDTO{}, err
+	}
+	dto := dbmodel.UserDTO{
+		Id:       uuid.NewString(),
+		Username: username,
+		Password: hashedPassword,
+		Role:     role,
+		Status:   dbmodel.UserStatusActive,
+		TenantId: tenantID,
+	}
+	if _, err = a.storage.CreateUser(dto); err != nil {
+		return dbmodel.UserDTO{}, err
+	}
+
+	identity := dbmodel.IdentityDTO{
+		Id:        uuid.NewString(),
+		UserId:    dto.Id,
+		Issuer:    ldapIssuer,
+		Subject:   subject,
+		CreatedAt: time.Now(),
+	}
+	if _, err = a.identities.CreateIdentity(identity); err != nil {
+		return dbmodel.UserDTO{}, err
+	}
+	return dto, nil
+}
+
+func (a *ldapAuthenticator) role(groups []string) string {
+	if matchGroup(groups, a.adminGroups) {
+		return model.UserRoleAdministrator
+	}
+	if len(a.readerGroups) == 0 || matchGroup(groups, a.readerGroups) {
+		return model.UserRoleReader
+	}
+	return ""
+}
+
+func newAuthenticators(u storage.Users, i storage.Identities, h *password.Hasher) []authenticator {
+	authenticators := make([]authenticator, 0)
+
+	directory := ldap.NewDirectory(ldap.Config{
+		URL:            os.Getenv("APP_LDAP_URL"),
+		BindDN:         os.Getenv("APP_LDAP_BIND_DN"),
+		BindPassword:   os.Getenv("APP_LDAP_BIND_PASSWORD"),
+		BaseDN:         os.Getenv("APP_LDAP_BASE_DN"),
+		UserFilter:     os.Getenv("APP_LDAP_USER_FILTER"),
+		UserAttribute:  os.Getenv("APP_LDAP_USER_ATTRIBUTE"),
+		GroupAttribute: os.Getenv("APP_LDAP_GROUP_ATTRIBUTE"),
+		StartTLS:       os.Getenv("APP_LDAP_START_TLS") == "true",
+		SkipVerify:     os.Getenv("APP_LDAP_SKIP_VERIFY") == "true",
+	})
+	if directory.Enabled() {
+		authenticators = append(authenticators, newLDAPAuthenticator(directory, u, i, h))
+	}
+
+	if os.Getenv("APP_LOCAL_AUTH") != "false" {
+		authenticators = append(authenticators, &localAuthenticator{storage: u, hasher: h})
+	}
+	return authenticators
+}
+
+// authenticate asks every backend in turn. A wrong password in one of them
+// does not stop the others, the same name may belong to a directory user
+// and to a local account.
+func (h *authHandler) authenticate(tenantID, username, password string) (dbmodel.UserDTO, error) {
+	var lastErr, invalidErr error
+	for _, a := range h.authenticators {
+		dto, err := a.authenticate(tenantID, username, password)
+		if err == nil {
+			if dto.Status != "" && dto.Status != dbmodel.UserStatusActive {
+				return dbmodel.UserDTO{}, fmt.Errorf("%w: %s", errAccountInactive, strings.ReplaceAll(dto.Status, "_", " "))
+			}
+			return dto, nil
+		}
+		if _, ok := err.(*storage.UserNotFoundErr); ok {
+			continue
+		}
+		if errors.Is(err, errInvalidPassword) {
+			invalidErr = err
+			continue
+		}
+		log.Printf("authentication backend failed for %s: %v", username, err)
+		lastErr = err
+	}
+
+	if invalidErr != nil {
+		return dbmodel.UserDTO{}, invalidErr
+	}
+	if lastErr != nil {
+		return dbmodel.UserDTO{}, lastErr
+	}
+	return dbmodel.UserDTO{}, &storage.UserNotFoundErr{}
+}
+
+func unusablePassword(h *password.Hasher) (string, error) {
+	buff := make([]byte, 32)
+	if _, err := rand.Read(buff); err != nil {
+		return "", err
+	}
+	return h.Hash(base64.RawURLEncoding.EncodeToString(buff))
+}
+
+func matchGroup(groups, allowed []string) bool {
+	for _, group := range groups {
+		for _, a := range allowed {
+			if strings.EqualFold(group, a) || strings.EqualFold(groupCN(group), a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func groupCN(dn string) string {
+	first := strings.SplitN(dn, ",", 2)[0]
+	if parts := strings.SplitN(first, "=", 2); len(parts) == 2 && strings.EqualFold(strings.TrimSpace(parts[0]), "cn") {
+		return strings.TrimSpace(parts[1])
+	}
+	return dn
+}
+
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/ldap"
+)
+
+type directoryUser struct {
+	password string
+	groups   []string
+}
+
+type fakeDirectory map[string]directoryUser
+
+func (f fakeDirectory) Authenticate(username, password string) (ldap.Entry, error) {
+	user, ok := f[username]
+	if !ok {
+		return ldap.Entry{}, ldap.ErrUserNotFound
+	}
+	if user.password != password {
+		return ldap.Entry{}, ldap.ErrInvalidCredentials
+	}
+	return ldap.Entry{DN: "uid=" + username + ",dc=example,dc=com", Username: username, Groups: user.groups}, nil
+}
+
+func TestLDAPAuthenticator(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	directory := fakeDirectory{
+		"carol": {password: "Directory-carol-9", groups: []string{"admins"}},
+		"bob":   {password: "Directory-bob-9", groups: []string{"admins"}},
+	}
+	ldapAuth := newLDAPAuthenticator(directory, st.users, st.identities, s.authHandler.hasher)
+	ldapAuth.adminGroups = []string{"admins"}
+	s.authHandler.authenticators = []authenticator{ldapAuth, &localAuthenticator{storage: st.users, hasher: s.authHandler.hasher}}
+
+	bob := st.addUser("bob", dbmodel.UserRoleReader)
+	st.setPassword(t, s, bob, "Local-bob-battery-9")
+	dave := st.addUser("dave", dbmodel.UserRoleReader)
+	st.setPassword(t, s, dave, "Local-dave-battery-9")
+
+	tests := []struct {
+		name     string
+		username string
+		secret   string
+		want     int
+	}{
+		{name: "directory user is provisioned", username: "carol", secret: "Directory-carol-9", want: http.StatusCreated},
+		{name: "directory user signs in again", username: "carol", secret: "Directory-carol-9", want: http.StatusCreated},
+		{name: "directory password of a local account", username: "bob", secret: "Directory-bob-9", want: http.StatusUnauthorized},
+		{name: "local password of a name in the directory", username: "bob", secret: "Local-bob-battery-9", want: http.StatusCreated},
+		{name: "local account missing from the directory", username: "dave", secret: "Local-dave-battery-9", want: http.StatusCreated},
+		{name: "wrong password", username: "carol", secret: "Local-bob-battery-9", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the throttle is covered elsewhere, every case starts unthrottled
+			st.loginAttempts.attempts = map[string]dbmodel.LoginAttemptDTO{}
+			if w := serve(s, signinRequest(tt.username, tt.secret)); w.Code != tt.want {
+				t.Errorf("signin = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	if dto, _ := st.users.GetUserByID(bob.Id); dto.Role != dbmodel.UserRoleReader || dto.TokenVersion != bob.TokenVersion {
+		t.Errorf("local account was changed by a directory sign-in: role %s, token version %d", dto.Role, dto.TokenVersion)
+	}
+	carol, err := st.users.GetUserByUsername(dbmodel.DefaultTenantId, "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if carol.Role != dbmodel.UserRoleAdministrator {
+		t.Errorf("provisioned role = %s, want %s", carol.Role, dbmodel.UserRoleAdministrator)
+	}
+	if identities, _ := st.identities.GetIdentitiesByUserID(carol.Id); len(identities) != 1 || identities[0].Issuer != ldapIssuer {
+		t.Errorf("identities of the provisioned account = %v, want one %s identity", identities, ldapIssuer)
+	}
+}
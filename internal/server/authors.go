@@ -0,0 +1,133 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/model"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+type mergeRequest struct {
+	Ids []string `json:"ids"`
+}
+
+type authorsHandler struct {
+	storage storage.Authors
+}
+
+func newAuthorsHandler(a storage.Authors) *authorsHandler {
+	return &authorsHandler{
+		storage: a,
+	}
+}
+
+func (h *authorsHandler) getAuthors(w http.ResponseWriter, r *http.Request) {
+	dtos, err := h.storage.GetAuthors(tenantFromRequest(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	authors := make([]model.Author, 0)
+	for _, dto := range dtos {
+		authors = append(authors, model.AuthorFromDTO(dto))
+	}
+
+	body, err := json.Marshal(authors)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authorsHandler) getAuthorByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("author id is required"))
+		return
+	}
+
+	dto, err := authorInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("author with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	body, err := json.Marshal(model.AuthorFromDTO(dto))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authorsHandler) mergeAuthors(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("author id is required"))
+		return
+	}
+
+	var merge mergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&merge); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	sourceIDs := make([]string, 0)
+	for _, id := range merge.Ids {
+		if id == vars["id"] {
+			continue
+		}
+		if _, err := authorInTenant(h.storage, r, id); err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusNotFound, fmt.Errorf("author with id: %s not found, %w", id, err))
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		sourceIDs = append(sourceIDs, id)
+	}
+
+	if _, err := authorInTenant(h.storage, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("author with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.storage.MergeAuthors(tenantFromRequest(r), vars["id"], sourceIDs); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "authors merged"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
@@ -0,0 +1,305 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/model"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+type collectionsHandler struct {
+	storage storage.Collections
+	books   storage.Books
+	audit   *auditor
+}
+
+func newCollectionsHandler(c storage.Collections, b storage.Books, au *auditor) *collectionsHandler {
+	return &collectionsHandler{
+		storage: c,
+		books:   b,
+		audit:   au,
+	}
+}
+
+func (h *collectionsHandler) getCollections(w http.ResponseWriter, r *http.Request) {
+	dtos, err := h.storage.GetCollections(tenantFromRequest(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	collections := make([]model.Collection, 0)
+	for _, dto := range dtos {
+		collections = append(collections, model.CollectionFromDTO(dto))
+	}
+
+	body, err := json.Marshal(collections)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *collectionsHandler) getCollectionByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("collection id is required"))
+		return
+	}
+
+	dto, err := collectionInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("collection with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	body, err := json.Marshal(model.CollectionFromDTO(dto))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *collectionsHandler) createCollection(w http.ResponseWriter, r *http.Request) {
+	var collection model.Collection
+	if err := json.NewDecoder(r.Body).Decode(&collection); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	collection.Name = strings.TrimSpace(collection.Name)
+	if collection.Name == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("collection name is required"))
+		return
+	}
+
+	collection.Id = uuid.NewString()
+	collection.TenantId = tenantFromRequest(r)
+	id, err := h.storage.CreateCollection(model.DTOFromCollection(collection))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditCollectionCreate, "collection", id, nil, collection)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "collection created with id: " + id}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, body)
+}
+
+func (h *collectionsHandler) updateCollection(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("collection id is required"))
+		return
+	}
+
+	var req struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Restricted  *bool  `json:"restricted"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	dto, err := collectionInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("collection with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	before := model.CollectionFromDTO(dto)
+	if name := strings.TrimSpace(req.Name); name != "" {
+		dto.Name = name
+	}
+	if req.Description != "" {
+		dto.Description = req.Description
+	}
+	if req.Restricted != nil {
+		dto.Restricted = *req.Restricted
+	}
+
+	if err = h.storage.UpdateCollection(dto); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditCollectionUpdate, "collection", dto.Id, before, model.CollectionFromDTO(dto))
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "collection updated"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *collectionsHandler) deleteCollectionByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("collection id is required"))
+		return
+	}
+
+	dto, err := collectionInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("collection with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err = h.storage.DeleteCollectionByID(dto.Id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditCollectionDelete, "collection", dto.Id, model.CollectionFromDTO(dto), nil)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "collection deleted"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *collectionsHandler) addCollectionBooks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("collection id is required"))
+		return
+	}
+
+	var req mergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	if len(req.Ids) == 0 {
+		respondWithError(w, http.StatusBadRequest, errors.New("at least one book id is required"))
+		return
+	}
+
+	if _, err := collectionInTenant(h.storage, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("collection with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for _, id := range req.Ids {
+		if _, err := bookInTenant(h.books, r, id); err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusBadRequest, fmt.Errorf("book with id: %s not found, %w", id, err))
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if err := h.storage.AddBooksToCollection(vars["id"], req.Ids); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "books added to collection"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *collectionsHandler) removeCollectionBook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" || vars["bookId"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("collection id and book id are required"))
+		return
+	}
+
+	if _, err := collectionInTenant(h.storage, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("collection with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.storage.RemoveBookFromCollection(vars["id"], vars["bookId"]); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "book removed from collection"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
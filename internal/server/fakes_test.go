@@ -0,0 +1,820 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/mail"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+// The fakes below keep just enough state in memory to drive the handlers
+// through the router. Each one embeds its storage interface, so a handler
+// reaching for a method that is not faked panics instead of passing silently.
+
+type fakeStorage struct {
+	users    *fakeUsers
+	sessions *fakeSessions
+	apiKeys  *fakeAPIKeys
+	groups   *fakeGroups
+	tenants  *fakeTenants
+	tags     *fakeTags
+	audit    *fakeAudit
+
+	verifications *fakeEmailVerifications
+	loginAttempts *fakeLoginAttempts
+	twoFactor     *fakeTwoFactor
+	books         *fakeBooks
+	authors       *fakeAuthors
+	subjects      *fakeSubjects
+	acl           *fakeACL
+	identities    *fakeIdentities
+	resets        *fakePasswordResets
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{
+		users:    &fakeUsers{users: map[string]dbmodel.UserDTO{}},
+		sessions: &fakeSessions{sessions: map[string]dbmodel.SessionDTO{}, refreshTokens: map[string]dbmodel.RefreshTokenDTO{}, revoked: map[string]time.Time{}},
+		apiKeys:  &fakeAPIKeys{keys: map[string]dbmodel.APIKeyDTO{}},
+		groups:   &fakeGroups{groups: map[string]dbmodel.GroupDTO{}, members: map[string][]dbmodel.UserDTO{}},
+		tenants:  &fakeTenants{tenants: map[string]dbmodel.TenantDTO{}},
+		tags:     &fakeTags{},
+		audit:    &fakeAudit{},
+
+		verifications: &fakeEmailVerifications{verifications: map[string]dbmodel.EmailVerificationDTO{}},
+		loginAttempts: &fakeLoginAttempts{attempts: map[string]dbmodel.LoginAttemptDTO{}},
+		twoFactor:     &fakeTwoFactor{},
+		books:         &fakeBooks{books: map[string]dbmodel.BookDTO{}},
+		authors:       &fakeAuthors{},
+		subjects:      &fakeSubjects{},
+		acl:           &fakeACL{hidden: map[string]bool{}},
+		resets:        &fakePasswordResets{resets: map[string]dbmodel.PasswordResetDTO{}},
+		identities:    &fakeIdentities{identities: map[string]dbmodel.IdentityDTO{}, states: map[string]dbmodel.LoginStateDTO{}},
+	}
+}
+
+func newTestServer(t *testing.T, st *fakeStorage) *server {
+	t.Helper()
+	t.Setenv("APP_JWT_SIGN_ALG", "HS256")
+	t.Setenv("APP_JWT_SIGN_KEY", "test-signing-key")
+	t.Setenv("APP_MAIL_TRANSPORT", "log")
+	t.Setenv("APP_PASSWORD_HASH", "bcrypt")
+	t.Setenv("APP_BCRYPT_COST", "4")
+
+	s := NewServer(st.books, st.authors, st.subjects, st.tags, nil, st.users, st.sessions, nil, st.identities, st.twoFactor, st.loginAttempts, st.resets, st.verifications, nil, st.acl, st.groups, st.apiKeys, st.tenants, st.audit, nil)
+	s.registerBookPaths()
+	s.registerAuthorPaths()
+	s.registerSubjectPaths()
+	s.registerTagPaths()
+	s.registerCollectionPaths()
+	s.registerOPDSPaths()
+	s.registerUserPaths()
+	s.registerGroupPaths()
+	s.registerTenantPaths()
+	s.registerAuthPaths()
+	return s
+}
+
+func serve(s *server, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	return w
+}
+
+func newRequest(method, target, body string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.RemoteAddr = "192.0.2.1:1234"
+	return r
+}
+
+func (st *fakeStorage) addUser(username, role string) dbmodel.UserDTO {
+	return st.addTenantUser(dbmodel.DefaultTenantId, username, role)
+}
+
+func (st *fakeStorage) addTenantUser(tenantID, username, role string) dbmodel.UserDTO {
+	dto := dbmodel.UserDTO{
+		Id:       uuid.NewString(),
+		Username: username,
+		Role:     role,
+		Status:   dbmodel.UserStatusActive,
+		TenantId: tenantID,
+	}
+	st.users.CreateUser(dto)
+	return dto
+}
+
+// setPassword stores a hash of secret for dto, cheap enough for tests.
+func (st *fakeStorage) setPassword(t *testing.T, s *server, dto dbmodel.UserDTO, secret string) {
+	t.Helper()
+	hashed, err := s.authHandler.hasher.Hash(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dto.Password = hashed
+	st.users.UpdateUser(dto)
+}
+
+// bearer signs an access token for a fresh session of dto.
+func bearer(t *testing.T, s *server, dto dbmodel.UserDTO) string {
+	t.Helper()
+	token, _ := signIn(t, s, dto)
+	return token
+}
+
+// signIn opens a session for dto and returns its bearer and refresh tokens.
+func signIn(t *testing.T, s *server, dto dbmodel.UserDTO) (string, string) {
+	t.Helper()
+	sessionID, err := s.authHandler.createSession(dto.Id, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.authHandler.generateJWT(dto, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, err := s.authHandler.generateRefreshToken(sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + token, refreshToken
+}
+
+// addAPIKey stores a key for dto and returns the raw key.
+func (st *fakeStorage) addAPIKey(dto dbmodel.UserDTO, scopes ...string) string {
+	key := apiKeyPrefix + uuid.NewString()
+	st.apiKeys.CreateAPIKey(dbmodel.APIKeyDTO{
+		Id:        uuid.NewString(),
+		UserId:    dto.Id,
+		Name:      "test",
+		Hash:      hashToken(key),
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	})
+	return key
+}
+
+// fakeMailer keeps sent messages, tokens are the last line of the body.
+type fakeMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (f *fakeMailer) Send(msg mail.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, msg)
+	return nil
+}
+
+func (f *fakeMailer) last(t *testing.T) (mail.Message, string) {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.messages) == 0 {
+		t.Fatal("no mail has been sent")
+	}
+	msg := f.messages[len(f.messages)-1]
+	lines := strings.Split(strings.TrimSpace(msg.Body), "\n")
+	return msg, lines[len(lines)-1]
+}
+
+type fakeUsers struct {
+	storage.Users
+	mu              sync.Mutex
+	users           map[string]dbmodel.UserDTO
+	usernameLookups int
+}
+
+func (f *fakeUsers) GetUsers(tenantID string) ([]dbmodel.UserDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dtos := make([]dbmodel.UserDTO, 0)
+	for _, dto := range f.users {
+		if dto.TenantId == tenantID {
+			dtos = append(dtos, dto)
+		}
+	}
+	return dtos, nil
+}
+
+func (f *fakeUsers) GetUserByID(id string) (dbmodel.UserDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto, ok := f.users[id]
+	if !ok {
+		return dbmodel.UserDTO{}, sql.ErrNoRows
+	}
+	return dto, nil
+}
+
+func (f *fakeUsers) GetUserByUsername(tenantID, username string) (dbmodel.UserDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.usernameLookups++
+	for _, dto := range f.users {
+		if dto.TenantId == tenantID && dto.Username == username {
+			return dto, nil
+		}
+	}
+	return dbmodel.UserDTO{}, &storage.UserNotFoundErr{}
+}
+
+func (f *fakeUsers) GetUserByEmail(tenantID, email string) (dbmodel.UserDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, dto := range f.users {
+		if dto.TenantId == tenantID && dto.Email != "" && strings.EqualFold(dto.Email, email) {
+			return dto, nil
+		}
+	}
+	return dbmodel.UserDTO{}, &storage.UserNotFoundErr{}
+}
+
+func (f *fakeUsers) CreateUser(dto dbmodel.UserDTO) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[dto.Id] = dto
+	return dto.Id, nil
+}
+
+func (f *fakeUsers) UpdateUser(dto dbmodel.UserDTO) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto.TenantId = f.users[dto.Id].TenantId
+	f.users[dto.Id] = dto
+	return nil
+}
+
+type fakeSessions struct {
+	storage.Sessions
+	mu            sync.Mutex
+	sessions      map[string]dbmodel.SessionDTO
+	refreshTokens map[string]dbmodel.RefreshTokenDTO
+	revoked       map[string]time.Time
+}
+
+func (f *fakeSessions) GetSessionsByUserID(userID string) ([]dbmodel.SessionDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dtos := make([]dbmodel.SessionDTO, 0)
+	for _, dto := range f.sessions {
+		if dto.UserId == userID && !dto.Revoked {
+			dtos = append(dtos, dto)
+		}
+	}
+	return dtos, nil
+}
+
+func (f *fakeSessions) GetSessionByID(id string) (dbmodel.SessionDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto, ok := f.sessions[id]
+	if !ok {
+		return dbmodel.SessionDTO{}, sql.ErrNoRows
+	}
+	return dto, nil
+}
+
+func (f *fakeSessions) CreateSession(dto dbmodel.SessionDTO) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessions[dto.Id] = dto
+	return dto.Id, nil
+}
+
+func (f *fakeSessions) UpdateSession(dto dbmodel.SessionDTO) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessions[dto.Id] = dto
+	return nil
+}
+
+func (f *fakeSessions) RevokeSessionsByUserID(userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, dto := range f.sessions {
+		if dto.UserId == userID {
+			dto.Revoked = true
+			f.sessions[id] = dto
+		}
+	}
+	for hash, dto := range f.refreshTokens {
+		if f.sessions[dto.SessionId].UserId == userID {
+			dto.Used = true
+			f.refreshTokens[hash] = dto
+		}
+	}
+	return nil
+}
+
+func (f *fakeSessions) GetRefreshToken(hash string) (dbmodel.RefreshTokenDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto, ok := f.refreshTokens[hash]
+	if !ok {
+		return dbmodel.RefreshTokenDTO{}, sql.ErrNoRows
+	}
+	return dto, nil
+}
+
+func (f *fakeSessions) CreateRefreshToken(dto dbmodel.RefreshTokenDTO) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.refreshTokens[dto.Hash] = dto
+	return nil
+}
+
+func (f *fakeSessions) UseRefreshToken(hash string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto, ok := f.refreshTokens[hash]
+	if !ok || dto.Used {
+		return false, nil
+	}
+	dto.Used = true
+	f.refreshTokens[hash] = dto
+	return true, nil
+}
+
+func (f *fakeSessions) RevokeToken(jti string, expiresAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revoked[jti] = expiresAt
+	return nil
+}
+
+func (f *fakeSessions) IsTokenRevoked(jti string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.revoked[jti]
+	return ok, nil
+}
+
+type fakeAPIKeys struct {
+	storage.APIKeys
+	mu      sync.Mutex
+	keys    map[string]dbmodel.APIKeyDTO
+	touches int
+}
+
+func (f *fakeAPIKeys) GetAPIKeysByUserID(userID string) ([]dbmodel.APIKeyDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dtos := make([]dbmodel.APIKeyDTO, 0)
+	for _, dto := range f.keys {
+		if dto.UserId == userID && !dto.Revoked {
+			dtos = append(dtos, dto)
+		}
+	}
+	return dtos, nil
+}
+
+func (f *fakeAPIKeys) GetAPIKeyByID(id string) (dbmodel.APIKeyDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto, ok := f.keys[id]
+	if !ok {
+		return dbmodel.APIKeyDTO{}, sql.ErrNoRows
+	}
+	return dto, nil
+}
+
+func (f *fakeAPIKeys) GetAPIKeyByHash(hash string) (dbmodel.APIKeyDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, dto := range f.keys {
+		if dto.Hash == hash {
+			return dto, nil
+		}
+	}
+	return dbmodel.APIKeyDTO{}, sql.ErrNoRows
+}
+
+func (f *fakeAPIKeys) CreateAPIKey(dto dbmodel.APIKeyDTO) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys[dto.Id] = dto
+	return dto.Id, nil
+}
+
+func (f *fakeAPIKeys) TouchAPIKey(id string, usedAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto := f.keys[id]
+	dto.LastUsedAt = usedAt
+	f.keys[id] = dto
+	f.touches++
+	return nil
+}
+
+func (f *fakeAPIKeys) RevokeAPIKey(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto := f.keys[id]
+	dto.Revoked = true
+	f.keys[id] = dto
+	return nil
+}
+
+func (f *fakeAPIKeys) RevokeAPIKeysByUserID(userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, dto := range f.keys {
+		if dto.UserId == userID {
+			dto.Revoked = true
+			f.keys[id] = dto
+		}
+	}
+	return nil
+}
+
+type fakeGroups struct {
+	storage.Groups
+	groups  map[string]dbmodel.GroupDTO
+	members map[string][]dbmodel.UserDTO
+}
+
+func (f *fakeGroups) GetGroupByID(id string) (dbmodel.GroupDTO, error) {
+	dto, ok := f.groups[id]
+	if !ok {
+		return dbmodel.GroupDTO{}, sql.ErrNoRows
+	}
+	return dto, nil
+}
+
+func (f *fakeGroups) GetGroupMembers(groupID string) ([]dbmodel.UserDTO, error) {
+	return f.members[groupID], nil
+}
+
+func (f *fakeGroups) GetGroupsByUserID(userID string) ([]dbmodel.GroupDTO, error) {
+	return nil, nil
+}
+
+type fakeTenants struct {
+	storage.Tenants
+	mu      sync.Mutex
+	tenants map[string]dbmodel.TenantDTO
+}
+
+func (f *fakeTenants) add(slug, status string) dbmodel.TenantDTO {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto := dbmodel.TenantDTO{Id: uuid.NewString(), Slug: slug, Name: slug, Status: status}
+	f.tenants[dto.Id] = dto
+	return dto
+}
+
+func (f *fakeTenants) GetTenantByID(id string) (dbmodel.TenantDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto, ok := f.tenants[id]
+	if !ok {
+		return dbmodel.TenantDTO{}, sql.ErrNoRows
+	}
+	return dto, nil
+}
+
+func (f *fakeTenants) GetTenantBySlug(slug string) (dbmodel.TenantDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, dto := range f.tenants {
+		if dto.Slug == slug {
+			return dto, nil
+		}
+	}
+	return dbmodel.TenantDTO{}, &storage.TenantNotFoundErr{}
+}
+
+type fakeTags struct {
+	storage.Tags
+}
+
+func (f *fakeTags) GetTags(tenantID string) ([]dbmodel.TagDTO, error) {
+	return []dbmodel.TagDTO{}, nil
+}
+
+func (f *fakeTags) GetTagsByBookID(bookID string) ([]dbmodel.TagDTO, error) {
+	return nil, nil
+}
+
+type fakeAuthors struct {
+	storage.Authors
+}
+
+func (f *fakeAuthors) GetAuthorsByBookID(bookID string) ([]dbmodel.AuthorDTO, error) {
+	return nil, nil
+}
+
+type fakeSubjects struct {
+	storage.Subjects
+}
+
+func (f *fakeSubjects) GetSubjectsByBookID(bookID string) ([]dbmodel.SubjectDTO, error) {
+	return nil, nil
+}
+
+type fakeBooks struct {
+	storage.Books
+	mu    sync.Mutex
+	books map[string]dbmodel.BookDTO
+}
+
+func (f *fakeBooks) add(tenantID, title string) dbmodel.BookDTO {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto := dbmodel.BookDTO{Id: uuid.NewString(), Title: title, TenantId: tenantID}
+	f.books[dto.Id] = dto
+	return dto
+}
+
+func (f *fakeBooks) GetBooks(filter dbmodel.BookFilter) ([]dbmodel.BookDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dtos := make([]dbmodel.BookDTO, 0)
+	for _, dto := range f.books {
+		if filter.TenantId == "" || dto.TenantId == filter.TenantId {
+			dtos = append(dtos, dto)
+		}
+	}
+	return dtos, nil
+}
+
+func (f *fakeBooks) GetBookByID(id string) (dbmodel.BookDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto, ok := f.books[id]
+	if !ok {
+		return dbmodel.BookDTO{}, sql.ErrNoRows
+	}
+	return dto, nil
+}
+
+// fakeACL hides the books in hidden from everyone it is asked about, the
+// grant rules themselves are covered by the storage tests.
+type fakeACL struct {
+	storage.ACL
+	mu     sync.Mutex
+	hidden map[string]bool
+	asked  []string
+}
+
+func (f *fakeACL) GetHiddenBookIDs(bookIDs []string, userID string, groups []string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.asked = append(f.asked, userID)
+	hidden := make([]string, 0)
+	for _, id := range bookIDs {
+		if f.hidden[id] {
+			hidden = append(hidden, id)
+		}
+	}
+	return hidden, nil
+}
+
+type fakeAudit struct {
+	storage.Audit
+	mu     sync.Mutex
+	events []dbmodel.AuditEventDTO
+}
+
+func (f *fakeAudit) CreateAuditEvent(dto dbmodel.AuditEventDTO) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, dto)
+	return nil
+}
+
+type fakeEmailVerifications struct {
+	storage.EmailVerifications
+	mu            sync.Mutex
+	verifications map[string]dbmodel.EmailVerificationDTO
+}
+
+func (f *fakeEmailVerifications) CreateEmailVerification(dto dbmodel.EmailVerificationDTO) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.verifications[dto.Hash] = dto
+	return nil
+}
+
+func (f *fakeEmailVerifications) UseEmailVerification(hash string) (dbmodel.EmailVerificationDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto, ok := f.verifications[hash]
+	if !ok || dto.Used || time.Now().After(dto.ExpiresAt) {
+		return dbmodel.EmailVerificationDTO{}, sql.ErrNoRows
+	}
+	dto.Used = true
+	f.verifications[hash] = dto
+	return dto, nil
+}
+
+func (f *fakeEmailVerifications) DeleteEmailVerificationsByUserID(userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for hash, dto := range f.verifications {
+		if dto.UserId == userID {
+			delete(f.verifications, hash)
+		}
+	}
+	return nil
+}
+
+type fakeLoginAttempts struct {
+	storage.LoginAttempts
+	mu       sync.Mutex
+	attempts map[string]dbmodel.LoginAttemptDTO
+}
+
+// age moves the last failure of key into the past.
+func (f *fakeLoginAttempts) age(key string, by time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if dto, ok := f.attempts[key]; ok {
+		dto.LastFailureAt = dto.LastFailureAt.Add(-by)
+		f.attempts[key] = dto
+	}
+}
+
+func (f *fakeLoginAttempts) GetLoginAttempt(key string) (dbmodel.LoginAttemptDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto, ok := f.attempts[key]
+	if !ok {
+		return dbmodel.LoginAttemptDTO{}, sql.ErrNoRows
+	}
+	return dto, nil
+}
+
+func (f *fakeLoginAttempts) RecordLoginFailure(key string, at time.Time, resetBefore time.Time) (dbmodel.LoginAttemptDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto, ok := f.attempts[key]
+	if !ok || dto.LastFailureAt.Before(resetBefore) {
+		dto = dbmodel.LoginAttemptDTO{Key: key, LockedUntil: dto.LockedUntil}
+	}
+	dto.Failures++
+	dto.LastFailureAt = at
+	f.attempts[key] = dto
+	return dto, nil
+}
+
+func (f *fakeLoginAttempts) ForgiveLoginAttempt(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if dto, ok := f.attempts[key]; ok && dto.Failures > 0 {
+		dto.Failures--
+		f.attempts[key] = dto
+	}
+	return nil
+}
+
+func (f *fakeLoginAttempts) LockLoginAttempt(key string, until time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if dto, ok := f.attempts[key]; ok {
+		dto.LockedUntil = until
+		f.attempts[key] = dto
+	}
+	return nil
+}
+
+func (f *fakeLoginAttempts) DeleteLoginAttempt(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.attempts, key)
+	return nil
+}
+
+type fakeTwoFactor struct {
+	storage.TwoFactor
+}
+
+func (f *fakeTwoFactor) GetTwoFactor(userID string) (dbmodel.TwoFactorDTO, error) {
+	return dbmodel.TwoFactorDTO{}, sql.ErrNoRows
+}
+
+type fakeIdentities struct {
+	storage.Identities
+	mu         sync.Mutex
+	identities map[string]dbmodel.IdentityDTO
+	states     map[string]dbmodel.LoginStateDTO
+}
+
+func (f *fakeIdentities) GetIdentity(issuer, subject string) (dbmodel.IdentityDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, dto := range f.identities {
+		if dto.Issuer == issuer && dto.Subject == subject {
+			return dto, nil
+		}
+	}
+	return dbmodel.IdentityDTO{}, sql.ErrNoRows
+}
+
+func (f *fakeIdentities) GetIdentityByID(id string) (dbmodel.IdentityDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto, ok := f.identities[id]
+	if !ok {
+		return dbmodel.IdentityDTO{}, sql.ErrNoRows
+	}
+	return dto, nil
+}
+
+func (f *fakeIdentities) GetIdentitiesByUserID(userID string) ([]dbmodel.IdentityDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dtos := make([]dbmodel.IdentityDTO, 0)
+	for _, dto := range f.identities {
+		if dto.UserId == userID {
+			dtos = append(dtos, dto)
+		}
+	}
+	return dtos, nil
+}
+
+func (f *fakeIdentities) CreateIdentity(dto dbmodel.IdentityDTO) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.identities[dto.Id] = dto
+	return dto.Id, nil
+}
+
+func (f *fakeIdentities) DeleteIdentityByID(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.identities, id)
+	return nil
+}
+
+func (f *fakeIdentities) CreateLoginState(dto dbmodel.LoginStateDTO) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.states[dto.State] = dto
+	return nil
+}
+
+func (f *fakeIdentities) ConsumeLoginState(state string) (dbmodel.LoginStateDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto, ok := f.states[state]
+	if !ok || time.Now().After(dto.ExpiresAt) {
+		return dbmodel.LoginStateDTO{}, sql.ErrNoRows
+	}
+	delete(f.states, state)
+	return dto, nil
+}
+
+type fakePasswordResets struct {
+	mu     sync.Mutex
+	resets map[string]dbmodel.PasswordResetDTO
+}
+
+func (f *fakePasswordResets) CreatePasswordReset(dto dbmodel.PasswordResetDTO) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resets[dto.Hash] = dto
+	return nil
+}
+
+func (f *fakePasswordResets) GetPasswordReset(hash string) (dbmodel.PasswordResetDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto, ok := f.resets[hash]
+	if !ok || dto.Used || time.Now().After(dto.ExpiresAt) {
+		return dbmodel.PasswordResetDTO{}, sql.ErrNoRows
+	}
+	return dto, nil
+}
+
+func (f *fakePasswordResets) UsePasswordReset(hash string) (dbmodel.PasswordResetDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dto, ok := f.resets[hash]
+	if !ok || dto.Used || time.Now().After(dto.ExpiresAt) {
+		return dbmodel.PasswordResetDTO{}, sql.ErrNoRows
+	}
+	dto.Used = true
+	f.resets[hash] = dto
+	return dto, nil
+}
+
+func (f *fakePasswordResets) DeletePasswordResetsByUserID(userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for hash, dto := range f.resets {
+		if dto.UserId == userID {
+			delete(f.resets, hash)
+		}
+	}
+	return nil
+}
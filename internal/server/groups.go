@@ -0,0 +1,419 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/model"
+	"github.com/szwedm/cloud-library/internal/rbac"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+type groupsHandler struct {
+	storage storage.Groups
+	users   storage.Users
+	policy  *rbac.Policy
+	audit   *auditor
+}
+
+func newGroupsHandler(g storage.Groups, u storage.Users, p *rbac.Policy, au *auditor) *groupsHandler {
+	return &groupsHandler{
+		storage: g,
+		users:   u,
+		policy:  p,
+		audit:   au,
+	}
+}
+
+func (h *groupsHandler) getGroups(w http.ResponseWriter, r *http.Request) {
+	dtos, err := h.storage.GetGroups(tenantFromRequest(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	groups := make([]model.Group, 0)
+	for _, dto := range dtos {
+		groups = append(groups, model.GroupFromDTO(dto))
+	}
+
+	body, err := json.Marshal(groups)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *groupsHandler) getGroupByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("group id is required"))
+		return
+	}
+
+	dto, err := groupInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("group with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	body, err := json.Marshal(model.GroupFromDTO(dto))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *groupsHandler) createGroup(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+
+	var group model.Group
+	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	group.Name = strings.TrimSpace(group.Name)
+	if group.Name == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("group name is required"))
+		return
+	}
+	if group.Role != "" && !h.policy.HasRole(group.Role) {
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("unknown role: %s", group.Role))
+		return
+	}
+	if group.Role != "" && !h.policy.CanAssign(rolesFromClaims(props), group.Role) {
+		respondWithError(w, http.StatusForbidden, fmt.Errorf("not allowed to assign role %s", group.Role))
+		return
+	}
+
+	group.TenantId = tenantFromRequest(r)
+	if _, err := h.storage.GetGroupByName(group.TenantId, group.Name); err == nil {
+		respondWithError(w, http.StatusConflict, errors.New("group already exists"))
+		return
+	}
+
+	group.Id = uuid.NewString()
+	id, err := h.storage.CreateGroup(model.DTOFromGroup(group))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditGroupCreate, "group", id, nil, group)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "group created with id: " + id}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, body)
+}
+
+func (h *groupsHandler) updateGroup(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("group id is required"))
+		return
+	}
+
+	var req struct {
+		Name        string  `json:"name"`
+		Description string  `json:"description"`
+		Role        *string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	dto, err := groupInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("group with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	before := model.GroupFromDTO(dto)
+	if name := strings.TrimSpace(req.Name); name != "" && name != dto.Name {
+		if existing, err := h.storage.GetGroupByName(dto.TenantId, name); err == nil && existing.Id != dto.Id {
+			respondWithError(w, http.StatusConflict, errors.New("group already exists"))
+			return
+		}
+		dto.Name = name
+	}
+	if req.Description != "" {
+		dto.Description = req.Description
+	}
+	if req.Role != nil {
+		if *req.Role != "" && !h.policy.HasRole(*req.Role) {
+			respondWithError(w, http.StatusBadRequest, fmt.Errorf("unknown role: %s", *req.Role))
+			return
+		}
+		if !h.policy.CanAssign(rolesFromClaims(props), dto.Role) || !h.policy.CanAssign(rolesFromClaims(props), *req.Role) {
+			respondWithError(w, http.StatusForbidden, fmt.Errorf("not allowed to assign role %s", *req.Role))
+			return
+		}
+		dto.Role = *req.Role
+	}
+
+	if err = h.storage.UpdateGroup(dto); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditGroupUpdate, "group", dto.Id, before, model.GroupFromDTO(dto))
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "group updated"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *groupsHandler) deleteGroupByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("group id is required"))
+		return
+	}
+
+	dto, err := groupInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("group with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err = h.storage.DeleteGroupByID(dto.Id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditGroupDelete, "group", dto.Id, model.GroupFromDTO(dto), nil)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "group deleted"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *groupsHandler) getGroupMembers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("group id is required"))
+		return
+	}
+
+	if _, err := groupInTenant(h.storage, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("group with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dtos, err := h.storage.GetGroupMembers(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	users := make([]model.User, 0)
+	for _, dto := range dtos {
+		users = append(users, model.UserFromDTO(dto))
+	}
+
+	body, err := json.Marshal(users)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *groupsHandler) addGroupMembers(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("group id is required"))
+		return
+	}
+
+	var req mergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	if len(req.Ids) == 0 {
+		respondWithError(w, http.StatusBadRequest, errors.New("at least one user id is required"))
+		return
+	}
+
+	group, err := groupInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("group with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if group.Role != "" && !h.policy.CanAssign(rolesFromClaims(props), group.Role) {
+		respondWithError(w, http.StatusForbidden, fmt.Errorf("not allowed to assign role %s", group.Role))
+		return
+	}
+
+	for _, id := range req.Ids {
+		if _, err := userInTenant(h.users, r, id); err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusBadRequest, fmt.Errorf("user with id: %s not found, %w", id, err))
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if err := h.storage.AddGroupMembers(vars["id"], req.Ids); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditGroupMemberAdd, "group", vars["id"], nil, req)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "members added to group"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *groupsHandler) removeGroupMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" || vars["userId"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("group id and user id are required"))
+		return
+	}
+
+	if _, err := groupInTenant(h.storage, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("group with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.storage.RemoveGroupMember(vars["id"], vars["userId"]); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditGroupMemberDrop, "group", vars["id"], mergeRequest{Ids: []string{vars["userId"]}}, nil)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "member removed from group"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *groupsHandler) getUserGroups(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("user id is required"))
+		return
+	}
+
+	if _, err := userInTenant(h.users, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("user with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dtos, err := h.storage.GetGroupsByUserID(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	groups := make([]model.Group, 0)
+	for _, dto := range dtos {
+		groups = append(groups, model.GroupFromDTO(dto))
+	}
+
+	body, err := json.Marshal(groups)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
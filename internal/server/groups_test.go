@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+func TestGetGroupMembersHidesPasswords(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	admin := st.addUser("admin", dbmodel.UserRoleAdministrator)
+	alice := st.addUser("alice", dbmodel.UserRoleReader)
+	alice.Password = "$2a$04$secret-hash"
+	group := dbmodel.GroupDTO{Id: uuid.NewString(), Name: "staff", TenantId: dbmodel.DefaultTenantId}
+	st.groups.groups[group.Id] = group
+	st.groups.members[group.Id] = []dbmodel.UserDTO{alice}
+
+	r := newRequest("GET", "/groups/"+group.Id+"/members", "")
+	r.Header.Set("Authorization", bearer(t, s, admin))
+	w := serve(s, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /groups/{id}/members = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "alice") {
+		t.Errorf("members response does not list alice: %s", w.Body)
+	}
+	if strings.Contains(w.Body.String(), "password") {
+		t.Errorf("members response exposes password hashes: %s", w.Body)
+	}
+}
@@ -1,49 +1,132 @@
 package server
 
 import (
+	"archive/zip"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go/v4"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/catalog"
 	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/mail"
 	"github.com/szwedm/cloud-library/internal/model"
+	"github.com/szwedm/cloud-library/internal/password"
+	"github.com/szwedm/cloud-library/internal/rbac"
 	"github.com/szwedm/cloud-library/internal/storage"
-	"golang.org/x/crypto/bcrypt"
 )
 
-const MaxBookFileSize int64 = 10 << 20
+const (
+	MaxBookFileSize int64 = catalog.MaxBookFileSize
+	MaxImportSize   int64 = 1 << 30
+)
 
 type booksHandler struct {
-	storage storage.Books
+	storage     storage.Books
+	authors     storage.Authors
+	subjects    storage.Subjects
+	tags        storage.Tags
+	imports     storage.Imports
+	collections storage.Collections
+	revisions   storage.BookRevisions
+	access      *accessControl
+	quotas      *quotas
+	audit       *auditor
+	catalog     *catalog.Catalog
+	importer    *catalog.Importer
 }
 
 type usersHandler struct {
-	storage storage.Users
+	storage       storage.Users
+	sessions      storage.Sessions
+	apiKeys       storage.APIKeys
+	policy        *rbac.Policy
+	verifications storage.EmailVerifications
+	mailer        mail.Mailer
+	throttle      *throttle
+	hasher        *password.Hasher
+	passwords     *password.Policy
+	tenants       *tenantResolver
+	audit         *auditor
 }
 
-func newBooksHandler(b storage.Books) *booksHandler {
+func newBooksHandler(b storage.Books, a storage.Authors, s storage.Subjects, t storage.Tags, i storage.Imports, col storage.Collections, br storage.BookRevisions, ac *accessControl, q *quotas, au *auditor) *booksHandler {
+	c := catalog.NewCatalog(a, s, t)
 	return &booksHandler{
-		storage: b,
+		storage:     b,
+		authors:     a,
+		subjects:    s,
+		tags:        t,
+		imports:     i,
+		collections: col,
+		revisions:   br,
+		access:      ac,
+		quotas:      q,
+		audit:       au,
+		catalog:     c,
+		importer:    catalog.NewImporter(b, c, i),
 	}
 }
 
-func newUsersHandler(u storage.Users) *usersHandler {
+func newUsersHandler(u storage.Users, s storage.Sessions, ak storage.APIKeys, p *rbac.Policy, v storage.EmailVerifications, m mail.Mailer, t *throttle, ph *password.Hasher, pp *password.Policy, tr *tenantResolver, au *auditor) *usersHandler {
 	return &usersHandler{
-		storage: u,
+		storage:       u,
+		sessions:      s,
+		apiKeys:       ak,
+		policy:        p,
+		verifications: v,
+		mailer:        m,
+		throttle:      t,
+		hasher:        ph,
+		passwords:     pp,
+		tenants:       tr,
+		audit:         au,
 	}
 }
 
 func (h *booksHandler) getBooks(w http.ResponseWriter, r *http.Request) {
-	dtos, err := h.storage.GetBooks()
+	filter, err := bookFilterFromQuery(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	filter.TenantId = tenantFromRequest(r)
+
+	dtos, err := h.storage.GetBooks(filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respondWithBooks(w, r, dtos)
+}
+
+func (h *booksHandler) exportBooks(w http.ResponseWriter, r *http.Request) {
+	filter, err := bookFilterFromQuery(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	filter.TenantId = tenantFromRequest(r)
+
+	dtos, err := h.storage.GetBooks(filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dtos, err = h.access.visibleBooks(r, dtos)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err)
 		return
@@ -51,33 +134,197 @@ func (h *booksHandler) getBooks(w http.ResponseWriter, r *http.Request) {
 
 	books := make([]model.Book, 0)
 	for _, dto := range dtos {
-		books = append(books, model.BookFromDTO(dto))
+		book, err := h.catalog.BookWithRelations(dto)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		books = append(books, book)
+	}
+
+	var body []byte
+	var contentType, filename string
+	switch format := r.URL.Query().Get("format"); format {
+	case catalog.FormatMARC:
+		body, err = catalog.MarshalMARC(books)
+		contentType, filename = "application/marcxml+xml", "books.marcxml"
+	case catalog.FormatDublinCore:
+		body, err = catalog.MarshalDublinCore(books)
+		contentType, filename = "application/xml", "books.dc.xml"
+	default:
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("unsupported export format: %s", format))
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
 	}
 
-	body, err := json.Marshal(books)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func (h *booksHandler) importRecords(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImportSize)
+	defer r.Body.Close()
+
+	var records []model.Book
+	var err error
+	switch format := r.URL.Query().Get("format"); format {
+	case catalog.FormatMARC:
+		records, err = catalog.UnmarshalMARC(r.Body)
+	case catalog.FormatDublinCore:
+		records, err = catalog.UnmarshalDublinCore(r.Body)
+	default:
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("unsupported import format: %s", format))
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	report := h.importer.ImportRecords(tenantFromRequest(r), records)
+	h.audit.record(r, auditBookImport, "import", report.ImportId, nil, report)
+
+	body, err := json.Marshal(report)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, body)
+	respondWithJSON(w, http.StatusCreated, body)
 }
 
-func (h *booksHandler) getBookByID(w http.ResponseWriter, r *http.Request) {
-	props, _ := r.Context().Value("props").(jwt.MapClaims)
-	if props["role"] != model.UserRoleAdministrator && props["role"] != model.UserRoleReader {
-		respondWithError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+func (h *booksHandler) getBooksByAuthorID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("author id is required"))
+		return
+	}
+
+	if _, err := authorInTenant(h.authors, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("author with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dtos, err := h.storage.GetBooksByAuthorID(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respondWithBooks(w, r, dtos)
+}
+
+func (h *booksHandler) getBooksBySubjectID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("subject id is required"))
+		return
+	}
+
+	if _, err := subjectInTenant(h.subjects, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("subject with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	withDescendants := true
+	if descendants := r.URL.Query().Get("descendants"); descendants != "" {
+		var err error
+		if withDescendants, err = strconv.ParseBool(descendants); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Errorf("invalid descendants flag, %w", err))
+			return
+		}
+	}
+
+	dtos, err := h.storage.GetBooksBySubjectID(vars["id"], withDescendants)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respondWithBooks(w, r, dtos)
+}
+
+func (h *booksHandler) getBooksByTagID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("tag id is required"))
+		return
+	}
+
+	if _, err := tagInTenant(h.tags, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("tag with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dtos, err := h.storage.GetBooksByTagID(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respondWithBooks(w, r, dtos)
+}
+
+func (h *booksHandler) getBooksByCollectionID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("collection id is required"))
+		return
+	}
+
+	if _, err := collectionInTenant(h.collections, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("collection with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	dtos, err := h.storage.GetBooksByCollectionID(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respondWithBooks(w, r, dtos)
+}
+
+func (h *booksHandler) getBookByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	if vars["id"] == "" {
 		respondWithError(w, http.StatusBadRequest, errors.New("book id is required"))
 		return
 	}
 
-	filePath := filepath.Clean(os.Getenv("APP_BOOKS_STORAGE_PATH") + string(os.PathSeparator) + vars["id"] + ".pdf")
-	requestedFile, err := os.Open(filePath)
+	allowed, err := h.access.canAccessBook(r, vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusNotFound, fmt.Errorf("book with id: %s not found", vars["id"]))
+		return
+	}
+
+	requestedFile, err := os.Open(catalog.BookFilePath(tenantFromRequest(r), vars["id"]))
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, err)
 		return
@@ -99,10 +346,7 @@ func (h *booksHandler) getBookByID(w http.ResponseWriter, r *http.Request) {
 
 func (h *booksHandler) createBook(w http.ResponseWriter, r *http.Request) {
 	props, _ := r.Context().Value("props").(jwt.MapClaims)
-	if props["role"] != model.UserRoleAdministrator {
-		respondWithError(w, http.StatusUnauthorized, errors.New("unauthorized"))
-		return
-	}
+	userID, _ := props["id"].(string)
 
 	r.Body = http.MaxBytesReader(w, r.Body, MaxBookFileSize)
 	err := r.ParseMultipartForm(MaxBookFileSize)
@@ -112,20 +356,60 @@ func (h *booksHandler) createBook(w http.ResponseWriter, r *http.Request) {
 	}
 
 	id := uuid.NewString()
-	dto := dbmodel.BookDTO{
-		Id:      id,
-		Title:   r.PostFormValue("title"),
-		Author:  r.PostFormValue("author"),
-		Subject: r.PostFormValue("subject"),
+	book := model.Book{
+		Id:          id,
+		Title:       r.PostFormValue("title"),
+		Isbn10:      r.PostFormValue("isbn10"),
+		Isbn13:      r.PostFormValue("isbn13"),
+		Publisher:   r.PostFormValue("publisher"),
+		Edition:     r.PostFormValue("edition"),
+		Language:    r.PostFormValue("language"),
+		Series:      r.PostFormValue("series"),
+		Description: r.PostFormValue("description"),
+		Authors:     make([]model.Author, 0),
+		Subjects:    make([]model.Subject, 0),
+		Tags:        make([]model.Tag, 0),
+		TenantId:    tenantFromRequest(r),
+	}
+	if year := r.PostFormValue("publicationYear"); year != "" {
+		if book.PublicationYear, err = strconv.Atoi(year); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Errorf("invalid publication year, %w", err))
+			return
+		}
+	}
+	if index := r.PostFormValue("seriesIndex"); index != "" {
+		if book.SeriesIndex, err = strconv.Atoi(index); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Errorf("invalid series index, %w", err))
+			return
+		}
+	}
+	if err = catalog.NormalizeBookDetails(&book); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	for _, name := range r.PostForm["author"] {
+		book.Authors = append(book.Authors, model.Author{Name: name})
+	}
+	for _, name := range r.PostForm["subject"] {
+		book.Subjects = append(book.Subjects, model.Subject{Name: name})
+	}
+	for _, name := range r.PostForm["tag"] {
+		book.Tags = append(book.Tags, model.Tag{Name: name})
 	}
 
-	file, _, err := r.FormFile("bookFile")
+	file, header, err := r.FormFile("bookFile")
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err)
 		return
 	}
 	defer file.Close()
 
+	if err = h.quotas.check(book.TenantId, userID, header.Size); err != nil {
+		respondWithQuotaError(w, err)
+		return
+	}
+	book.FileSize = header.Size
+
 	buff := make([]byte, 512)
 	_, err = file.Read(buff)
 	if err != nil {
@@ -145,7 +429,7 @@ func (h *booksHandler) createBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dst, err := os.Create(fmt.Sprintf("%s/%s.pdf", os.Getenv("APP_BOOKS_STORAGE_PATH"), id))
+	dst, err := catalog.CreateBookFile(book.TenantId, id)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err)
 		return
@@ -158,12 +442,31 @@ func (h *booksHandler) createBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	dto := model.DTOFromBook(book)
+	dto.UploadedBy = userID
 	_, err = h.storage.CreateBook(dto)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	if err = h.catalog.SetBookRelations(book); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := h.catalog.BookWithRelations(dto)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err = h.recordRevision(r, model.Book{}, created); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.audit.record(r, auditBookCreate, "book", id, nil, book)
+
 	type response struct {
 		Msg string `json:"message"`
 	}
@@ -179,12 +482,6 @@ func (h *booksHandler) createBook(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *booksHandler) updateBook(w http.ResponseWriter, r *http.Request) {
-	props, _ := r.Context().Value("props").(jwt.MapClaims)
-	if props["role"] != model.UserRoleAdministrator {
-		respondWithError(w, http.StatusUnauthorized, errors.New("unauthorized"))
-		return
-	}
-
 	vars := mux.Vars(r)
 	if vars["id"] == "" {
 		respondWithError(w, http.StatusBadRequest, errors.New("book id is required"))
@@ -199,25 +496,86 @@ func (h *booksHandler) updateBook(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	dto := dbmodel.BookDTO{
-		Id: vars["id"],
+	dto, err := bookInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("book with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	before, err := h.catalog.BookWithRelations(dto)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err = catalog.NormalizeBookDetails(&book); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
 	}
+
 	if book.Title != "" {
 		dto.Title = book.Title
 	}
-	if book.Author != "" {
-		dto.Author = book.Author
+	if book.Isbn10 != "" {
+		dto.Isbn10 = book.Isbn10
+	}
+	if book.Isbn13 != "" {
+		dto.Isbn13 = book.Isbn13
+	}
+	if book.Publisher != "" {
+		dto.Publisher = book.Publisher
+	}
+	if book.PublicationYear != 0 {
+		dto.PublicationYear = book.PublicationYear
+	}
+	if book.Edition != "" {
+		dto.Edition = book.Edition
+	}
+	if book.Language != "" {
+		dto.Language = book.Language
+	}
+	if book.Series != "" {
+		dto.Series = book.Series
+	}
+	if book.SeriesIndex != 0 {
+		dto.SeriesIndex = book.SeriesIndex
 	}
-	if book.Subject != "" {
-		dto.Subject = book.Subject
+	if book.Description != "" {
+		dto.Description = book.Description
 	}
 
-	err := h.storage.UpdateBook(dto)
+	err = h.storage.UpdateBook(dto)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	book.Id = dto.Id
+	book.TenantId = dto.TenantId
+	if err = h.catalog.SetBookRelations(book); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	after, err := h.catalog.BookWithRelations(dto)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err = h.recordRevision(r, before, after); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditBookUpdate, "book", dto.Id, before, after)
+
 	type response struct {
 		Msg string `json:"message"`
 	}
@@ -233,34 +591,34 @@ func (h *booksHandler) updateBook(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *booksHandler) deleteBookByID(w http.ResponseWriter, r *http.Request) {
-	props, _ := r.Context().Value("props").(jwt.MapClaims)
-	if props["role"] != model.UserRoleAdministrator {
-		respondWithError(w, http.StatusUnauthorized, errors.New("unauthorized"))
-		return
-	}
-
 	vars := mux.Vars(r)
 	if vars["id"] == "" {
 		respondWithError(w, http.StatusBadRequest, errors.New("book id is required"))
 		return
 	}
 
-	filePath := filepath.Clean(os.Getenv("APP_BOOKS_STORAGE_PATH") + string(os.PathSeparator) + vars["id"] + ".pdf")
-	if err := os.Remove(filePath); err != nil {
-		respondWithError(w, http.StatusNotFound, err)
+	dto, err := bookInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("book with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	err := h.storage.DeleteBookByID(vars["id"])
+	err = h.storage.TrashBookByID(dto.Id, time.Now())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	h.audit.record(r, auditBookDelete, "book", dto.Id, model.BookFromDTO(dto), nil)
+
 	type response struct {
 		Msg string `json:"message"`
 	}
-	resp := response{Msg: "book deleted"}
+	resp := response{Msg: "book moved to trash"}
 
 	body, err := json.Marshal(resp)
 	if err != nil {
@@ -271,21 +629,197 @@ func (h *booksHandler) deleteBookByID(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, body)
 }
 
-func (h *usersHandler) getUsers(w http.ResponseWriter, r *http.Request) {
-	props, _ := r.Context().Value("props").(jwt.MapClaims)
-	if props["role"] != model.UserRoleAdministrator {
-		respondWithError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+func (h *booksHandler) importBooks(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImportSize)
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	dtos, err := h.storage.GetUsers()
+	importID := r.PostFormValue("importId")
+	if importID != "" {
+		job, err := h.imports.GetImportByID(importID)
+		if err == nil && job.TenantId != tenantFromRequest(r) {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusNotFound, fmt.Errorf("import with id: %s not found, %w", importID, err))
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	manifest, manifestHeader, err := r.FormFile("manifest")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer manifest.Close()
+
+	format := r.PostFormValue("format")
+	if format == "" {
+		if format, err = catalog.ManifestFormatFromFilename(manifestHeader.Filename); err != nil {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	rows, err := catalog.ParseManifest(manifest, format)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	archive, archiveHeader, err := r.FormFile("archive")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer archive.Close()
+
+	files, err := zip.NewReader(archive, archiveHeader.Size)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("unable to read zip archive, %w", err))
+		return
+	}
+
+	report, err := h.importer.Import(tenantFromRequest(r), importID, rows, files)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditBookImport, "import", report.ImportId, nil, report)
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if importID == "" {
+		respondWithJSON(w, http.StatusCreated, body)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *booksHandler) getImportByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("import id is required"))
+		return
+	}
+
+	job, err := h.imports.GetImportByID(vars["id"])
+	if err == nil && job.TenantId != tenantFromRequest(r) {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("import with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := h.imports.GetImportRows(job.Id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	report := catalog.ImportReport{
+		ImportId: job.Id,
+		Status:   job.Status,
+		Total:    job.Total,
+		Imported: job.Imported,
+		Failed:   job.Failed,
+		Errors:   make([]catalog.ImportRowError, 0),
+	}
+	for _, row := range rows {
+		if row.Status == dbmodel.ImportRowStatusFailed {
+			report.Errors = append(report.Errors, catalog.ImportRowError{Row: row.Row, Error: row.Error})
+		}
+	}
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func bookFilterFromQuery(query url.Values) (dbmodel.BookFilter, error) {
+	filter := dbmodel.BookFilter{
+		Title:       query.Get("title"),
+		Isbn:        model.NormalizeISBN(query.Get("isbn")),
+		Publisher:   query.Get("publisher"),
+		Edition:     query.Get("edition"),
+		Language:    strings.ToLower(query.Get("language")),
+		Series:      query.Get("series"),
+		Description: query.Get("description"),
+	}
+
+	var err error
+	if year := query.Get("publicationYear"); year != "" {
+		if filter.PublicationYear, err = strconv.Atoi(year); err != nil {
+			return dbmodel.BookFilter{}, fmt.Errorf("invalid publication year, %w", err)
+		}
+	}
+	if index := query.Get("seriesIndex"); index != "" {
+		if filter.SeriesIndex, err = strconv.Atoi(index); err != nil {
+			return dbmodel.BookFilter{}, fmt.Errorf("invalid series index, %w", err)
+		}
+	}
+	return filter, nil
+}
+
+func (h *booksHandler) respondWithBooks(w http.ResponseWriter, r *http.Request, dtos []dbmodel.BookDTO) {
+	dtos, err := h.access.visibleBooks(r, dtos)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	books := make([]model.Book, 0)
+	for _, dto := range dtos {
+		book, err := h.catalog.BookWithRelations(dto)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		books = append(books, book)
+	}
+
+	body, err := json.Marshal(books)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *usersHandler) getUsers(w http.ResponseWriter, r *http.Request) {
+	dtos, err := h.storage.GetUsers(tenantFromRequest(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
 	users := make([]model.User, 0)
 	for _, dto := range dtos {
+		if status != "" && dto.Status != status {
+			continue
+		}
 		users = append(users, model.UserFromDTO(dto))
 	}
 
@@ -300,10 +834,7 @@ func (h *usersHandler) getUsers(w http.ResponseWriter, r *http.Request) {
 
 func (h *usersHandler) getUserByID(w http.ResponseWriter, r *http.Request) {
 	props, _ := r.Context().Value("props").(jwt.MapClaims)
-	if props["role"] != model.UserRoleAdministrator && props["role"] != model.UserRoleReader {
-		respondWithError(w, http.StatusUnauthorized, errors.New("unauthorized"))
-		return
-	}
+	manage := h.policy.AllowedAny(rolesFromClaims(props), rbac.UsersManage)
 
 	vars := mux.Vars(r)
 	if vars["id"] == "" {
@@ -311,14 +842,14 @@ func (h *usersHandler) getUserByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if props["role"] == model.UserRoleReader {
+	if !manage {
 		if userIdJWT := props["id"]; userIdJWT != vars["id"] {
 			respondWithError(w, http.StatusForbidden, errors.New("user id mismatch"))
 			return
 		}
 	}
 
-	dto, err := h.storage.GetUserByID(vars["id"])
+	dto, err := userInTenant(h.storage, r, vars["id"])
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondWithError(w, http.StatusNotFound, fmt.Errorf("user with id: %s not found, %w", vars["id"], err))
@@ -340,6 +871,7 @@ func (h *usersHandler) getUserByID(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *usersHandler) createUser(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
 	id := uuid.NewString()
 
 	var user model.User
@@ -350,24 +882,74 @@ func (h *usersHandler) createUser(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	if user.Role != model.UserRoleAdministrator && user.Role != model.UserRoleReader {
-		respondWithError(w, http.StatusBadRequest, errors.New("wrong user role"))
+	if user.Username == "" || user.Password == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("username and password are required"))
 		return
 	}
 
-	if _, err := h.storage.GetUserByUsername(user.Username); err == nil {
+	if h.policy.AllowedAny(rolesFromClaims(props), rbac.UsersManage) {
+		if !h.policy.HasRole(user.Role) {
+			respondWithError(w, http.StatusBadRequest, errors.New("wrong user role"))
+			return
+		}
+		if !h.policy.CanAssign(rolesFromClaims(props), user.Role) {
+			respondWithError(w, http.StatusForbidden, errors.New("not allowed to assign role "+user.Role))
+			return
+		}
+		user.Status = dbmodel.UserStatusActive
+		user.TenantId = tenantFromRequest(r)
+	} else {
+		if !registrationOpen() {
+			respondWithError(w, http.StatusForbidden, errors.New("public registration is disabled"))
+			return
+		}
+		tenant, err := h.tenants.active(r)
+		if err != nil {
+			respondWithTenantError(w, err)
+			return
+		}
+		user.TenantId = tenant.Id
+		if user.Role != "" && user.Role != model.UserRoleReader {
+			respondWithError(w, http.StatusForbidden, errors.New("only administrators can create accounts with role "+user.Role))
+			return
+		}
+		if user.Email == "" {
+			respondWithError(w, http.StatusBadRequest, errors.New("email is required"))
+			return
+		}
+		user.Role = model.UserRoleReader
+		user.Status = dbmodel.UserStatusPendingVerification
+	}
+
+	if err := h.passwords.Validate(user.Username, user.Password); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := h.storage.GetUserByUsername(user.TenantId, user.Username); err == nil {
 		respondWithError(w, http.StatusConflict, errors.New("username already exists"))
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 8)
+	if user.Email != "" {
+		if !validEmail(user.Email) {
+			respondWithError(w, http.StatusBadRequest, errors.New("invalid email address"))
+			return
+		}
+		if _, err := h.storage.GetUserByEmail(user.TenantId, user.Email); err == nil {
+			respondWithError(w, http.StatusConflict, errors.New("email already in use"))
+			return
+		}
+	}
+
+	hashedPassword, err := h.hasher.Hash(user.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	user.Id = id
-	user.Password = string(hashedPassword)
+	user.Password = hashedPassword
 
 	dto := model.DTOFromUser(user)
 	id, err = h.storage.CreateUser(dto)
@@ -376,11 +958,24 @@ func (h *usersHandler) createUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if dto.Status == dbmodel.UserStatusPendingVerification {
+		h.audit.security(r, dto.TenantId, dto.Username, dto.Id, auditUserRegister)
+	} else {
+		h.audit.record(r, auditUserCreate, "user", dto.Id, nil, model.UserFromDTO(dto))
+	}
+
 	type response struct {
 		Msg string `json:"message"`
 	}
 	resp := response{Msg: "user created with id: " + id}
 
+	if dto.Status == dbmodel.UserStatusPendingVerification {
+		if err = h.sendVerification(dto); err != nil {
+			log.Printf("unable to send verification email to user %s: %v", dto.Id, err)
+		}
+		resp.Msg += ", check your email to verify the account"
+	}
+
 	body, err := json.Marshal(resp)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err)
@@ -392,10 +987,7 @@ func (h *usersHandler) createUser(w http.ResponseWriter, r *http.Request) {
 
 func (h *usersHandler) updateUser(w http.ResponseWriter, r *http.Request) {
 	props, _ := r.Context().Value("props").(jwt.MapClaims)
-	if props["role"] != model.UserRoleAdministrator && props["role"] != model.UserRoleReader {
-		respondWithError(w, http.StatusUnauthorized, errors.New("unauthorized"))
-		return
-	}
+	manage := h.policy.AllowedAny(rolesFromClaims(props), rbac.UsersManage)
 
 	vars := mux.Vars(r)
 	if vars["id"] == "" {
@@ -403,7 +995,7 @@ func (h *usersHandler) updateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if props["role"] == model.UserRoleReader {
+	if !manage {
 		if userIdJWT := props["id"]; userIdJWT != vars["id"] {
 			respondWithError(w, http.StatusForbidden, errors.New("user id mismatch"))
 			return
@@ -418,7 +1010,7 @@ func (h *usersHandler) updateUser(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	dto, err := h.storage.GetUserByID(vars["id"])
+	dto, err := userInTenant(h.storage, r, vars["id"])
 	if err != nil {
 		if err == sql.ErrNoRows {
 			respondWithError(w, http.StatusNotFound, fmt.Errorf("user with id: %s not found, %w", vars["id"], err))
@@ -427,31 +1019,63 @@ func (h *usersHandler) updateUser(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, err)
 		return
 	}
+	if dto.Id != props["id"] && !h.policy.CanAssign(rolesFromClaims(props), dto.Role) {
+		respondWithError(w, http.StatusForbidden, errors.New("not allowed to edit users with role "+dto.Role))
+		return
+	}
+	before := model.UserFromDTO(dto)
+	passwordChanged := false
+	pendingEmail := ""
 
 	if user.Username != "" {
-		if _, err := h.storage.GetUserByUsername(user.Username); err == nil {
-			if props["username"] != user.Username {
-				respondWithError(w, http.StatusConflict, errors.New("username already exists"))
-				return
-			}
+		if existing, err := h.storage.GetUserByUsername(dto.TenantId, user.Username); err == nil && existing.Id != dto.Id {
+			respondWithError(w, http.StatusConflict, errors.New("username already exists"))
+			return
 		}
 		dto.Username = user.Username
 	}
+	if user.Email != "" {
+		if !validEmail(user.Email) {
+			respondWithError(w, http.StatusBadRequest, errors.New("invalid email address"))
+			return
+		}
+		if existing, err := h.storage.GetUserByEmail(dto.TenantId, user.Email); err == nil && existing.Id != dto.Id {
+			respondWithError(w, http.StatusConflict, errors.New("email already in use"))
+			return
+		}
+		if !strings.EqualFold(user.Email, dto.Email) {
+			pendingEmail = user.Email
+		}
+	}
 	if user.Password != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 8)
+		if err := h.passwords.Validate(dto.Username, user.Password); err != nil {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		hashedPassword, err := h.hasher.Hash(user.Password)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, err)
 			return
 		}
-		dto.Password = string(hashedPassword)
+		dto.Password = hashedPassword
+		dto.TokenVersion++
+		passwordChanged = true
 	}
-	if user.Role != "" {
-		if props["role"] == model.UserRoleAdministrator {
-			dto.Role = user.Role
-		} else {
-			dto.Role = model.UserRoleReader
+	if user.Role != "" && user.Role != dto.Role {
+		if !manage {
+			respondWithError(w, http.StatusForbidden, errors.New("changing roles requires the "+string(rbac.UsersManage)+" permission"))
+			return
 		}
-
+		if !h.policy.HasRole(user.Role) {
+			respondWithError(w, http.StatusBadRequest, errors.New("wrong user role"))
+			return
+		}
+		if !h.policy.CanAssign(rolesFromClaims(props), dto.Role) || !h.policy.CanAssign(rolesFromClaims(props), user.Role) {
+			respondWithError(w, http.StatusForbidden, errors.New("not allowed to assign role "+user.Role))
+			return
+		}
+		dto.Role = user.Role
+		dto.TokenVersion++
 	}
 
 	err = h.storage.UpdateUser(dto)
@@ -459,12 +1083,27 @@ func (h *usersHandler) updateUser(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, err)
 		return
 	}
+	if passwordChanged {
+		if err = revokeCredentials(h.sessions, h.apiKeys, dto.Id); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	h.audit.record(r, auditUserUpdate, "user", dto.Id, before, model.UserFromDTO(dto))
 
 	type response struct {
 		Msg string `json:"message"`
 	}
 	resp := response{Msg: "user updated"}
 
+	if pendingEmail != "" {
+		if err = h.sendEmailChange(dto, pendingEmail); err != nil {
+			log.Printf("unable to send verification email to user %s: %v", dto.Id, err)
+		}
+		resp.Msg += ", check the new email address to confirm the change"
+	}
+
 	body, err := json.Marshal(resp)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err)
@@ -476,10 +1115,6 @@ func (h *usersHandler) updateUser(w http.ResponseWriter, r *http.Request) {
 
 func (h *usersHandler) deleteUserByID(w http.ResponseWriter, r *http.Request) {
 	props, _ := r.Context().Value("props").(jwt.MapClaims)
-	if props["role"] != model.UserRoleAdministrator {
-		respondWithError(w, http.StatusUnauthorized, errors.New("unauthorized"))
-		return
-	}
 
 	vars := mux.Vars(r)
 	if vars["id"] == "" {
@@ -487,16 +1122,32 @@ func (h *usersHandler) deleteUserByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.storage.DeleteUserByID(vars["id"])
+	dto, err := userInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("user with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !h.policy.CanAssign(rolesFromClaims(props), dto.Role) {
+		respondWithError(w, http.StatusForbidden, errors.New("not allowed to delete users with role "+dto.Role))
+		return
+	}
+
+	err = h.storage.TrashUserByID(dto.Id, time.Now())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	h.audit.record(r, auditUserDelete, "user", dto.Id, model.UserFromDTO(dto), nil)
+
 	type response struct {
 		Msg string `json:"message"`
 	}
-	resp := response{Msg: "user deleted"}
+	resp := response{Msg: "user moved to trash"}
 
 	body, err := json.Marshal(resp)
 	if err != nil {
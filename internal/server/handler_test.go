@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+func TestUpdateUserPasswordRevokesCredentials(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	alice := st.addUser("alice", dbmodel.UserRoleReader)
+	token, refreshToken := signIn(t, s, alice)
+	key := st.addAPIKey(alice)
+
+	r := newRequest("PUT", "/users/"+alice.Id, `{"password": "Correct-horse-battery-9"}`)
+	r.Header.Set("Authorization", token)
+	if w := serve(s, r); w.Code != http.StatusOK {
+		t.Fatalf("PUT /users/{id} = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	r = newRequest("POST", "/token/refresh", `{"refreshToken": "`+refreshToken+`"}`)
+	if w := serve(s, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after password change = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	r = newRequest("GET", "/tags", "")
+	r.Header.Set("X-API-Key", key)
+	if w := serve(s, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("api key after password change = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	r = newRequest("GET", "/me/sessions", "")
+	r.Header.Set("Authorization", token)
+	if w := serve(s, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("access token after password change = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestUpdateUserRequiresRoleOfTarget(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	root := st.addUser("root", dbmodel.UserRoleSuperAdmin)
+	admin := st.addUser("admin", dbmodel.UserRoleAdministrator)
+	reader := st.addUser("reader", dbmodel.UserRoleReader)
+
+	tests := []struct {
+		name   string
+		caller dbmodel.UserDTO
+		target dbmodel.UserDTO
+		body   string
+		want   int
+	}{
+		{name: "password of a super administrator", caller: admin, target: root, body: `{"password": "Correct-horse-battery-9"}`, want: http.StatusForbidden},
+		{name: "email of a super administrator", caller: admin, target: root, body: `{"email": "mine@example.com"}`, want: http.StatusForbidden},
+		{name: "username of a super administrator", caller: admin, target: root, body: `{"username": "gone"}`, want: http.StatusForbidden},
+		{name: "password of a reader", caller: admin, target: reader, body: `{"password": "Correct-horse-battery-9"}`, want: http.StatusOK},
+		{name: "own username", caller: admin, target: admin, body: `{"username": "admin2"}`, want: http.StatusOK},
+		{name: "super administrator edits administrator", caller: root, target: admin, body: `{"username": "admin3"}`, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRequest("PUT", "/users/"+tt.target.Id, tt.body)
+			r.Header.Set("Authorization", bearer(t, s, tt.caller))
+			if w := serve(s, r); w.Code != tt.want {
+				t.Errorf("PUT /users/{id} = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	if dto, _ := st.users.GetUserByID(root.Id); dto.Username != "root" || dto.Password != root.Password {
+		t.Error("super administrator was changed by an administrator")
+	}
+}
+
+func TestUserResponsesHidePasswords(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	admin := st.addUser("admin", dbmodel.UserRoleAdministrator)
+	st.setPassword(t, s, admin, "Correct-horse-battery-9")
+
+	for _, target := range []string{"/users", "/users/" + admin.Id} {
+		r := newRequest("GET", target, "")
+		r.Header.Set("Authorization", bearer(t, s, admin))
+		w := serve(s, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d, want %d: %s", target, w.Code, http.StatusOK, w.Body)
+		}
+		if strings.Contains(w.Body.String(), "password") {
+			t.Errorf("GET %s exposes the password hash: %s", target, w.Body)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/model"
+)
+
+type bookRevision struct {
+	Revision      int             `json:"revision"`
+	ChangedBy     string          `json:"changedBy,omitempty"`
+	ChangedByName string          `json:"changedByName,omitempty"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	Changes       json.RawMessage `json:"changes,omitempty"`
+}
+
+func (h *booksHandler) recordRevision(r *http.Request, before, after model.Book) error {
+	if before.Id != "" {
+		revisions, err := h.revisions.GetBookRevisions(before.Id)
+		if err != nil {
+			return err
+		}
+		if len(revisions) == 0 {
+			if err = h.createRevision(before, "", ""); err != nil {
+				return err
+			}
+		}
+	}
+
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+	userID, _ := props["id"].(string)
+	username, _ := props["username"].(string)
+	return h.createRevision(after, userID, username)
+}
+
+func (h *booksHandler) createRevision(book model.Book, userID, username string) error {
+	snapshot, err := json.Marshal(book)
+	if err != nil {
+		return err
+	}
+
+	dto := dbmodel.BookRevisionDTO{
+		Id:            uuid.NewString(),
+		BookId:        book.Id,
+		Snapshot:      snapshot,
+		ChangedBy:     userID,
+		ChangedByName: username,
+		CreatedAt:     time.Now(),
+	}
+	_, err = h.revisions.CreateBookRevision(dto)
+	return err
+}
+
+func (h *booksHandler) getBookHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("book id is required"))
+		return
+	}
+
+	if _, err := bookInTenant(h.storage, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("book with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dtos, err := h.revisions.GetBookRevisions(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	history := make([]bookRevision, len(dtos))
+	var previous json.RawMessage
+	for i, dto := range dtos {
+		var before interface{}
+		if previous != nil {
+			before = previous
+		}
+		changes, err := auditDiff(before, dto.Snapshot)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		history[len(dtos)-1-i] = bookRevision{
+			Revision:      dto.Revision,
+			ChangedBy:     dto.ChangedBy,
+			ChangedByName: dto.ChangedByName,
+			CreatedAt:     dto.CreatedAt,
+			Changes:       changes,
+		}
+		previous = dto.Snapshot
+	}
+
+	body, err := json.Marshal(history)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *booksHandler) revertBook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" || vars["revision"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("book id and revision are required"))
+		return
+	}
+	revision, err := strconv.Atoi(vars["revision"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("invalid revision: %s", vars["revision"]))
+		return
+	}
+
+	dto, err := bookInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("book with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	rev, err := h.revisions.GetBookRevision(dto.Id, revision)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("revision %d of book with id: %s not found, %w", revision, dto.Id, err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var book model.Book
+	if err = json.Unmarshal(rev.Snapshot, &book); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	before, err := h.catalog.BookWithRelations(dto)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dto.Title = book.Title
+	dto.Isbn10 = book.Isbn10
+	dto.Isbn13 = book.Isbn13
+	dto.Publisher = book.Publisher
+	dto.PublicationYear = book.PublicationYear
+	dto.Edition = book.Edition
+	dto.Language = book.Language
+	dto.Series = book.Series
+	dto.SeriesIndex = book.SeriesIndex
+	dto.Description = book.Description
+	if err = h.storage.UpdateBook(dto); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	relations := model.Book{
+		Id:       dto.Id,
+		TenantId: dto.TenantId,
+		Authors:  make([]model.Author, 0),
+		Subjects: make([]model.Subject, 0),
+		Tags:     make([]model.Tag, 0),
+	}
+	for _, author := range book.Authors {
+		relations.Authors = append(relations.Authors, model.Author{Name: author.Name})
+	}
+	for _, subject := range book.Subjects {
+		relations.Subjects = append(relations.Subjects, model.Subject{Name: subject.Name})
+	}
+	for _, tag := range book.Tags {
+		relations.Tags = append(relations.Tags, model.Tag{Name: tag.Name})
+	}
+	if err = h.catalog.SetBookRelations(relations); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	after, err := h.catalog.BookWithRelations(dto)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err = h.recordRevision(r, before, after); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditBookRevert, "book", dto.Id, before, after)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "book reverted to revision " + strconv.Itoa(revision)}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
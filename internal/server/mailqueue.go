@@ -0,0 +1,45 @@
+package server
+
+import (
+	"errors"
+	"log"
+)
+
+const (
+	mailQueueSize = 100
+	mailWorkers   = 2
+)
+
+var errMailQueueFull = errors.New("mail queue is full")
+
+// mailQueue sends mail in the background with a fixed number of workers.
+// Requests that would grow the backlog beyond its size are dropped instead
+// of piling up goroutines.
+type mailQueue struct {
+	jobs chan func() error
+}
+
+func newMailQueue(size, workers int) *mailQueue {
+	q := &mailQueue{jobs: make(chan func() error, size)}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+func (q *mailQueue) enqueue(job func() error) error {
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		return errMailQueueFull
+	}
+}
+
+func (q *mailQueue) work() {
+	for job := range q.jobs {
+		if err := job(); err != nil {
+			log.Println("unable to send mail:", err)
+		}
+	}
+}
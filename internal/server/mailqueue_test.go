@@ -0,0 +1,65 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+func TestMailQueue(t *testing.T) {
+	q := newMailQueue(1, 0)
+	if err := q.enqueue(func() error { return nil }); err != nil {
+		t.Fatalf("enqueue = %v, want nil", err)
+	}
+	if err := q.enqueue(func() error { return nil }); err != errMailQueueFull {
+		t.Errorf("enqueue on a full queue = %v, want %v", err, errMailQueueFull)
+	}
+
+	q = newMailQueue(1, 1)
+	done := make(chan struct{})
+	if err := q.enqueue(func() error {
+		close(done)
+		return errors.New("smtp is down")
+	}); err != nil {
+		t.Fatalf("enqueue = %v, want nil", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("queued mail was not sent")
+	}
+}
+
+func TestRequestPasswordResetIsQueued(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	mailer := &fakeMailer{}
+	s.authHandler.mailer = mailer
+	s.authHandler.mails = newMailQueue(1, 0)
+	users := make([]dbmodel.UserDTO, 0)
+	for _, username := range []string{"alice", "bob", "carol"} {
+		dto := st.addUser(username, dbmodel.UserRoleReader)
+		dto.Email = username + "@example.com"
+		st.users.UpdateUser(dto)
+		users = append(users, dto)
+
+		r := newRequest("POST", "/password/reset", `{"username": "`+username+`"}`)
+		if w := serve(s, r); w.Code != http.StatusAccepted {
+			t.Fatalf("POST /password/reset = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body)
+		}
+	}
+	if len(s.authHandler.mails.jobs) != 1 {
+		t.Errorf("%d password resets are queued, want the queue size of 1", len(s.authHandler.mails.jobs))
+	}
+
+	job := <-s.authHandler.mails.jobs
+	if err := job(); err != nil {
+		t.Fatal(err)
+	}
+	if msg, _ := mailer.last(t); msg.To != users[0].Email {
+		t.Errorf("password reset was sent to %q, want %q", msg.To, users[0].Email)
+	}
+}
@@ -0,0 +1,414 @@
+package server
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/model"
+	"github.com/szwedm/cloud-library/internal/oidc"
+)
+
+const (
+	loginStateTTL    = 10 * time.Minute
+	loginStateCookie = "oidc_state"
+)
+
+type identityProvider interface {
+	Enabled() bool
+	Issuer() string
+	AuthCodeURL(state, nonce, verifier string) (string, error)
+	Exchange(code, verifier, nonce string) (jwt.MapClaims, error)
+}
+
+func (h *authHandler) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	url, err := h.startLogin(w, r, "")
+	if err != nil {
+		if errors.Is(err, oidc.ErrNotConfigured) {
+			respondWithError(w, http.StatusNotFound, err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+func (h *authHandler) oidcLink(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+	userID, _ := props["id"].(string)
+
+	url, err := h.startLogin(w, r, userID)
+	if err != nil {
+		if errors.Is(err, oidc.ErrNotConfigured) {
+			respondWithError(w, http.StatusNotFound, err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type response struct {
+		Url string `json:"url"`
+	}
+	resp := response{Url: url}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if idpErr := query.Get("error"); idpErr != "" {
+		respondWithError(w, http.StatusUnauthorized, fmt.Errorf("identity provider returned an error: %s %s", idpErr, query.Get("error_description")))
+		return
+	}
+	if query.Get("state") == "" || query.Get("code") == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("state and code are required"))
+		return
+	}
+
+	// the state must come back to the browser that started the login,
+	// otherwise an attacker could complete their own login in a victim's
+	// browser
+	cookie, err := r.Cookie(loginStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(query.Get("state"))) != 1 {
+		respondWithError(w, http.StatusUnauthorized, errors.New("login state does not belong to this browser"))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginStateCookie,
+		Path:     "/oidc/callback",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	tenant, err := h.tenants.active(r)
+	if err != nil {
+		respondWithTenantError(w, err)
+		return
+	}
+
+	state, err := h.identities.ConsumeLoginState(query.Get("state"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusUnauthorized, errors.New("unknown or expired login state"))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	claims, err := h.provider.Exchange(query.Get("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+	subject, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+
+	identity, err := h.identities.GetIdentity(h.provider.Issuer(), subject)
+	if err != nil && err != sql.ErrNoRows {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var dto dbmodel.UserDTO
+	switch {
+	case state.UserId != "":
+		linked := err == nil
+		dto, err = h.storage.GetUserByID(state.UserId)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if dto.TenantId != tenant.Id {
+			respondWithError(w, http.StatusUnauthorized, errInvalidCredentials)
+			return
+		}
+		if linked && identity.UserId != state.UserId {
+			respondWithError(w, http.StatusConflict, errors.New("identity is already linked to another account"))
+			return
+		}
+		if !linked {
+			if err = h.createIdentity(dto.Id, subject, email); err != nil {
+				respondWithError(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+	case err == nil:
+		dto, err = h.storage.GetUserByID(identity.UserId)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if dto.TenantId != tenant.Id {
+			respondWithError(w, http.StatusUnauthorized, errInvalidCredentials)
+			return
+		}
+		if role, ok := roleFromClaims(claims); ok && role != dto.Role {
+			dto.Role = role
+			dto.TokenVersion++
+			if err = h.storage.UpdateUser(dto); err != nil {
+				respondWithError(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+	default:
+		dto, err = h.provisionUser(tenant.Id, claims)
+		if err != nil {
+			if errors.Is(err, errUsernameTaken) {
+				respondWithError(w, http.StatusConflict, err)
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err = h.createIdentity(dto.Id, subject, email); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if dto.Status != "" && dto.Status != dbmodel.UserStatusActive {
+		respondWithError(w, http.StatusForbidden, errAccountInactive)
+		return
+	}
+
+	if h.challengeTwoFactor(w, dto, r.UserAgent()) {
+		return
+	}
+
+	sessionID, err := h.createSession(dto.Id, r.UserAgent())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.security(r, dto.TenantId, dto.Username, dto.Id, auditSignin)
+
+	h.respondWithTokens(w, http.StatusCreated, dto, sessionID)
+}
+
+func (h *authHandler) getIdentities(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+	userID, _ := props["id"].(string)
+
+	dtos, err := h.identities.GetIdentitiesByUserID(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	body, err := json.Marshal(dtos)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) deleteIdentityByID(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("identity id is required"))
+		return
+	}
+
+	identity, err := h.identities.GetIdentityByID(vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("identity with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if identity.UserId != props["id"] {
+		respondWithError(w, http.StatusNotFound, fmt.Errorf("identity with id: %s not found", vars["id"]))
+		return
+	}
+	if identity.Issuer == ldapIssuer {
+		respondWithError(w, http.StatusConflict, errors.New("directory accounts cannot be unlinked"))
+		return
+	}
+
+	if err = h.identities.DeleteIdentityByID(identity.Id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "identity unlinked"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) startLogin(w http.ResponseWriter, r *http.Request, userID string) (string, error) {
+	if !h.provider.Enabled() {
+		return "", oidc.ErrNotConfigured
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+
+	url, err := h.provider.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		return "", err
+	}
+
+	dto := dbmodel.LoginStateDTO{
+		State:     state,
+		Nonce:     nonce,
+		Verifier:  verifier,
+		UserId:    userID,
+		ExpiresAt: time.Now().Add(loginStateTTL),
+	}
+	if err = h.identities.CreateLoginState(dto); err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginStateCookie,
+		Value:    state,
+		Path:     "/oidc/callback",
+		MaxAge:   int(loginStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return url, nil
+}
+
+func secureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func (h *authHandler) createIdentity(userID, subject, email string) error {
+	dto := dbmodel.IdentityDTO{
+		Id:        uuid.NewString(),
+		UserId:    userID,
+		Issuer:    h.provider.Issuer(),
+		Subject:   subject,
+		Email:     email,
+		CreatedAt: time.Now(),
+	}
+	_, err := h.identities.CreateIdentity(dto)
+	return err
+}
+
+func (h *authHandler) provisionUser(tenantID string, claims jwt.MapClaims) (dbmodel.UserDTO, error) {
+	username, _ := claims["preferred_username"].(string)
+	if username == "" {
+		username, _ = claims["email"].(string)
+	}
+	if username == "" {
+		username, _ = claims["sub"].(string)
+	}
+
+	if _, err := h.storage.GetUserByUsername(tenantID, username); err == nil {
+		return dbmodel.UserDTO{}, fmt.Errorf("%w: %s", errUsernameTaken, username)
+	}
+
+	hashedPassword, err := unusablePassword(h.hasher)
+	if err != nil {
+		return dbmodel.UserDTO{}, err
+	}
+
+	role, ok := roleFromClaims(claims)
+	if !ok {
+		role = model.UserRoleReader
+	}
+
+	email, _ := claims["email"].(string)
+	if email != "" {
+		if _, err := h.storage.GetUserByEmail(tenantID, email); err == nil {
+			email = ""
+		}
+	}
+
+	dto := dbmodel.UserDTO{
+		Id:       uuid.NewString(),
+		Username: username,
+		Password: hashedPassword,
+		Role:     role,
+		Email:    email,
+		Status:   dbmodel.UserStatusActive,
+		TenantId: tenantID,
+	}
+	if _, err = h.storage.CreateUser(dto); err != nil {
+		return dbmodel.UserDTO{}, err
+	}
+	return dto, nil
+}
+
+func roleFromClaims(claims jwt.MapClaims) (string, bool) {
+	adminValues := os.Getenv("APP_OIDC_ADMIN_VALUES")
+	if adminValues == "" {
+		return "", false
+	}
+
+	claim := os.Getenv("APP_OIDC_ROLE_CLAIM")
+	if claim == "" {
+		claim = "groups"
+	}
+
+	var values []string
+	switch v := claims[claim].(type) {
+	case string:
+		values = strings.Fields(v)
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	for _, admin := range strings.Split(adminValues, ",") {
+		for _, value := range values {
+			if strings.TrimSpace(admin) == value {
+				return model.UserRoleAdministrator, true
+			}
+		}
+	}
+	return model.UserRoleReader, true
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+// fakeProvider signs everyone in as subject, the protocol itself is
+// covered by the oidc package tests.
+type fakeProvider struct {
+	subject string
+}
+
+func (f *fakeProvider) Enabled() bool {
+	return true
+}
+
+func (f *fakeProvider) Issuer() string {
+	return "https://idp.example.com"
+}
+
+func (f *fakeProvider) AuthCodeURL(state, nonce, verifier string) (string, error) {
+	return f.Issuer() + "/authorize?" + url.Values{"state": {state}}.Encode(), nil
+}
+
+func (f *fakeProvider) Exchange(code, verifier, nonce string) (jwt.MapClaims, error) {
+	return jwt.MapClaims{"sub": f.subject, "preferred_username": f.subject}, nil
+}
+
+func stateFrom(t *testing.T, authURL string) string {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Query().Get("state")
+}
+
+func callbackRequest(state string, cookie *http.Cookie) *http.Request {
+	r := newRequest("GET", "/oidc/callback?"+url.Values{"state": {state}, "code": {"code"}}.Encode(), "")
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+func stateCookie(t *testing.T, w interface{ Result() *http.Response }) *http.Cookie {
+	t.Helper()
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == loginStateCookie {
+			return cookie
+		}
+	}
+	t.Fatal("no login state cookie was set")
+	return nil
+}
+
+func TestOIDCLoginStateCookie(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	s.authHandler.provider = &fakeProvider{subject: "carol"}
+
+	w := serve(s, newRequest("GET", "/oidc/login", ""))
+	if w.Code != http.StatusFound {
+		t.Fatalf("GET /oidc/login = %d, want %d: %s", w.Code, http.StatusFound, w.Body)
+	}
+	cookie := stateCookie(t, w)
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("login state cookie is not HttpOnly and SameSite=Lax: %v", cookie)
+	}
+	state := stateFrom(t, w.Header().Get("Location"))
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		want   int
+	}{
+		{name: "no cookie", want: http.StatusUnauthorized},
+		{name: "cookie of another login", cookie: &http.Cookie{Name: loginStateCookie, Value: "another"}, want: http.StatusUnauthorized},
+		{name: "cookie of this login", cookie: cookie, want: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(s, callbackRequest(state, tt.cookie)); w.Code != tt.want {
+				t.Errorf("GET /oidc/callback = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestOIDCLinkTenant(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	s.authHandler.provider = &fakeProvider{subject: "carol"}
+	acme := st.tenants.add("acme", dbmodel.TenantStatusActive)
+	carol := st.addTenantUser(acme.Id, "carol", dbmodel.UserRoleReader)
+
+	r := newRequest("POST", "/oidc/link", "")
+	r.Header.Set("Authorization", bearer(t, s, carol))
+	w := serve(s, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /oidc/link = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var resp struct {
+		Url string `json:"url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	cookie := stateCookie(t, w)
+
+	// the link finishes on the default tenant instead of acme
+	if w := serve(s, callbackRequest(stateFrom(t, resp.Url), cookie)); w.Code != http.StatusUnauthorized {
+		t.Errorf("link in another tenant = %d, want %d: %s", w.Code, http.StatusUnauthorized, w.Body)
+	}
+	if identities, _ := st.identities.GetIdentitiesByUserID(carol.Id); len(identities) != 0 {
+		t.Errorf("identity was linked from another tenant: %v", identities)
+	}
+}
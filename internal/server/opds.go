@@ -0,0 +1,188 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/catalog"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+type opdsHandler struct {
+	books    storage.Books
+	authors  storage.Authors
+	subjects storage.Subjects
+	access   *accessControl
+	catalog  *catalog.Catalog
+}
+
+func newOPDSHandler(b storage.Books, a storage.Authors, s storage.Subjects, t storage.Tags, ac *accessControl) *opdsHandler {
+	return &opdsHandler{
+		books:    b,
+		authors:  a,
+		subjects: s,
+		access:   ac,
+		catalog:  catalog.NewCatalog(a, s, t),
+	}
+}
+
+func (h *opdsHandler) getRoot(w http.ResponseWriter, r *http.Request) {
+	feed := catalog.NewOPDSFeed("urn:cloud-library:root", "cloud-library", "/opds", catalog.OPDSNavigationType)
+	feed.Entries = append(feed.Entries,
+		catalog.NewOPDSNavigationEntry("urn:cloud-library:books", "All books", "/opds/books", catalog.OPDSAcquisitionType),
+		catalog.NewOPDSNavigationEntry("urn:cloud-library:authors", "Authors", "/opds/authors", catalog.OPDSNavigationType),
+		catalog.NewOPDSNavigationEntry("urn:cloud-library:subjects", "Subjects", "/opds/subjects", catalog.OPDSNavigationType),
+	)
+
+	respondWithFeed(w, feed, catalog.OPDSNavigationType)
+}
+
+func (h *opdsHandler) getBooks(w http.ResponseWriter, r *http.Request) {
+	filter := dbmodel.BookFilter{Title: r.URL.Query().Get("q"), TenantId: tenantFromRequest(r)}
+	dtos, err := h.books.GetBooks(filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	title := "All books"
+	if filter.Title != "" {
+		title = "Search results for " + filter.Title
+	}
+	feed := catalog.NewOPDSFeed("urn:cloud-library:books", title, r.URL.RequestURI(), catalog.OPDSAcquisitionType)
+	h.respondWithBooks(w, r, feed, dtos)
+}
+
+func (h *opdsHandler) getAuthors(w http.ResponseWriter, r *http.Request) {
+	dtos, err := h.authors.GetAuthors(tenantFromRequest(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	feed := catalog.NewOPDSFeed("urn:cloud-library:authors", "Authors", "/opds/authors", catalog.OPDSNavigationType)
+	for _, dto := range dtos {
+		feed.Entries = append(feed.Entries,
+			catalog.NewOPDSNavigationEntry("urn:uuid:"+dto.Id, dto.Name, "/opds/authors/"+dto.Id, catalog.OPDSAcquisitionType))
+	}
+
+	respondWithFeed(w, feed, catalog.OPDSNavigationType)
+}
+
+func (h *opdsHandler) getAuthorBooks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("author id is required"))
+		return
+	}
+
+	author, err := authorInTenant(h.authors, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("author with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dtos, err := h.books.GetBooksByAuthorID(author.Id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	feed := catalog.NewOPDSFeed("urn:uuid:"+author.Id, author.Name, "/opds/authors/"+author.Id, catalog.OPDSAcquisitionType)
+	h.respondWithBooks(w, r, feed, dtos)
+}
+
+func (h *opdsHandler) getSubjects(w http.ResponseWriter, r *http.Request) {
+	dtos, err := h.subjects.GetSubjects(tenantFromRequest(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	feed := catalog.NewOPDSFeed("urn:cloud-library:subjects", "Subjects", "/opds/subjects", catalog.OPDSNavigationType)
+	for _, dto := range dtos {
+		title := dto.Name
+		if dto.Code != "" {
+			title = dto.Code + " " + dto.Name
+		}
+		feed.Entries = append(feed.Entries,
+			catalog.NewOPDSNavigationEntry("urn:uuid:"+dto.Id, title, "/opds/subjects/"+dto.Id, catalog.OPDSAcquisitionType))
+	}
+
+	respondWithFeed(w, feed, catalog.OPDSNavigationType)
+}
+
+func (h *opdsHandler) getSubjectBooks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("subject id is required"))
+		return
+	}
+
+	subject, err := subjectInTenant(h.subjects, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("subject with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dtos, err := h.books.GetBooksBySubjectID(subject.Id, true)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	feed := catalog.NewOPDSFeed("urn:uuid:"+subject.Id, subject.Name, "/opds/subjects/"+subject.Id, catalog.OPDSAcquisitionType)
+	h.respondWithBooks(w, r, feed, dtos)
+}
+
+func (h *opdsHandler) getSearchDescription(w http.ResponseWriter, r *http.Request) {
+	body, err := xml.MarshalIndent(catalog.NewOpenSearchDescription(), "", "  ")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithXML(w, http.StatusOK, catalog.OpenSearchType, append([]byte(xml.Header), body...))
+}
+
+func (h *opdsHandler) respondWithBooks(w http.ResponseWriter, r *http.Request, feed catalog.OPDSFeed, dtos []dbmodel.BookDTO) {
+	dtos, err := h.access.visibleBooks(r, dtos)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for _, dto := range dtos {
+		book, err := h.catalog.BookWithRelations(dto)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		feed.Entries = append(feed.Entries, catalog.NewOPDSBookEntry(book))
+	}
+
+	respondWithFeed(w, feed, catalog.OPDSAcquisitionType)
+}
+
+func respondWithFeed(w http.ResponseWriter, feed catalog.OPDSFeed, contentType string) {
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithXML(w, http.StatusOK, contentType, append([]byte(xml.Header), body...))
+}
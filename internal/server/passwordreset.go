@@ -0,0 +1,231 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/mail"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+const defaultPasswordResetTTL = time.Hour
+
+type passwordResetRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type passwordResetConfirmation struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (h *authHandler) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	identifier := req.Username
+	if identifier == "" {
+		identifier = req.Email
+	}
+	if identifier == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("username or email is required"))
+		return
+	}
+
+	tenant, err := h.tenants.active(r)
+	if err != nil {
+		respondWithTenantError(w, err)
+		return
+	}
+
+	key := "reset:" + tenant.Id + ":" + strings.ToLower(strings.TrimSpace(identifier))
+	if err := h.throttle.attempt(key); err != nil {
+		respondWithThrottled(w, err)
+		return
+	}
+
+	var dto dbmodel.UserDTO
+	if req.Username != "" {
+		dto, err = h.storage.GetUserByUsername(tenant.Id, req.Username)
+	} else {
+		dto, err = h.storage.GetUserByEmail(tenant.Id, req.Email)
+	}
+	if err != nil {
+		if _, ok := err.(*storage.UserNotFoundErr); !ok {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if err == nil && dto.Email != "" {
+		err = h.mails.enqueue(func() error {
+			if err := h.sendPasswordReset(dto); err != nil {
+				return fmt.Errorf("password reset for user %s: %w", dto.Id, err)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("unable to queue password reset for user %s: %v", dto.Id, err)
+		}
+	}
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "if the account exists, a password reset email has been sent"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, body)
+}
+
+func (h *authHandler) confirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetConfirmation
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Token == "" || req.Password == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("token and password are required"))
+		return
+	}
+
+	reset, err := h.resets.GetPasswordReset(hashToken(req.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusBadRequest, errors.New("invalid or expired reset token"))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dto, err := h.storage.GetUserByID(reset.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusBadRequest, errors.New("invalid or expired reset token"))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err = h.passwords.Validate(dto.Username, req.Password); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err = h.resets.UsePasswordReset(reset.Hash); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusBadRequest, errors.New("invalid or expired reset token"))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	hashedPassword, err := h.hasher.Hash(req.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	dto.Password = hashedPassword
+	dto.TokenVersion++
+
+	if err = h.storage.UpdateUser(dto); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err = revokeCredentials(h.sessions, h.apiKeys, dto.Id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err = h.resets.DeletePasswordResetsByUserID(dto.Id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err = h.throttle.succeed(usernameKey(dto.TenantId, dto.Username)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.security(r, dto.TenantId, dto.Username, dto.Id, auditPasswordReset)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "password has been reset"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) sendPasswordReset(dto dbmodel.UserDTO) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	if err = h.resets.DeletePasswordResetsByUserID(dto.Id); err != nil {
+		return err
+	}
+
+	ttl := passwordResetTTL()
+	reset := dbmodel.PasswordResetDTO{
+		Hash:      hashToken(token),
+		UserId:    dto.Id,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err = h.resets.CreatePasswordReset(reset); err != nil {
+		return err
+	}
+
+	link := token
+	if base := os.Getenv("APP_PASSWORD_RESET_URL"); base != "" {
+		link = base + token
+	}
+
+	body := fmt.Sprintf("Hello %s,\n\n"+
+		"a password reset was requested for your cloud-library account.\n"+
+		"Use the following link or token within %s to choose a new password:\n\n"+
+		"%s\n\n"+
+		"If you did not request a reset, you can ignore this message.\n", dto.Username, ttl, link)
+
+	return h.mailer.Send(mail.Message{
+		To:      dto.Email,
+		Subject: "cloud-library password reset",
+		Body:    body,
+	})
+}
+
+func passwordResetTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("APP_PASSWORD_RESET_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return defaultPasswordResetTTL
+}
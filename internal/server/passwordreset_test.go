@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+func TestConfirmPasswordResetRevokesCredentials(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	alice := st.addUser("alice", dbmodel.UserRoleReader)
+	_, refreshToken := signIn(t, s, alice)
+	key := st.addAPIKey(alice)
+	st.resets.CreatePasswordReset(dbmodel.PasswordResetDTO{
+		Hash:      hashToken("reset-token"),
+		UserId:    alice.Id,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	r := newRequest("POST", "/password/reset/confirm", `{"token": "reset-token", "password": "Correct-horse-battery-9"}`)
+	if w := serve(s, r); w.Code != http.StatusOK {
+		t.Fatalf("POST /password/reset/confirm = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	r = newRequest("GET", "/tags", "")
+	r.Header.Set("X-API-Key", key)
+	if w := serve(s, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("api key after password reset = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if code, _ := refresh(s, refreshToken); code != http.StatusUnauthorized {
+		t.Errorf("refresh after password reset = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+var (
+	errUserQuotaExceeded   = errors.New("user storage quota exceeded")
+	errTenantQuotaExceeded = errors.New("tenant storage quota exceeded")
+)
+
+type quotas struct {
+	books   storage.Books
+	tenants *tenantResolver
+	user    int64
+	tenant  int64
+}
+
+func newQuotas(b storage.Books, t *tenantResolver) *quotas {
+	user, _ := strconv.ParseInt(os.Getenv("APP_USER_QUOTA_BYTES"), 10, 64)
+	tenant, _ := strconv.ParseInt(os.Getenv("APP_TENANT_QUOTA_BYTES"), 10, 64)
+	return &quotas{
+		books:   b,
+		tenants: t,
+		user:    user,
+		tenant:  tenant,
+	}
+}
+
+func (q *quotas) tenantQuota(tenantID string) (int64, error) {
+	tenant, err := q.tenants.byID(tenantID)
+	if err != nil {
+		return 0, err
+	}
+	if tenant.QuotaBytes > 0 {
+		return tenant.QuotaBytes, nil
+	}
+	return q.tenant, nil
+}
+
+func (q *quotas) check(tenantID, userID string, size int64) error {
+	if q.user > 0 {
+		used, err := q.books.GetUploaderStorageUsage(userID)
+		if err != nil {
+			return err
+		}
+		if used+size > q.user {
+			return errUserQuotaExceeded
+		}
+	}
+
+	limit, err := q.tenantQuota(tenantID)
+	if err != nil {
+		return err
+	}
+	if limit > 0 {
+		used, err := q.books.GetStorageUsage(tenantID)
+		if err != nil {
+			return err
+		}
+		if used+size > limit {
+			return errTenantQuotaExceeded
+		}
+	}
+	return nil
+}
+
+func respondWithQuotaError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errUserQuotaExceeded):
+		respondWithError(w, http.StatusRequestEntityTooLarge, err)
+	case errors.Is(err, errTenantQuotaExceeded):
+		respondWithError(w, http.StatusInsufficientStorage, err)
+	default:
+		respondWithError(w, http.StatusInternalServerError, err)
+	}
+}
+
+type storageUsage struct {
+	TenantId   string          `json:"tenantId"`
+	UsedBytes  int64           `json:"usedBytes"`
+	QuotaBytes int64           `json:"quotaBytes"`
+	Users      []uploaderUsage `json:"users"`
+}
+
+type uploaderUsage struct {
+	UserId     string `json:"userId,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Books      int    `json:"books"`
+	UsedBytes  int64  `json:"usedBytes"`
+	QuotaBytes int64  `json:"quotaBytes"`
+}
+
+type usageHandler struct {
+	quotas *quotas
+	users  storage.Users
+}
+
+func newUsageHandler(q *quotas, u storage.Users) *usageHandler {
+	return &usageHandler{
+		quotas: q,
+		users:  u,
+	}
+}
+
+func (h *usageHandler) getStorageUsage(w http.ResponseWriter, r *http.Request) {
+	tenantID := tenantFromRequest(r)
+
+	quota, err := h.quotas.tenantQuota(tenantID)
+	if err != nil {
+		respondWithTenantError(w, err)
+		return
+	}
+
+	dtos, err := h.quotas.books.GetStorageUsageByUploader(tenantID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := storageUsage{
+		TenantId:   tenantID,
+		QuotaBytes: quota,
+		Users:      make([]uploaderUsage, 0, len(dtos)),
+	}
+	for _, dto := range dtos {
+		usage := uploaderUsage{
+			UserId:    dto.UserId,
+			Books:     dto.Books,
+			UsedBytes: dto.Bytes,
+		}
+		if dto.UserId != "" {
+			user, err := h.users.GetUserByID(dto.UserId)
+			if err != nil && err != sql.ErrNoRows {
+				respondWithError(w, http.StatusInternalServerError, err)
+				return
+			}
+			usage.Username = user.Username
+			usage.QuotaBytes = h.quotas.user
+		}
+		resp.UsedBytes += dto.Bytes
+		resp.Users = append(resp.Users, usage)
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/mail"
+	"github.com/szwedm/cloud-library/internal/model"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+const defaultEmailVerificationTTL = 24 * time.Hour
+
+type verificationRequest struct {
+	Token string `json:"token"`
+	Email string `json:"email"`
+}
+
+func (h *usersHandler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req verificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Token == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("token is required"))
+		return
+	}
+
+	verification, err := h.verifications.UseEmailVerification(hashToken(req.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusBadRequest, errors.New("invalid or expired verification token"))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dto, err := h.storage.GetUserByID(verification.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusBadRequest, errors.New("invalid or expired verification token"))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "email verified"}
+
+	if verification.Email != "" && !strings.EqualFold(verification.Email, dto.Email) {
+		if existing, err := h.storage.GetUserByEmail(dto.TenantId, verification.Email); err == nil && existing.Id != dto.Id {
+			respondWithError(w, http.StatusConflict, errors.New("email already in use"))
+			return
+		} else if _, ok := err.(*storage.UserNotFoundErr); err != nil && !ok {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		dto.Email = verification.Email
+		if err = h.storage.UpdateUser(dto); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		resp.Msg = "email address changed"
+	}
+
+	if dto.Status == dbmodel.UserStatusPendingVerification {
+		dto.Status = dbmodel.UserStatusActive
+		if approvalRequired() {
+			dto.Status = dbmodel.UserStatusPendingApproval
+			resp.Msg = "email verified, the account is awaiting administrator approval"
+		}
+		if err = h.storage.UpdateUser(dto); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if err = h.verifications.DeleteEmailVerificationsByUserID(dto.Id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *usersHandler) resendVerification(w http.ResponseWriter, r *http.Request) {
+	var req verificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Email == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("email is required"))
+		return
+	}
+
+	tenant, err := h.tenants.active(r)
+	if err != nil {
+		respondWithTenantError(w, err)
+		return
+	}
+
+	key := "verify:" + tenant.Id + ":" + strings.ToLower(strings.TrimSpace(req.Email))
+	if err := h.throttle.attempt(key); err != nil {
+		respondWithThrottled(w, err)
+		return
+	}
+
+	dto, err := h.storage.GetUserByEmail(tenant.Id, req.Email)
+	if err != nil {
+		if _, ok := err.(*storage.UserNotFoundErr); !ok {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if err == nil && dto.Status == dbmodel.UserStatusPendingVerification {
+		if err = h.sendVerification(dto); err != nil {
+			log.Printf("unable to send verification email to user %s: %v", dto.Id, err)
+		}
+	}
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "if the account awaits verification, a new email has been sent"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, body)
+}
+
+func (h *usersHandler) approveUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("user id is required"))
+		return
+	}
+
+	dto, err := userInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("user with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if dto.Status != dbmodel.UserStatusPendingApproval {
+		respondWithError(w, http.StatusConflict, errors.New("user is not awaiting approval"))
+		return
+	}
+
+	before := model.UserFromDTO(dto)
+	dto.Status = dbmodel.UserStatusActive
+	if err = h.storage.UpdateUser(dto); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.audit.record(r, auditUserApprove, "user", dto.Id, before, model.UserFromDTO(dto))
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "user approved"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *usersHandler) sendVerification(dto dbmodel.UserDTO) error {
+	return h.sendVerificationMail(dto, dto.Email, "thank you for registering with cloud-library.\n")
+}
+
+// sendEmailChange asks the owner of the new address to confirm it, the
+// account keeps its current address until the link is used.
+func (h *usersHandler) sendEmailChange(dto dbmodel.UserDTO, email string) error {
+	return h.sendVerificationMail(dto, email, "a change of your cloud-library email address has been requested.\n")
+}
+
+func (h *usersHandler) sendVerificationMail(dto dbmodel.UserDTO, email, intro string) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	if err = h.verifications.DeleteEmailVerificationsByUserID(dto.Id); err != nil {
+		return err
+	}
+
+	ttl := emailVerificationTTL()
+	verification := dbmodel.EmailVerificationDTO{
+		Hash:      hashToken(token),
+		UserId:    dto.Id,
+		Email:     email,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err = h.verifications.CreateEmailVerification(verification); err != nil {
+		return err
+	}
+
+	link := token
+	if base := os.Getenv("APP_EMAIL_VERIFICATION_URL"); base != "" {
+		link = base + token
+	}
+
+	body := fmt.Sprintf("Hello %s,\n\n"+
+		"%s"+
+		"Use the following link or token within %s to verify your email address:\n\n"+
+		"%s\n", dto.Username, intro, ttl, link)
+
+	return h.mailer.Send(mail.Message{
+		To:      email,
+		Subject: "cloud-library email verification",
+		Body:    body,
+	})
+}
+
+func registrationOpen() bool {
+	return os.Getenv("APP_REGISTRATION") != "closed"
+}
+
+func approvalRequired() bool {
+	return os.Getenv("APP_REGISTRATION_APPROVAL") == "true"
+}
+
+func emailVerificationTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("APP_EMAIL_VERIFICATION_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return defaultEmailVerificationTTL
+}
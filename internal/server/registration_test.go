@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+func TestUpdateUserEmailRequiresVerification(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	mailer := &fakeMailer{}
+	s.usersHandler.mailer = mailer
+	alice := st.addUser("alice", dbmodel.UserRoleReader)
+	alice.Email = "alice@example.com"
+	st.users.UpdateUser(alice)
+
+	r := newRequest("PUT", "/users/"+alice.Id, `{"email": "attacker@example.com"}`)
+	r.Header.Set("Authorization", bearer(t, s, alice))
+	if w := serve(s, r); w.Code != http.StatusOK {
+		t.Fatalf("PUT /users/{id} = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if dto, _ := st.users.GetUserByID(alice.Id); dto.Email != "alice@example.com" {
+		t.Errorf("email changed to %q before verification", dto.Email)
+	}
+
+	msg, token := mailer.last(t)
+	if msg.To != "attacker@example.com" {
+		t.Errorf("verification sent to %q, want the new address", msg.To)
+	}
+
+	w := serve(s, newRequest("POST", "/users/verify", `{"token": "`+token+`"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /users/verify = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if dto, _ := st.users.GetUserByID(alice.Id); dto.Email != "attacker@example.com" || dto.Status != dbmodel.UserStatusActive {
+		t.Errorf("after verification email = %q, status = %q", dto.Email, dto.Status)
+	}
+}
+
+func TestApproveUser(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	admin := st.addUser("admin", dbmodel.UserRoleAdministrator)
+
+	tests := []struct {
+		status string
+		want   int
+	}{
+		{status: dbmodel.UserStatusPendingApproval, want: http.StatusOK},
+		{status: dbmodel.UserStatusPendingVerification, want: http.StatusConflict},
+		{status: dbmodel.UserStatusActive, want: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			dto := st.addUser("user-"+tt.status, dbmodel.UserRoleReader)
+			dto.Status = tt.status
+			st.users.UpdateUser(dto)
+
+			r := newRequest("POST", "/users/"+dto.Id+"/approve", "")
+			r.Header.Set("Authorization", bearer(t, s, admin))
+			if w := serve(s, r); w.Code != tt.want {
+				t.Errorf("approve %s user = %d, want %d: %s", tt.status, w.Code, tt.want, w.Body)
+			}
+			if got, _ := st.users.GetUserByID(dto.Id); tt.want != http.StatusOK && got.Status != tt.status {
+				t.Errorf("status changed from %q to %q", tt.status, got.Status)
+			}
+		})
+	}
+}
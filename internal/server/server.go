@@ -2,76 +2,341 @@ package server
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go/v4"
 	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/mail"
+	"github.com/szwedm/cloud-library/internal/oidc"
+	"github.com/szwedm/cloud-library/internal/password"
+	"github.com/szwedm/cloud-library/internal/rbac"
+	"github.com/szwedm/cloud-library/internal/signing"
 	"github.com/szwedm/cloud-library/internal/storage"
 )
 
 const UUIDRegex string = `[0-9a-fA-F]{8}\-[0-9a-fA-F]{4}\-[0-9a-fA-F]{4}\-[0-9a-fA-F]{4}\-[0-9a-fA-F]{12}`
 
 type server struct {
-	router       *mux.Router
-	booksHandler *booksHandler
-	usersHandler *usersHandler
-	authHandler  *authHandler
+	router             *mux.Router
+	booksHandler       *booksHandler
+	authorsHandler     *authorsHandler
+	subjectsHandler    *subjectsHandler
+	tagsHandler        *tagsHandler
+	opdsHandler        *opdsHandler
+	usersHandler       *usersHandler
+	authHandler        *authHandler
+	collectionsHandler *collectionsHandler
+	aclHandler         *aclHandler
+	groupsHandler      *groupsHandler
+	tenantsHandler     *tenantsHandler
+	usageHandler       *usageHandler
+	auditHandler       *auditHandler
+	trashHandler       *trashHandler
+	tenants            *tenantResolver
+	trash              *trash
+	keyring            *signing.Keyring
+	policy             *rbac.Policy
 }
 
-func NewServer(booksStorage storage.Books, usersStorage storage.Users) *server {
+func NewServer(booksStorage storage.Books, authorsStorage storage.Authors, subjectsStorage storage.Subjects, tagsStorage storage.Tags, importsStorage storage.Imports, usersStorage storage.Users, sessionsStorage storage.Sessions, signingKeysStorage storage.SigningKeys, identitiesStorage storage.Identities, twoFactorStorage storage.TwoFactor, loginAttemptsStorage storage.LoginAttempts, passwordResetsStorage storage.PasswordResets, emailVerificationsStorage storage.EmailVerifications, collectionsStorage storage.Collections, aclStorage storage.ACL, groupsStorage storage.Groups, apiKeysStorage storage.APIKeys, tenantsStorage storage.Tenants, auditStorage storage.Audit, bookRevisionsStorage storage.BookRevisions) *server {
+	rotation, _ := time.ParseDuration(os.Getenv("APP_JWT_KEY_ROTATION"))
+	keyring, err := signing.NewKeyring(signingKeysStorage, os.Getenv("APP_JWT_SIGN_ALG"), rotation, os.Getenv("APP_JWT_KEY_ENCRYPTION_KEY"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mailer, err := mail.NewMailer(mail.Config{
+		Transport: os.Getenv("APP_MAIL_TRANSPORT"),
+		From:      os.Getenv("APP_MAIL_FROM"),
+		Host:      os.Getenv("APP_SMTP_HOST"),
+		Port:      os.Getenv("APP_SMTP_PORT"),
+		Username:  os.Getenv("APP_SMTP_USERNAME"),
+		Password:  os.Getenv("APP_SMTP_PASSWORD"),
+		Dir:       os.Getenv("APP_MAIL_DIR"),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	throttle := newThrottle(loginAttemptsStorage)
+	audit := newAuditor(auditStorage, throttle)
+
+	passwordConfig := password.NewConfig()
+	hasher, err := password.NewHasher(passwordConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	passwords, err := password.NewPolicy(passwordConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	policy, err := rbac.LoadPolicy(os.Getenv("APP_RBAC_POLICY"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tenants := newTenantResolver(tenantsStorage)
+	access := newAccessControl(aclStorage, booksStorage, policy)
+	quotas := newQuotas(booksStorage, tenants)
+	trash := newTrash(booksStorage, usersStorage, audit)
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:       os.Getenv("APP_OIDC_ISSUER"),
+		ClientID:     os.Getenv("APP_OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("APP_OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("APP_OIDC_REDIRECT_URL"),
+	})
+
 	return &server{
-		router:       mux.NewRouter(),
-		booksHandler: newBooksHandler(booksStorage),
-		usersHandler: newUsersHandler(usersStorage),
-		authHandler:  newAuthHandler(usersStorage),
+		router:             mux.NewRouter(),
+		booksHandler:       newBooksHandler(booksStorage, authorsStorage, subjectsStorage, tagsStorage, importsStorage, collectionsStorage, bookRevisionsStorage, access, quotas, audit),
+		authorsHandler:     newAuthorsHandler(authorsStorage),
+		subjectsHandler:    newSubjectsHandler(subjectsStorage),
+		tagsHandler:        newTagsHandler(tagsStorage),
+		opdsHandler:        newOPDSHandler(booksStorage, authorsStorage, subjectsStorage, tagsStorage, access),
+		usersHandler:       newUsersHandler(usersStorage, sessionsStorage, apiKeysStorage, policy, emailVerificationsStorage, mailer, throttle, hasher, passwords, tenants, audit),
+		authHandler:        newAuthHandler(usersStorage, sessionsStorage, identitiesStorage, groupsStorage, apiKeysStorage, twoFactorStorage, throttle, passwordResetsStorage, mailer, keyring, provider, hasher, passwords, tenants, audit),
+		collectionsHandler: newCollectionsHandler(collectionsStorage, booksStorage, audit),
+		aclHandler:         newACLHandler(aclStorage, booksStorage, collectionsStorage, usersStorage, groupsStorage, audit),
+		groupsHandler:      newGroupsHandler(groupsStorage, usersStorage, policy, audit),
+		tenantsHandler:     newTenantsHandler(tenantsStorage, usersStorage, booksStorage, audit),
+		usageHandler:       newUsageHandler(quotas, usersStorage),
+		auditHandler:       newAuditHandler(auditStorage),
+		trashHandler:       newTrashHandler(trash, policy),
+		tenants:            tenants,
+		trash:              trash,
+		keyring:            keyring,
+		policy:             policy,
 	}
 }
 
 func (s *server) registerBookPaths() {
-	s.router.HandleFunc("/books", s.corsMiddleware(s.middleware(s.booksHandler.getBooks))).Methods("GET", "OPTIONS")
-	s.router.HandleFunc("/books", s.corsMiddleware(s.middleware(s.booksHandler.createBook))).Methods("POST", "OPTIONS")
-	s.router.HandleFunc("/books/{id:"+UUIDRegex+"}", s.corsMiddleware(s.middleware(s.booksHandler.getBookByID))).Methods("GET", "OPTIONS")
-	s.router.HandleFunc("/books/{id:"+UUIDRegex+"}", s.corsMiddleware(s.middleware(s.booksHandler.updateBook))).Methods("PUT", "OPTIONS")
-	s.router.HandleFunc("/books/{id:"+UUIDRegex+"}", s.corsMiddleware(s.middleware(s.booksHandler.deleteBookByID))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/books", s.corsMiddleware(s.scopedMiddleware(rbac.BooksRead, s.booksHandler.getBooks))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/books", s.corsMiddleware(s.scopedMiddleware(rbac.BooksWrite, s.booksHandler.createBook))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/books/export", s.corsMiddleware(s.scopedMiddleware(rbac.BooksRead, s.booksHandler.exportBooks))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/books/import", s.corsMiddleware(s.scopedMiddleware(rbac.BooksImport, s.booksHandler.importBooks))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/books/import/records", s.corsMiddleware(s.scopedMiddleware(rbac.BooksImport, s.booksHandler.importRecords))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/books/import/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.BooksImport, s.booksHandler.getImportByID))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/books/{id:"+UUIDRegex+"}", s.corsMiddleware(s.basicAuthMiddleware(rbac.BooksRead, s.booksHandler.getBookByID))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/books/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.BooksWrite, s.booksHandler.updateBook))).Methods("PUT", "OPTIONS")
+	s.router.HandleFunc("/books/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.BooksDelete, s.booksHandler.deleteBookByID))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/books/{id:"+UUIDRegex+"}/history", s.corsMiddleware(s.scopedMiddleware(rbac.BooksWrite, s.booksHandler.getBookHistory))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/books/{id:"+UUIDRegex+"}/history/{revision:[0-9]+}/revert", s.corsMiddleware(s.scopedMiddleware(rbac.BooksWrite, s.booksHandler.revertBook))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/books/{id:"+UUIDRegex+"}/acl", s.corsMiddleware(s.scopedMiddleware(rbac.AclManage, s.aclHandler.getBookACL))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/books/{id:"+UUIDRegex+"}/acl", s.corsMiddleware(s.scopedMiddleware(rbac.AclManage, s.aclHandler.updateBookACL))).Methods("PUT", "OPTIONS")
+	s.router.HandleFunc("/books/{id:"+UUIDRegex+"}/grants", s.corsMiddleware(s.scopedMiddleware(rbac.AclManage, s.aclHandler.createBookGrant))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/books/{id:"+UUIDRegex+"}/grants/{grantId:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.AclManage, s.aclHandler.deleteBookGrant))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/trash/books", s.corsMiddleware(s.scopedMiddleware(rbac.BooksDelete, s.trashHandler.getTrashedBooks))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/trash/books/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.BooksDelete, s.trashHandler.deleteTrashedBook))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/trash/books/{id:"+UUIDRegex+"}/restore", s.corsMiddleware(s.scopedMiddleware(rbac.BooksDelete, s.trashHandler.restoreBook))).Methods("POST", "OPTIONS")
+}
+
+func (s *server) registerAuthorPaths() {
+	s.router.HandleFunc("/authors", s.corsMiddleware(s.scopedMiddleware(rbac.BooksRead, s.authorsHandler.getAuthors))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/authors/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.BooksRead, s.authorsHandler.getAuthorByID))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/authors/{id:"+UUIDRegex+"}/books", s.corsMiddleware(s.scopedMiddleware(rbac.BooksRead, s.booksHandler.getBooksByAuthorID))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/authors/{id:"+UUIDRegex+"}/merge", s.corsMiddleware(s.scopedMiddleware(rbac.CatalogManage, s.authorsHandler.mergeAuthors))).Methods("POST", "OPTIONS")
+}
+
+func (s *server) registerSubjectPaths() {
+	s.router.HandleFunc("/subjects", s.corsMiddleware(s.scopedMiddleware(rbac.BooksRead, s.subjectsHandler.getSubjects))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/subjects", s.corsMiddleware(s.scopedMiddleware(rbac.CatalogManage, s.subjectsHandler.createSubject))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/subjects/tree", s.corsMiddleware(s.scopedMiddleware(rbac.BooksRead, s.subjectsHandler.getSubjectTree))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/subjects/import", s.corsMiddleware(s.scopedMiddleware(rbac.CatalogManage, s.subjectsHandler.importSubjects))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/subjects/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.BooksRead, s.subjectsHandler.getSubjectByID))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/subjects/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.CatalogManage, s.subjectsHandler.updateSubject))).Methods("PUT", "OPTIONS")
+	s.router.HandleFunc("/subjects/{id:"+UUIDRegex+"}/books", s.corsMiddleware(s.scopedMiddleware(rbac.BooksRead, s.booksHandler.getBooksBySubjectID))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/subjects/{id:"+UUIDRegex+"}/merge", s.corsMiddleware(s.scopedMiddleware(rbac.CatalogManage, s.subjectsHandler.mergeSubjects))).Methods("POST", "OPTIONS")
+}
+
+func (s *server) registerTagPaths() {
+	s.router.HandleFunc("/tags", s.corsMiddleware(s.scopedMiddleware(rbac.BooksRead, s.tagsHandler.getTags))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/tags/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.BooksRead, s.tagsHandler.getTagByID))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/tags/{id:"+UUIDRegex+"}/books", s.corsMiddleware(s.scopedMiddleware(rbac.BooksRead, s.booksHandler.getBooksByTagID))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/tags/{id:"+UUIDRegex+"}/merge", s.corsMiddleware(s.scopedMiddleware(rbac.CatalogManage, s.tagsHandler.mergeTags))).Methods("POST", "OPTIONS")
+}
+
+func (s *server) registerCollectionPaths() {
+	s.router.HandleFunc("/collections", s.corsMiddleware(s.scopedMiddleware(rbac.BooksRead, s.collectionsHandler.getCollections))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/collections", s.corsMiddleware(s.scopedMiddleware(rbac.AclManage, s.collectionsHandler.createCollection))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/collections/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.BooksRead, s.collectionsHandler.getCollectionByID))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/collections/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.AclManage, s.collectionsHandler.updateCollection))).Methods("PUT", "OPTIONS")
+	s.router.HandleFunc("/collections/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.AclManage, s.collectionsHandler.deleteCollectionByID))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/collections/{id:"+UUIDRegex+"}/books", s.corsMiddleware(s.scopedMiddleware(rbac.BooksRead, s.booksHandler.getBooksByCollectionID))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/collections/{id:"+UUIDRegex+"}/books", s.corsMiddleware(s.scopedMiddleware(rbac.AclManage, s.collectionsHandler.addCollectionBooks))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/collections/{id:"+UUIDRegex+"}/books/{bookId:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.AclManage, s.collectionsHandler.removeCollectionBook))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/collections/{id:"+UUIDRegex+"}/grants", s.corsMiddleware(s.scopedMiddleware(rbac.AclManage, s.aclHandler.getCollectionGrants))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/collections/{id:"+UUIDRegex+"}/grants", s.corsMiddleware(s.scopedMiddleware(rbac.AclManage, s.aclHandler.createCollectionGrant))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/collections/{id:"+UUIDRegex+"}/grants/{grantId:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.AclManage, s.aclHandler.deleteCollectionGrant))).Methods("DELETE", "OPTIONS")
+}
+
+func (s *server) registerOPDSPaths() {
+	s.router.HandleFunc("/opds", s.corsMiddleware(s.basicAuthMiddleware(rbac.BooksRead, s.opdsHandler.getRoot))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/opds/search.xml", s.corsMiddleware(s.opdsHandler.getSearchDescription)).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/opds/books", s.corsMiddleware(s.basicAuthMiddleware(rbac.BooksRead, s.opdsHandler.getBooks))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/opds/authors", s.corsMiddleware(s.basicAuthMiddleware(rbac.BooksRead, s.opdsHandler.getAuthors))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/opds/authors/{id:"+UUIDRegex+"}", s.corsMiddleware(s.basicAuthMiddleware(rbac.BooksRead, s.opdsHandler.getAuthorBooks))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/opds/subjects", s.corsMiddleware(s.basicAuthMiddleware(rbac.BooksRead, s.opdsHandler.getSubjects))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/opds/subjects/{id:"+UUIDRegex+"}", s.corsMiddleware(s.basicAuthMiddleware(rbac.BooksRead, s.opdsHandler.getSubjectBooks))).Methods("GET", "OPTIONS")
 }
 
 func (s *server) registerUserPaths() {
-	s.router.HandleFunc("/users", s.corsMiddleware(s.middleware(s.usersHandler.getUsers))).Methods("GET", "OPTIONS")
-	s.router.HandleFunc("/users", s.corsMiddleware(s.usersHandler.createUser)).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/users", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.usersHandler.getUsers))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/users", s.corsMiddleware(s.optionalMiddleware(s.usersHandler.createUser))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/users/verify", s.corsMiddleware(s.usersHandler.verifyEmail)).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/users/verify/resend", s.corsMiddleware(s.usersHandler.resendVerification)).Methods("POST", "OPTIONS")
 	s.router.HandleFunc("/users/{id:"+UUIDRegex+"}", s.corsMiddleware(s.middleware(s.usersHandler.getUserByID))).Methods("GET", "OPTIONS")
 	s.router.HandleFunc("/users/{id:"+UUIDRegex+"}", s.corsMiddleware(s.middleware(s.usersHandler.updateUser))).Methods("PUT", "OPTIONS")
-	s.router.HandleFunc("/users/{id:"+UUIDRegex+"}", s.corsMiddleware(s.middleware(s.usersHandler.deleteUserByID))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/users/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.usersHandler.deleteUserByID))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/roles", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.getRoles))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/users/{id:"+UUIDRegex+"}/approve", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.usersHandler.approveUser))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/users/{id:"+UUIDRegex+"}/2fa", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.authHandler.resetTwoFactor))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/users/{id:"+UUIDRegex+"}/lockout", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.authHandler.deleteUserLockout))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/users/{id:"+UUIDRegex+"}/apikeys", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.authHandler.getUserAPIKeys))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/users/{id:"+UUIDRegex+"}/apikeys", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.authHandler.deleteUserAPIKeys))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/trash/users", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.trashHandler.getTrashedUsers))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/trash/users/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.trashHandler.deleteTrashedUser))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/trash/users/{id:"+UUIDRegex+"}/restore", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.trashHandler.restoreUser))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/audit", s.corsMiddleware(s.scopedMiddleware(rbac.AuditRead, s.auditHandler.getAuditEvents))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/audit/export", s.corsMiddleware(s.scopedMiddleware(rbac.AuditRead, s.auditHandler.exportAuditEvents))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/usage", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.usageHandler.getStorageUsage))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/lockouts", s.corsMiddleware(s.scopedMiddleware(rbac.TenantsManage, s.authHandler.getLockouts))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/lockouts", s.corsMiddleware(s.scopedMiddleware(rbac.TenantsManage, s.authHandler.deleteLockout))).Methods("DELETE", "OPTIONS")
+}
+
+func (s *server) registerGroupPaths() {
+	s.router.HandleFunc("/groups", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.groupsHandler.getGroups))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/groups", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.groupsHandler.createGroup))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/groups/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.groupsHandler.getGroupByID))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/groups/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.groupsHandler.updateGroup))).Methods("PUT", "OPTIONS")
+	s.router.HandleFunc("/groups/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.groupsHandler.deleteGroupByID))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/groups/{id:"+UUIDRegex+"}/members", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.groupsHandler.getGroupMembers))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/groups/{id:"+UUIDRegex+"}/members", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.groupsHandler.addGroupMembers))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/groups/{id:"+UUIDRegex+"}/members/{userId:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.groupsHandler.removeGroupMember))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/users/{id:"+UUIDRegex+"}/groups", s.corsMiddleware(s.scopedMiddleware(rbac.UsersManage, s.groupsHandler.getUserGroups))).Methods("GET", "OPTIONS")
+}
+
+func (s *server) registerTenantPaths() {
+	s.router.HandleFunc("/tenants", s.corsMiddleware(s.scopedMiddleware(rbac.TenantsManage, s.tenantsHandler.getTenants))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/tenants", s.corsMiddleware(s.scopedMiddleware(rbac.TenantsManage, s.tenantsHandler.createTenant))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/tenants/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.TenantsManage, s.tenantsHandler.getTenantByID))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/tenants/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.TenantsManage, s.tenantsHandler.updateTenant))).Methods("PUT", "OPTIONS")
+	s.router.HandleFunc("/tenants/{id:"+UUIDRegex+"}", s.corsMiddleware(s.scopedMiddleware(rbac.TenantsManage, s.tenantsHandler.deleteTenantByID))).Methods("DELETE", "OPTIONS")
 }
 
 func (s *server) registerAuthPaths() {
+	s.router.HandleFunc("/.well-known/jwks.json", s.corsMiddleware(s.authHandler.getJWKS)).Methods("GET", "OPTIONS")
 	s.router.HandleFunc("/signin", s.corsMiddleware(s.authHandler.signin)).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/password/reset", s.corsMiddleware(s.authHandler.requestPasswordReset)).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/password/reset/confirm", s.corsMiddleware(s.authHandler.confirmPasswordReset)).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/signin/2fa", s.corsMiddleware(s.authHandler.signinTwoFactor)).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/signout", s.corsMiddleware(s.middleware(s.authHandler.signout))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/token/refresh", s.corsMiddleware(s.authHandler.refreshToken)).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/me/sessions", s.corsMiddleware(s.middleware(s.authHandler.getSessions))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/me/sessions/{id:"+UUIDRegex+"}", s.corsMiddleware(s.middleware(s.authHandler.deleteSessionByID))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/me/apikeys", s.corsMiddleware(s.middleware(s.authHandler.getAPIKeys))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/me/apikeys", s.corsMiddleware(s.middleware(s.authHandler.createAPIKey))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/me/apikeys/{id:"+UUIDRegex+"}", s.corsMiddleware(s.middleware(s.authHandler.deleteAPIKeyByID))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/oidc/login", s.corsMiddleware(s.authHandler.oidcLogin)).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/oidc/callback", s.corsMiddleware(s.authHandler.oidcCallback)).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/oidc/link", s.corsMiddleware(s.middleware(s.authHandler.oidcLink))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/me/identities", s.corsMiddleware(s.middleware(s.authHandler.getIdentities))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/me/identities/{id:"+UUIDRegex+"}", s.corsMiddleware(s.middleware(s.authHandler.deleteIdentityByID))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/me/2fa", s.corsMiddleware(s.middleware(s.authHandler.getTwoFactor))).Methods("GET", "OPTIONS")
+	s.router.HandleFunc("/me/2fa", s.corsMiddleware(s.enrollmentMiddleware(s.authHandler.enrollTwoFactor))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/me/2fa", s.corsMiddleware(s.middleware(s.authHandler.disableTwoFactor))).Methods("DELETE", "OPTIONS")
+	s.router.HandleFunc("/me/2fa/verify", s.corsMiddleware(s.enrollmentMiddleware(s.authHandler.verifyTwoFactor))).Methods("POST", "OPTIONS")
+	s.router.HandleFunc("/me/2fa/recovery-codes", s.corsMiddleware(s.middleware(s.authHandler.regenerateRecoveryCodes))).Methods("POST", "OPTIONS")
 }
 
 func (s *server) middleware(next http.HandlerFunc) http.HandlerFunc {
+	return s.tokenMiddleware(next, "")
+}
+
+// scopedMiddleware is the only middleware that accepts API keys, so every route
+// reachable with a key is checked against the key's scopes.
+func (s *server) scopedMiddleware(permission rbac.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return s.tokenMiddleware(s.authorize(permission, next), "", tokenTypeAPIKey)
+}
+
+func (s *server) optionalMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" && apiKeyFromRequest(r) == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.middleware(next).ServeHTTP(w, r)
+	}
+}
+
+func (s *server) enrollmentMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return s.tokenMiddleware(next, "", tokenTypeEnrollment)
+}
+
+func (s *server) tokenMiddleware(next http.HandlerFunc, tokenTypes ...string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if key := apiKeyFromRequest(r); key != "" {
+			if !containsString(tokenTypes, tokenTypeAPIKey) {
+				respondWithError(w, http.StatusUnauthorized, errWrongTokenType)
+				return
+			}
+			claims, err := s.authHandler.apiKeyClaims(key)
+			if err != nil {
+				if errors.Is(err, errInvalidAPIKey) || errors.Is(err, errAccountInactive) {
+					respondWithError(w, http.StatusUnauthorized, err)
+					return
+				}
+				respondWithError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if err = s.scopeTenant(r, claims); err != nil {
+				respondWithTenantError(w, err)
+				return
+			}
+			ctx := context.WithValue(r.Context(), "props", claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		authHeader := strings.Split(r.Header.Get("Authorization"), "Bearer ")
 		if len(authHeader) != 2 {
 			respondWithError(w, http.StatusUnauthorized, errors.New("malformed token"))
 			return
 		}
 		jwtToken := authHeader[1]
-		token, err := jwt.Parse(jwtToken, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %s", t.Header["alg"])
-			}
-			return []byte(os.Getenv("APP_JWT_SIGN_KEY")), nil
-		})
+		token, err := jwt.Parse(jwtToken, s.keyring.Keyfunc)
 		if err != nil {
 			respondWithError(w, http.StatusUnauthorized, err)
 			return
 		}
 
 		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+			tokenType, _ := claims["typ"].(string)
+			if !containsString(tokenTypes, tokenType) {
+				respondWithError(w, http.StatusUnauthorized, errWrongTokenType)
+				return
+			}
+			if err := s.authHandler.validateClaims(claims); err != nil {
+				if errors.Is(err, errTokenRevoked) {
+					respondWithError(w, http.StatusUnauthorized, err)
+					return
+				}
+				respondWithError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if err := s.scopeTenant(r, claims); err != nil {
+				respondWithTenantError(w, err)
+				return
+			}
 			ctx := context.WithValue(r.Context(), "props", claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		} else {
@@ -82,6 +347,125 @@ func (s *server) middleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+func (s *server) basicAuthMiddleware(permission rbac.Permission, next http.HandlerFunc) http.HandlerFunc {
+	authorized := s.authorize(permission, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			if r.Header.Get("Authorization") == "" && apiKeyFromRequest(r) == "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="cloud-library"`)
+				respondWithError(w, http.StatusUnauthorized, errors.New("authentication required"))
+				return
+			}
+			s.scopedMiddleware(permission, next).ServeHTTP(w, r)
+			return
+		}
+
+		tenant, _, err := s.tenants.resolve(r)
+		if err != nil {
+			respondWithTenantError(w, err)
+			return
+		}
+
+		keys := s.authHandler.throttle.keys(r, tenant.Id, username)
+		if err := s.authHandler.throttle.attempt(keys...); err != nil {
+			respondWithThrottled(w, err)
+			return
+		}
+
+		dto, err := s.authHandler.authenticate(tenant.Id, username, password)
+		if err != nil {
+			if _, ok := err.(*storage.UserNotFoundErr); ok || errors.Is(err, errInvalidPassword) {
+				s.authHandler.audit.security(r, tenant.Id, username, "", auditSigninFailed)
+				if err = s.authHandler.throttle.fail(keys...); err != nil {
+					respondWithError(w, http.StatusInternalServerError, err)
+					return
+				}
+				w.Header().Set("WWW-Authenticate", `Basic realm="cloud-library"`)
+				respondWithError(w, http.StatusUnauthorized, errInvalidCredentials)
+				return
+			}
+			if errors.Is(err, errAccountInactive) {
+				respondWithError(w, http.StatusForbidden, err)
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if err = s.authHandler.throttle.forgive(keys...); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		tf, err := s.authHandler.twoFactor.GetTwoFactor(dto.Id)
+		if err != nil && err != sql.ErrNoRows {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err == nil && tf.Enabled {
+			respondWithError(w, http.StatusUnauthorized, errors.New("two-factor authentication is enabled, use a bearer token"))
+			return
+		}
+		if twoFactorRequired(dto.Role) {
+			respondWithError(w, http.StatusUnauthorized, fmt.Errorf("two-factor authentication is required for role %s, use a bearer token", dto.Role))
+			return
+		}
+
+		if err = s.authHandler.throttle.succeed(usernameKey(tenant.Id, username)); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		claims, err := s.authHandler.groupClaims(dto.Id)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		claims["id"] = dto.Id
+		claims["username"] = dto.Username
+		claims["role"] = dto.Role
+		claims["tenant"] = dto.TenantId
+		claims["authorized"] = true
+		if err = s.scopeTenant(r, claims); err != nil {
+			if errors.Is(err, errTenantMismatch) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="cloud-library"`)
+				respondWithError(w, http.StatusUnauthorized, errInvalidCredentials)
+				return
+			}
+			respondWithTenantError(w, err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), "props", claims)
+		authorized.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+func (s *server) authorize(permission rbac.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		props, _ := r.Context().Value("props").(jwt.MapClaims)
+		if !s.policy.AllowedAny(rolesFromClaims(props), permission) {
+			respondWithError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		if scopes, ok := props["scopes"]; ok && !rbac.Permits(stringsFromClaim(scopes), permission) {
+			respondWithError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+func (s *server) getRoles(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(s.policy.Roles())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
 func (s *server) corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -99,8 +483,31 @@ func (s *server) corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 }
 
 func (s *server) Run() {
+	if err := s.keyring.Rotate(); err != nil {
+		log.Fatal(err)
+	}
+	s.keyring.StartRotation(10 * time.Minute)
+	s.trash.startPurge(time.Hour)
+	s.authHandler.startSessionPurge(time.Hour)
+
 	s.registerBookPaths()
+	s.registerAuthorPaths()
+	s.registerSubjectPaths()
+	s.registerTagPaths()
+	s.registerCollectionPaths()
+	s.registerOPDSPaths()
 	s.registerUserPaths()
+	s.registerGroupPaths()
+	s.registerTenantPaths()
 	s.registerAuthPaths()
 	log.Fatal(http.ListenAndServe(":8080", s.router))
 }
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+func TestAPIKeyScopes(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	admin := st.addUser("admin", dbmodel.UserRoleAdministrator)
+	readOnly := st.addAPIKey(admin, "books:read")
+	unscoped := st.addAPIKey(admin)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		key    string
+		want   int
+	}{
+		{name: "scope permits route", method: "GET", target: "/tags", key: readOnly, want: http.StatusOK},
+		{name: "scope does not permit route", method: "GET", target: "/roles", key: readOnly, want: http.StatusUnauthorized},
+		{name: "unscoped key uses role", method: "GET", target: "/roles", key: unscoped, want: http.StatusOK},
+		{name: "user update", method: "PUT", target: "/users/" + admin.Id, key: unscoped, want: http.StatusUnauthorized},
+		{name: "sessions", method: "GET", target: "/me/sessions", key: readOnly, want: http.StatusUnauthorized},
+		{name: "revoke api key", method: "DELETE", target: "/me/apikeys/" + admin.Id, key: unscoped, want: http.StatusUnauthorized},
+		{name: "disable 2fa", method: "DELETE", target: "/me/2fa", key: unscoped, want: http.StatusUnauthorized},
+		{name: "link identity", method: "POST", target: "/oidc/link", key: unscoped, want: http.StatusUnauthorized},
+		{name: "identities", method: "GET", target: "/me/identities", key: unscoped, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRequest(tt.method, tt.target, `{"username": "takeover"}`)
+			r.Header.Set("X-API-Key", tt.key)
+			if w := serve(s, r); w.Code != tt.want {
+				t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.target, w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	if dto, _ := st.users.GetUserByID(admin.Id); dto.Username != admin.Username {
+		t.Errorf("username changed to %q through an api key", dto.Username)
+	}
+}
+
+func TestBearerTokenOnUnscopedRoutes(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	reader := st.addUser("reader", dbmodel.UserRoleReader)
+
+	r := newRequest("GET", "/me/sessions", "")
+	r.Header.Set("Authorization", bearer(t, s, reader))
+	if w := serve(s, r); w.Code != http.StatusOK {
+		t.Errorf("GET /me/sessions = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	r = newRequest("GET", "/roles", "")
+	r.Header.Set("Authorization", bearer(t, s, reader))
+	if w := serve(s, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET /roles = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
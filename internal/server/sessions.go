@@ -0,0 +1,265 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+const defaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func (h *authHandler) refreshToken(w http.ResponseWriter, r *http.Request) {
+	var refresh refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&refresh); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	if refresh.RefreshToken == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("refresh token is required"))
+		return
+	}
+
+	hash := hashToken(refresh.RefreshToken)
+	refreshDTO, err := h.sessions.GetRefreshToken(hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusUnauthorized, errors.New("invalid refresh token"))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	session, err := h.sessions.GetSessionByID(refreshDTO.SessionId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusUnauthorized, errors.New("session expired or revoked"))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if session.Revoked || time.Now().After(session.ExpiresAt) {
+		respondWithError(w, http.StatusUnauthorized, errors.New("session expired or revoked"))
+		return
+	}
+	if time.Now().After(refreshDTO.ExpiresAt) {
+		respondWithError(w, http.StatusUnauthorized, errors.New("refresh token expired"))
+		return
+	}
+
+	fresh, err := h.sessions.UseRefreshToken(hash)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !fresh {
+		session.Revoked = true
+		if err := h.sessions.UpdateSession(session); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondWithError(w, http.StatusUnauthorized, errors.New("refresh token reuse detected, session revoked"))
+		return
+	}
+
+	dto, err := h.storage.GetUserByID(session.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusUnauthorized, errors.New("user no longer exists"))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if dto.Status != "" && dto.Status != dbmodel.UserStatusActive {
+		respondWithError(w, http.StatusForbidden, errAccountInactive)
+		return
+	}
+	tenant, err := h.tenants.byID(dto.TenantId)
+	if err != nil {
+		respondWithTenantError(w, err)
+		return
+	}
+	if tenant.Status == dbmodel.TenantStatusSuspended {
+		respondWithTenantError(w, errTenantSuspended)
+		return
+	}
+
+	session.LastUsedAt = time.Now()
+	if err := h.sessions.UpdateSession(session); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respondWithTokens(w, http.StatusOK, dto, session.Id)
+}
+
+func (h *authHandler) getSessions(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+	userID, _ := props["id"].(string)
+
+	dtos, err := h.sessions.GetSessionsByUserID(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type session struct {
+		dbmodel.SessionDTO
+		Current bool `json:"current"`
+	}
+	sessions := make([]session, 0)
+	for _, dto := range dtos {
+		if dto.Revoked || time.Now().After(dto.ExpiresAt) {
+			continue
+		}
+		sessions = append(sessions, session{SessionDTO: dto, Current: dto.Id == props["sid"]})
+	}
+
+	body, err := json.Marshal(sessions)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) deleteSessionByID(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("session id is required"))
+		return
+	}
+
+	session, err := h.sessions.GetSessionByID(vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("session with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if session.UserId != props["id"] {
+		respondWithError(w, http.StatusNotFound, fmt.Errorf("session with id: %s not found", vars["id"]))
+		return
+	}
+
+	session.Revoked = true
+	if err = h.sessions.UpdateSession(session); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "session revoked"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) createSession(userID, device string) (string, error) {
+	now := time.Now()
+	dto := dbmodel.SessionDTO{
+		Id:         uuid.NewString(),
+		UserId:     userID,
+		Device:     device,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(refreshTokenTTL()),
+	}
+	return h.sessions.CreateSession(dto)
+}
+
+func (h *authHandler) generateRefreshToken(sessionID string) (string, error) {
+	refreshToken, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	dto := dbmodel.RefreshTokenDTO{
+		Hash:      hashToken(refreshToken),
+		SessionId: sessionID,
+		ExpiresAt: time.Now().Add(refreshTokenTTL()),
+	}
+	if err := h.sessions.CreateRefreshToken(dto); err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+func randomToken() (string, error) {
+	buff := make([]byte, 32)
+	if _, err := rand.Read(buff); err != nil {
+		return "", fmt.Errorf("unable to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buff), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// startSessionPurge drops sessions and refresh tokens once they can no longer
+// be used, so the tables do not grow with every sign-in.
+func (h *authHandler) startSessionPurge(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := h.sessions.DeleteExpiredSessions(time.Now()); err != nil {
+				log.Println("session purge failed:", err)
+			}
+		}
+	}()
+}
+
+// revokeCredentials signs a user out everywhere after a password change,
+// including API keys, which would otherwise outlive the old password.
+func revokeCredentials(sessions storage.Sessions, apiKeys storage.APIKeys, userID string) error {
+	if err := sessions.RevokeSessionsByUserID(userID); err != nil {
+		return err
+	}
+	return apiKeys.RevokeAPIKeysByUserID(userID)
+}
+
+func refreshTokenTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("APP_REFRESH_TOKEN_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return defaultRefreshTokenTTL
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+func refresh(s *server, refreshToken string) (int, token) {
+	w := serve(s, newRequest("POST", "/token/refresh", `{"refreshToken": "`+refreshToken+`"}`))
+	var resp token
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	alice := st.addUser("alice", dbmodel.UserRoleReader)
+	_, first := signIn(t, s, alice)
+
+	code, rotated := refresh(s, first)
+	if code != http.StatusOK || rotated.RefreshToken == "" || rotated.RefreshToken == first {
+		t.Fatalf("refresh = %d with token %q, want %d and a new token", code, rotated.RefreshToken, http.StatusOK)
+	}
+
+	if code, _ = refresh(s, first); code != http.StatusUnauthorized {
+		t.Errorf("reused refresh token = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ = refresh(s, rotated.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("refresh after reuse = %d, want %d, the session must be revoked", code, http.StatusUnauthorized)
+	}
+	if session, _ := st.sessions.GetSessionByID(rotated.SessionId); !session.Revoked {
+		t.Error("session was not revoked after refresh token reuse")
+	}
+}
+
+func TestRefreshTokenInactiveAccount(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+
+	pending := st.addUser("pending", dbmodel.UserRoleReader)
+	_, pendingToken := signIn(t, s, pending)
+	pending.Status = dbmodel.UserStatusPendingApproval
+	st.users.UpdateUser(pending)
+
+	tenant := st.tenants.add("acme", dbmodel.TenantStatusActive)
+	member := st.addTenantUser(tenant.Id, "member", dbmodel.UserRoleReader)
+	_, memberToken := signIn(t, s, member)
+	tenant.Status = dbmodel.TenantStatusSuspended
+	st.tenants.tenants[tenant.Id] = tenant
+
+	if code, _ := refresh(s, pendingToken); code != http.StatusForbidden {
+		t.Errorf("refresh for inactive user = %d, want %d", code, http.StatusForbidden)
+	}
+	if code, _ := refresh(s, memberToken); code != http.StatusForbidden {
+		t.Errorf("refresh in suspended tenant = %d, want %d", code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,409 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/catalog"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/model"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+type subjectsHandler struct {
+	storage storage.Subjects
+}
+
+func newSubjectsHandler(s storage.Subjects) *subjectsHandler {
+	return &subjectsHandler{
+		storage: s,
+	}
+}
+
+func (h *subjectsHandler) getSubjects(w http.ResponseWriter, r *http.Request) {
+	dtos, err := h.storage.GetSubjects(tenantFromRequest(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	subjects := make([]model.Subject, 0)
+	for _, dto := range dtos {
+		subjects = append(subjects, model.SubjectFromDTO(dto))
+	}
+
+	body, err := json.Marshal(subjects)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *subjectsHandler) getSubjectByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("subject id is required"))
+		return
+	}
+
+	dto, err := subjectInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("subject with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	body, err := json.Marshal(model.SubjectFromDTO(dto))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *subjectsHandler) getSubjectTree(w http.ResponseWriter, r *http.Request) {
+	dtos, err := h.storage.GetSubjects(tenantFromRequest(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	children := make(map[string][]dbmodel.SubjectDTO)
+	for _, dto := range dtos {
+		children[dto.ParentId] = append(children[dto.ParentId], dto)
+	}
+
+	var build func(parentID string) []model.Subject
+	build = func(parentID string) []model.Subject {
+		subjects := make([]model.Subject, 0)
+		for _, dto := range children[parentID] {
+			subject := model.SubjectFromDTO(dto)
+			subject.Children = build(dto.Id)
+			subjects = append(subjects, subject)
+		}
+		return subjects
+	}
+
+	body, err := json.Marshal(build(""))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *subjectsHandler) createSubject(w http.ResponseWriter, r *http.Request) {
+	var subject model.Subject
+	if err := json.NewDecoder(r.Body).Decode(&subject); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	subject.Name = catalog.NormalizeName(subject.Name)
+	if subject.Name == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("subject name is required"))
+		return
+	}
+
+	if _, err := h.storage.GetSubjectByName(tenantFromRequest(r), subject.Name); err == nil {
+		respondWithError(w, http.StatusConflict, errors.New("subject already exists"))
+		return
+	}
+
+	if subject.ParentId != "" {
+		if _, err := subjectInTenant(h.storage, r, subject.ParentId); err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusBadRequest, fmt.Errorf("parent subject with id: %s not found, %w", subject.ParentId, err))
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	subject.Id = uuid.NewString()
+	subject.TenantId = tenantFromRequest(r)
+	id, err := h.storage.CreateSubject(model.DTOFromSubject(subject))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "subject created with id: " + id}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, body)
+}
+
+func (h *subjectsHandler) updateSubject(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("subject id is required"))
+		return
+	}
+
+	var subject model.Subject
+	if err := json.NewDecoder(r.Body).Decode(&subject); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	dto, err := subjectInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("subject with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if name := catalog.NormalizeName(subject.Name); name != "" {
+		dto.Name = name
+	}
+	if subject.Code != "" {
+		dto.Code = subject.Code
+	}
+	if subject.ParentId != "" {
+		if err := h.checkParent(r, dto.Id, subject.ParentId); err != nil {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		dto.ParentId = subject.ParentId
+	}
+
+	if err = h.storage.UpdateSubject(dto); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "subject updated"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *subjectsHandler) importSubjects(w http.ResponseWriter, r *http.Request) {
+	var imports []model.SubjectImport
+	switch scheme := r.URL.Query().Get("scheme"); scheme {
+	case "dewey":
+		imports = model.DeweyClassification
+	case "":
+		if err := json.NewDecoder(r.Body).Decode(&imports); err != nil {
+			respondWithError(w, http.StatusUnprocessableEntity, err)
+			r.Body.Close()
+			return
+		}
+		defer r.Body.Close()
+	default:
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("unknown classification scheme: %s", scheme))
+		return
+	}
+
+	tenantID := tenantFromRequest(r)
+	ids := make(map[string]string)
+	for _, entry := range imports {
+		name := catalog.NormalizeName(entry.Name)
+		if entry.Code == "" || name == "" {
+			respondWithError(w, http.StatusBadRequest, errors.New("subject code and name are required"))
+			return
+		}
+
+		dto, err := h.storage.GetSubjectByCode(tenantID, entry.Code)
+		if err != nil {
+			if _, ok := err.(*storage.SubjectNotFoundErr); !ok {
+				respondWithError(w, http.StatusInternalServerError, err)
+				return
+			}
+			dto = dbmodel.SubjectDTO{Id: uuid.NewString(), Name: name, Code: entry.Code, TenantId: tenantID}
+			if _, err = h.storage.CreateSubject(dto); err != nil {
+				respondWithError(w, http.StatusInternalServerError, err)
+				return
+			}
+		} else if dto.Name != name {
+			dto.Name = name
+			if err = h.storage.UpdateSubject(dto); err != nil {
+				respondWithError(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+		ids[entry.Code] = dto.Id
+	}
+
+	for _, entry := range imports {
+		if entry.ParentCode == "" {
+			continue
+		}
+
+		parentID, ok := ids[entry.ParentCode]
+		if !ok {
+			parent, err := h.storage.GetSubjectByCode(tenantID, entry.ParentCode)
+			if err != nil {
+				if _, ok := err.(*storage.SubjectNotFoundErr); ok {
+					respondWithError(w, http.StatusBadRequest, fmt.Errorf("parent subject with code: %s not found", entry.ParentCode))
+					return
+				}
+				respondWithError(w, http.StatusInternalServerError, err)
+				return
+			}
+			parentID = parent.Id
+		}
+
+		dto, err := subjectInTenant(h.storage, r, ids[entry.Code])
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if dto.ParentId == parentID {
+			continue
+		}
+		if err := h.checkParent(r, dto.Id, parentID); err != nil {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		dto.ParentId = parentID
+		if err = h.storage.UpdateSubject(dto); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: fmt.Sprintf("%d subjects imported", len(ids))}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *subjectsHandler) checkParent(r *http.Request, id, parentID string) error {
+	if id == parentID {
+		return errors.New("subject cannot be its own parent")
+	}
+
+	if _, err := subjectInTenant(h.storage, r, parentID); err != nil {
+		return fmt.Errorf("parent subject with id: %s not found, %w", parentID, err)
+	}
+
+	ancestorIDs, err := h.storage.GetSubjectAncestorIDs(parentID)
+	if err != nil {
+		return err
+	}
+	for _, ancestorID := range ancestorIDs {
+		if ancestorID == id {
+			return errors.New("subject cannot be moved below its own descendant")
+		}
+	}
+	return nil
+}
+
+func (h *subjectsHandler) mergeSubjects(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("subject id is required"))
+		return
+	}
+
+	var merge mergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&merge); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	sourceIDs := make([]string, 0)
+	for _, id := range merge.Ids {
+		if id == vars["id"] {
+			continue
+		}
+		if _, err := subjectInTenant(h.storage, r, id); err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusNotFound, fmt.Errorf("subject with id: %s not found, %w", id, err))
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		sourceIDs = append(sourceIDs, id)
+	}
+
+	if _, err := subjectInTenant(h.storage, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("subject with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ancestorIDs, err := h.storage.GetSubjectAncestorIDs(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, ancestorID := range ancestorIDs {
+		for _, sourceID := range sourceIDs {
+			if ancestorID == sourceID {
+				respondWithError(w, http.StatusBadRequest, errors.New("subject cannot be merged into its own descendant"))
+				return
+			}
+		}
+	}
+
+	if err = h.storage.MergeSubjects(tenantFromRequest(r), vars["id"], sourceIDs); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "subjects merged"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/model"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+type tagsHandler struct {
+	storage storage.Tags
+}
+
+func newTagsHandler(t storage.Tags) *tagsHandler {
+	return &tagsHandler{
+		storage: t,
+	}
+}
+
+func (h *tagsHandler) getTags(w http.ResponseWriter, r *http.Request) {
+	dtos, err := h.storage.GetTags(tenantFromRequest(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	tags := make([]model.Tag, 0)
+	for _, dto := range dtos {
+		tags = append(tags, model.TagFromDTO(dto))
+	}
+
+	body, err := json.Marshal(tags)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *tagsHandler) getTagByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("tag id is required"))
+		return
+	}
+
+	dto, err := tagInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("tag with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	body, err := json.Marshal(model.TagFromDTO(dto))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *tagsHandler) mergeTags(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("tag id is required"))
+		return
+	}
+
+	var merge mergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&merge); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	sourceIDs := make([]string, 0)
+	for _, id := range merge.Ids {
+		if id == vars["id"] {
+			continue
+		}
+		if _, err := tagInTenant(h.storage, r, id); err != nil {
+			if err == sql.ErrNoRows {
+				respondWithError(w, http.StatusNotFound, fmt.Errorf("tag with id: %s not found, %w", id, err))
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		sourceIDs = append(sourceIDs, id)
+	}
+
+	if _, err := tagInTenant(h.storage, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("tag with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.storage.MergeTags(tenantFromRequest(r), vars["id"], sourceIDs); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "tags merged"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
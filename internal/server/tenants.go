@@ -0,0 +1,472 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/model"
+	"github.com/szwedm/cloud-library/internal/rbac"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+var (
+	errTenantNotFound  = errors.New("tenant not found")
+	errTenantSuspended = errors.New("tenant is suspended")
+	errTenantMismatch  = errors.New("credentials are not valid for this tenant")
+)
+
+const defaultTenantSlug = "default"
+
+var tenantSlugRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+type tenantResolver struct {
+	storage storage.Tenants
+	domain  string
+}
+
+func newTenantResolver(t storage.Tenants) *tenantResolver {
+	return &tenantResolver{
+		storage: t,
+		domain:  strings.ToLower(strings.Trim(os.Getenv("APP_TENANT_DOMAIN"), ".")),
+	}
+}
+
+func (t *tenantResolver) slugFromRequest(r *http.Request) string {
+	if slug := strings.TrimSpace(r.Header.Get("X-Tenant")); slug != "" {
+		return strings.ToLower(slug)
+	}
+	if t.domain == "" {
+		return ""
+	}
+
+	host := strings.ToLower(r.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if !strings.HasSuffix(host, "."+t.domain) {
+		return ""
+	}
+	return strings.TrimSuffix(host, "."+t.domain)
+}
+
+func (t *tenantResolver) resolve(r *http.Request) (dbmodel.TenantDTO, bool, error) {
+	slug := t.slugFromRequest(r)
+	if slug == "" {
+		tenant, err := t.byID(dbmodel.DefaultTenantId)
+		return tenant, false, err
+	}
+	if slug == defaultTenantSlug {
+		tenant, err := t.byID(dbmodel.DefaultTenantId)
+		return tenant, true, err
+	}
+
+	tenant, err := t.storage.GetTenantBySlug(slug)
+	if err != nil {
+		if _, ok := err.(*storage.TenantNotFoundErr); ok {
+			return dbmodel.TenantDTO{}, true, errTenantNotFound
+		}
+		return dbmodel.TenantDTO{}, true, err
+	}
+	return tenant, true, nil
+}
+
+func (t *tenantResolver) byID(id string) (dbmodel.TenantDTO, error) {
+	if id == "" {
+		id = dbmodel.DefaultTenantId
+	}
+
+	tenant, err := t.storage.GetTenantByID(id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return dbmodel.TenantDTO{}, err
+		}
+		if id != dbmodel.DefaultTenantId {
+			return dbmodel.TenantDTO{}, errTenantNotFound
+		}
+		tenant = dbmodel.TenantDTO{Id: dbmodel.DefaultTenantId, Slug: defaultTenantSlug, Status: dbmodel.TenantStatusActive}
+	}
+	return tenant, nil
+}
+
+func (t *tenantResolver) active(r *http.Request) (dbmodel.TenantDTO, error) {
+	tenant, _, err := t.resolve(r)
+	if err != nil {
+		return dbmodel.TenantDTO{}, err
+	}
+	if tenant.Status == dbmodel.TenantStatusSuspended {
+		return dbmodel.TenantDTO{}, errTenantSuspended
+	}
+	return tenant, nil
+}
+
+func (s *server) scopeTenant(r *http.Request, claims jwt.MapClaims) error {
+	superAdmin := s.policy.AllowedAny(rolesFromClaims(claims), rbac.TenantsManage)
+
+	tenant, explicit, err := s.tenants.resolve(r)
+	if err != nil {
+		return err
+	}
+	claimed, _ := claims["tenant"].(string)
+	if claimed == "" {
+		claimed = dbmodel.DefaultTenantId
+	}
+
+	if !explicit {
+		if tenant, err = s.tenants.byID(claimed); err != nil {
+			return err
+		}
+	} else if tenant.Id != claimed {
+		if !superAdmin {
+			return errTenantMismatch
+		}
+	}
+	if tenant.Status == dbmodel.TenantStatusSuspended && !superAdmin {
+		return errTenantSuspended
+	}
+
+	claims["tenant"] = tenant.Id
+	return nil
+}
+
+func respondWithTenantError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errTenantNotFound):
+		respondWithError(w, http.StatusNotFound, err)
+	case errors.Is(err, errTenantSuspended), errors.Is(err, errTenantMismatch):
+		respondWithError(w, http.StatusForbidden, err)
+	default:
+		respondWithError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func tenantFromRequest(r *http.Request) string {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+	if tenant, _ := props["tenant"].(string); tenant != "" {
+		return tenant
+	}
+	return dbmodel.DefaultTenantId
+}
+
+func bookInTenant(books storage.Books, r *http.Request, id string) (dbmodel.BookDTO, error) {
+	dto, err := books.GetBookByID(id)
+	if err == nil && dto.TenantId != tenantFromRequest(r) {
+		return dbmodel.BookDTO{}, sql.ErrNoRows
+	}
+	return dto, err
+}
+
+func collectionInTenant(collections storage.Collections, r *http.Request, id string) (dbmodel.CollectionDTO, error) {
+	dto, err := collections.GetCollectionByID(id)
+	if err == nil && dto.TenantId != tenantFromRequest(r) {
+		return dbmodel.CollectionDTO{}, sql.ErrNoRows
+	}
+	return dto, err
+}
+
+func groupInTenant(groups storage.Groups, r *http.Request, id string) (dbmodel.GroupDTO, error) {
+	dto, err := groups.GetGroupByID(id)
+	if err == nil && dto.TenantId != tenantFromRequest(r) {
+		return dbmodel.GroupDTO{}, sql.ErrNoRows
+	}
+	return dto, err
+}
+
+func userInTenant(users storage.Users, r *http.Request, id string) (dbmodel.UserDTO, error) {
+	dto, err := users.GetUserByID(id)
+	if err == nil && dto.TenantId != tenantFromRequest(r) {
+		return dbmodel.UserDTO{}, sql.ErrNoRows
+	}
+	return dto, err
+}
+
+func authorInTenant(authors storage.Authors, r *http.Request, id string) (dbmodel.AuthorDTO, error) {
+	dto, err := authors.GetAuthorByID(id)
+	if err == nil && dto.TenantId != tenantFromRequest(r) {
+		return dbmodel.AuthorDTO{}, sql.ErrNoRows
+	}
+	return dto, err
+}
+
+func subjectInTenant(subjects storage.Subjects, r *http.Request, id string) (dbmodel.SubjectDTO, error) {
+	dto, err := subjects.GetSubjectByID(id)
+	if err == nil && dto.TenantId != tenantFromRequest(r) {
+		return dbmodel.SubjectDTO{}, sql.ErrNoRows
+	}
+	return dto, err
+}
+
+func tagInTenant(tags storage.Tags, r *http.Request, id string) (dbmodel.TagDTO, error) {
+	dto, err := tags.GetTagByID(id)
+	if err == nil && dto.TenantId != tenantFromRequest(r) {
+		return dbmodel.TagDTO{}, sql.ErrNoRows
+	}
+	return dto, err
+}
+
+type tenantsHandler struct {
+	storage storage.Tenants
+	users   storage.Users
+	books   storage.Books
+	audit   *auditor
+}
+
+func newTenantsHandler(t storage.Tenants, u storage.Users, b storage.Books, au *auditor) *tenantsHandler {
+	return &tenantsHandler{
+		storage: t,
+		users:   u,
+		books:   b,
+		audit:   au,
+	}
+}
+
+func (h *tenantsHandler) getTenants(w http.ResponseWriter, r *http.Request) {
+	dtos, err := h.storage.GetTenants()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	tenants := make([]model.Tenant, 0)
+	for _, dto := range dtos {
+		tenants = append(tenants, model.TenantFromDTO(dto))
+	}
+
+	body, err := json.Marshal(tenants)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *tenantsHandler) getTenantByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("tenant id is required"))
+		return
+	}
+
+	dto, err := h.storage.GetTenantByID(vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("tenant with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	body, err := json.Marshal(model.TenantFromDTO(dto))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *tenantsHandler) createTenant(w http.ResponseWriter, r *http.Request) {
+	var tenant model.Tenant
+	if err := json.NewDecoder(r.Body).Decode(&tenant); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	tenant.Slug = strings.ToLower(strings.TrimSpace(tenant.Slug))
+	tenant.Name = strings.TrimSpace(tenant.Name)
+	if !tenantSlugRegex.MatchString(tenant.Slug) || tenant.Slug == defaultTenantSlug {
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("invalid tenant slug: %s", tenant.Slug))
+		return
+	}
+	if tenant.Name == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("tenant name is required"))
+		return
+	}
+
+	if _, err := h.storage.GetTenantBySlug(tenant.Slug); err == nil {
+		respondWithError(w, http.StatusConflict, errors.New("tenant already exists"))
+		return
+	}
+
+	if tenant.QuotaBytes < 0 {
+		respondWithError(w, http.StatusBadRequest, errors.New("quota cannot be negative"))
+		return
+	}
+
+	tenant.Id = uuid.NewString()
+	tenant.Status = dbmodel.TenantStatusActive
+	tenant.CreatedAt = time.Now()
+	id, err := h.storage.CreateTenant(model.DTOFromTenant(tenant))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditTenantCreate, "tenant", id, nil, tenant)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "tenant created with id: " + id}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, body)
+}
+
+func (h *tenantsHandler) updateTenant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("tenant id is required"))
+		return
+	}
+
+	var req struct {
+		Name       string `json:"name"`
+		Status     string `json:"status"`
+		QuotaBytes *int64 `json:"quotaBytes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	dto, err := h.storage.GetTenantByID(vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("tenant with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	before := model.TenantFromDTO(dto)
+	if name := strings.TrimSpace(req.Name); name != "" {
+		dto.Name = name
+	}
+	switch req.Status {
+	case "":
+	case dbmodel.TenantStatusActive, dbmodel.TenantStatusSuspended:
+		if dto.Id == dbmodel.DefaultTenantId && req.Status == dbmodel.TenantStatusSuspended {
+			respondWithError(w, http.StatusBadRequest, errors.New("default tenant cannot be suspended"))
+			return
+		}
+		dto.Status = req.Status
+	default:
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("unsupported tenant status: %s", req.Status))
+		return
+	}
+	if req.QuotaBytes != nil {
+		if *req.QuotaBytes < 0 {
+			respondWithError(w, http.StatusBadRequest, errors.New("quota cannot be negative"))
+			return
+		}
+		dto.QuotaBytes = *req.QuotaBytes
+	}
+
+	if err = h.storage.UpdateTenant(dto); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditTenantUpdate, "tenant", dto.Id, before, model.TenantFromDTO(dto))
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "tenant updated"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *tenantsHandler) deleteTenantByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("tenant id is required"))
+		return
+	}
+	if vars["id"] == dbmodel.DefaultTenantId {
+		respondWithError(w, http.StatusBadRequest, errors.New("default tenant cannot be deleted"))
+		return
+	}
+
+	dto, err := h.storage.GetTenantByID(vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("tenant with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	users, err := h.users.GetUsers(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	books, err := h.books.GetBooks(dbmodel.BookFilter{TenantId: vars["id"]})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	trashedUsers, err := h.users.GetDeletedUsers(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	trashedBooks, err := h.books.GetDeletedBooks(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(users) > 0 || len(books) > 0 || len(trashedUsers) > 0 || len(trashedBooks) > 0 {
+		respondWithError(w, http.StatusConflict, errors.New("tenant still has users or books"))
+		return
+	}
+
+	if err = h.storage.DeleteTenantByID(vars["id"]); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditTenantDelete, "tenant", dto.Id, model.TenantFromDTO(dto), nil)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "tenant deleted"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
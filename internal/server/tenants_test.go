@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+func TestUsernamesPerTenant(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	acme := st.tenants.add("acme", dbmodel.TenantStatusActive)
+	alice := st.addUser("alice", dbmodel.UserRoleReader)
+	acmeAlice := st.addTenantUser(acme.Id, "alice", dbmodel.UserRoleReader)
+	st.setPassword(t, s, alice, "Correct-horse-battery-9")
+	st.setPassword(t, s, acmeAlice, "Acme-horse-battery-9")
+
+	tests := []struct {
+		name   string
+		tenant string
+		secret string
+		want   int
+	}{
+		{name: "default tenant", secret: "Correct-horse-battery-9", want: http.StatusCreated},
+		{name: "acme tenant", tenant: "acme", secret: "Acme-horse-battery-9", want: http.StatusCreated},
+		{name: "password of the other tenant", tenant: "acme", secret: "Correct-horse-battery-9", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := signinRequest("alice", tt.secret)
+			r.Header.Set("X-Tenant", tt.tenant)
+			if w := serve(s, r); w.Code != tt.want {
+				t.Errorf("signin = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestCreateUserConflictsPerTenant(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	acme := st.tenants.add("acme", dbmodel.TenantStatusActive)
+	bob := st.addUser("bob", dbmodel.UserRoleReader)
+	bob.Email = "bob@example.com"
+	st.users.UpdateUser(bob)
+	admin := st.addTenantUser(acme.Id, "admin", dbmodel.UserRoleAdministrator)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "username taken in another tenant", body: `{"username": "bob", "password": "Correct-horse-battery-9", "role": "reader"}`, want: http.StatusCreated},
+		{name: "username taken in the tenant", body: `{"username": "bob", "password": "Correct-horse-battery-9", "role": "reader"}`, want: http.StatusConflict},
+		{name: "email taken in another tenant", body: `{"username": "robert", "password": "Correct-horse-battery-9", "role": "reader", "email": "bob@example.com"}`, want: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		r := newRequest("POST", "/users", tt.body)
+		r.Header.Set("Authorization", bearer(t, s, admin))
+		if w := serve(s, r); w.Code != tt.want {
+			t.Errorf("%s: POST /users = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+
+	if dto, _ := st.users.GetUserByUsername(acme.Id, "bob"); dto.TenantId != acme.Id {
+		t.Errorf("bob was created in tenant %q, want %q", dto.TenantId, acme.Id)
+	}
+}
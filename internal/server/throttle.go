@@ -0,0 +1,298 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+const (
+	defaultLockoutThreshold   = 5
+	defaultIPLockoutThreshold = 20
+	defaultLockoutDuration    = 15 * time.Minute
+	throttleBaseDelay         = time.Second
+)
+
+type throttle struct {
+	storage     storage.LoginAttempts
+	threshold   int
+	ipThreshold int
+	duration    time.Duration
+	trustProxy  bool
+}
+
+type throttledErr struct {
+	retryAfter time.Duration
+}
+
+func (e *throttledErr) Error() string {
+	return "too many failed attempts, try again later"
+}
+
+func newThrottle(l storage.LoginAttempts) *throttle {
+	t := &throttle{
+		storage:     l,
+		threshold:   defaultLockoutThreshold,
+		ipThreshold: defaultIPLockoutThreshold,
+		duration:    defaultLockoutDuration,
+		trustProxy:  os.Getenv("APP_TRUST_PROXY") == "true",
+	}
+	if n, err := strconv.Atoi(os.Getenv("APP_LOCKOUT_THRESHOLD")); err == nil && n > 0 {
+		t.threshold = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("APP_IP_LOCKOUT_THRESHOLD")); err == nil && n > 0 {
+		t.ipThreshold = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("APP_LOCKOUT_DURATION")); err == nil && d > 0 {
+		t.duration = d
+	}
+	return t
+}
+
+// usernameKey is scoped to the tenant, usernames are only unique within one.
+func usernameKey(tenantID, username string) string {
+	return "user:" + tenantID + ":" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func (t *throttle) clientIP(r *http.Request) string {
+	if t.trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (t *throttle) keys(r *http.Request, tenantID, username string) []string {
+	return []string{usernameKey(tenantID, username), ipKey(t.clientIP(r))}
+}
+
+func (t *throttle) thresholdFor(key string) int {
+	if strings.HasPrefix(key, "ip:") {
+		return t.ipThreshold
+	}
+	return t.threshold
+}
+
+func (t *throttle) check(keys ...string) error {
+	now := time.Now()
+	var retryAfter time.Duration
+	for _, key := range keys {
+		dto, err := t.storage.GetLoginAttempt(key)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return err
+		}
+
+		if dto.LockedUntil.After(now) {
+			if wait := dto.LockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+			continue
+		}
+		if dto.Failures > 0 && now.Sub(dto.LastFailureAt) < t.duration {
+			if wait := dto.LastFailureAt.Add(t.backoff(dto.Failures)).Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+
+	if retryAfter > 0 {
+		return &throttledErr{retryAfter: retryAfter}
+	}
+	return nil
+}
+
+// attempt counts an attempt against every key before the credentials are
+// verified. Checking first and counting only failures would let parallel
+// requests all pass the check, so the counter is bumped atomically up front
+// and attempts beyond the threshold are rejected. succeed takes it back.
+func (t *throttle) attempt(keys ...string) error {
+	if err := t.check(keys...); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, key := range keys {
+		dto, err := t.storage.RecordLoginFailure(key, now, now.Add(-t.duration))
+		if err != nil {
+			return err
+		}
+		if dto.Failures > t.thresholdFor(key) {
+			if err = t.storage.LockLoginAttempt(key, now.Add(t.duration)); err != nil {
+				return err
+			}
+			return &throttledErr{retryAfter: t.duration}
+		}
+	}
+	return nil
+}
+
+// fail locks the keys that reached their threshold, the failure itself has
+// already been counted by attempt.
+func (t *throttle) fail(keys ...string) error {
+	now := time.Now()
+	for _, key := range keys {
+		dto, err := t.storage.GetLoginAttempt(key)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return err
+		}
+		if dto.Failures >= t.thresholdFor(key) {
+			if err = t.storage.LockLoginAttempt(key, now.Add(t.duration)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// forgive takes back the attempt counted by attempt, earlier failures stay.
+func (t *throttle) forgive(keys ...string) error {
+	for _, key := range keys {
+		if err := t.storage.ForgiveLoginAttempt(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// succeed clears the failures of an account and takes back the attempt
+// counted against the client address.
+func (t *throttle) succeed(keys ...string) error {
+	for _, key := range keys {
+		if strings.HasPrefix(key, "ip:") {
+			if err := t.forgive(key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := t.storage.DeleteLoginAttempt(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *throttle) backoff(failures int) time.Duration {
+	delay := time.Duration(float64(throttleBaseDelay) * math.Pow(2, float64(failures-1)))
+	if delay > t.duration || delay <= 0 {
+		return t.duration
+	}
+	return delay
+}
+
+func respondWithThrottled(w http.ResponseWriter, err error) {
+	throttled, ok := err.(*throttledErr)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	seconds := int(math.Ceil(throttled.retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondWithError(w, http.StatusTooManyRequests, throttled)
+}
+
+func (h *authHandler) getLockouts(w http.ResponseWriter, r *http.Request) {
+	dtos, err := h.throttle.storage.GetLockedLoginAttempts(time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	body, err := json.Marshal(dtos)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) deleteLockout(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	keys := make([]string, 0)
+	if username := query.Get("username"); username != "" {
+		tenantID := query.Get("tenant")
+		if tenantID == "" {
+			tenantID = tenantFromRequest(r)
+		}
+		keys = append(keys, usernameKey(tenantID, username))
+	}
+	if ip := query.Get("ip"); ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	if len(keys) == 0 {
+		respondWithError(w, http.StatusBadRequest, errors.New("username or ip is required"))
+		return
+	}
+
+	h.unlock(w, r, keys...)
+}
+
+func (h *authHandler) deleteUserLockout(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("user id is required"))
+		return
+	}
+
+	dto, err := userInTenant(h.storage, r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("user with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.unlock(w, r, usernameKey(dto.TenantId, dto.Username))
+}
+
+func (h *authHandler) unlock(w http.ResponseWriter, r *http.Request, keys ...string) {
+	for _, key := range keys {
+		if err := h.throttle.storage.DeleteLoginAttempt(key); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	h.audit.record(r, auditUnlock, "lockout", strings.Join(keys, ", "), nil, nil)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "unlocked " + strings.Join(keys, ", ")}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
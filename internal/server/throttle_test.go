@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+func signinRequest(username, secret string) *http.Request {
+	return newRequest("POST", "/signin", `{"username": "`+username+`", "password": "`+secret+`"}`)
+}
+
+func TestSigninLockout(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	alice := st.addUser("alice", dbmodel.UserRoleReader)
+	st.setPassword(t, s, alice, "Correct-horse-battery-9")
+
+	if w := serve(s, signinRequest("alice", "Correct-horse-battery-9")); w.Code != http.StatusCreated {
+		t.Fatalf("signin = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	if dto, err := st.loginAttempts.GetLoginAttempt(ipKey("192.0.2.1")); err == nil && dto.Failures != 0 {
+		t.Errorf("successful signin left %d failures on the client address", dto.Failures)
+	}
+
+	for i := 0; i < defaultLockoutThreshold; i++ {
+		// step past the backoff so only the lockout can reject the attempt
+		st.loginAttempts.age(usernameKey(dbmodel.DefaultTenantId, "alice"), time.Minute)
+		st.loginAttempts.age(ipKey("192.0.2.1"), time.Minute)
+		if w := serve(s, signinRequest("alice", "wrong")); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d = %d, want %d: %s", i+1, w.Code, http.StatusUnauthorized, w.Body)
+		}
+	}
+
+	w := serve(s, signinRequest("alice", "Correct-horse-battery-9"))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("signin after lockout = %d, want %d with Retry-After", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestSigninParallelAttempts(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	alice := st.addUser("alice", dbmodel.UserRoleReader)
+	st.setPassword(t, s, alice, "Correct-horse-battery-9")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4*defaultLockoutThreshold; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(s, signinRequest("alice", "wrong"))
+		}()
+	}
+	wg.Wait()
+
+	if st.users.usernameLookups > defaultLockoutThreshold {
+		t.Errorf("%d passwords were checked in parallel, want at most %d", st.users.usernameLookups, defaultLockoutThreshold)
+	}
+}
+
+func TestThrottleKeysPerTenant(t *testing.T) {
+	st := newFakeStorage()
+	s := newTestServer(t, st)
+	throttle := s.authHandler.throttle
+	acme := st.tenants.add("acme", dbmodel.TenantStatusActive)
+
+	locked := usernameKey(dbmodel.DefaultTenantId, "bob")
+	for i := 0; i < defaultLockoutThreshold; i++ {
+		st.loginAttempts.age(locked, time.Minute)
+		if err := throttle.attempt(locked); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+		if err := throttle.fail(locked); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := throttle.check(locked); err == nil {
+		t.Error("bob is not locked out in the default tenant")
+	}
+	if err := throttle.check(usernameKey(acme.Id, "bob")); err != nil {
+		t.Errorf("bob in another tenant is throttled: %v", err)
+	}
+}
@@ -0,0 +1,342 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/catalog"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/model"
+	"github.com/szwedm/cloud-library/internal/rbac"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+type trashedBook struct {
+	model.Book
+	DeletedAt time.Time `json:"deletedAt"`
+	PurgeAt   time.Time `json:"purgeAt"`
+}
+
+type trashedUser struct {
+	model.User
+	DeletedAt time.Time `json:"deletedAt"`
+	PurgeAt   time.Time `json:"purgeAt"`
+}
+
+type trash struct {
+	books     storage.Books
+	users     storage.Users
+	audit     *auditor
+	retention time.Duration
+}
+
+func newTrash(b storage.Books, u storage.Users, au *auditor) *trash {
+	retention, _ := time.ParseDuration(os.Getenv("APP_TRASH_RETENTION"))
+	if retention <= 0 {
+		retention = defaultTrashRetention
+	}
+	return &trash{
+		books:     b,
+		users:     u,
+		audit:     au,
+		retention: retention,
+	}
+}
+
+func (t *trash) purgeAt(deletedAt time.Time) time.Time {
+	return deletedAt.Add(t.retention)
+}
+
+func (t *trash) purgeBook(dto dbmodel.BookDTO) error {
+	if err := os.Remove(catalog.BookFilePath(dto.TenantId, dto.Id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return t.books.DeleteBookByID(dto.Id)
+}
+
+func (t *trash) purge() error {
+	before := time.Now().Add(-t.retention)
+
+	books, err := t.books.GetBooksDeletedBefore(before)
+	if err != nil {
+		return err
+	}
+	for _, dto := range books {
+		if err = t.purgeBook(dto); err != nil {
+			return err
+		}
+		t.audit.system(dto.TenantId, auditBookPurge, "book", dto.Id, model.BookFromDTO(dto))
+	}
+
+	users, err := t.users.GetUsersDeletedBefore(before)
+	if err != nil {
+		return err
+	}
+	for _, dto := range users {
+		if err = t.users.DeleteUserByID(dto.Id); err != nil {
+			return err
+		}
+		t.audit.system(dto.TenantId, auditUserPurge, "user", dto.Id, model.UserFromDTO(dto))
+	}
+	return nil
+}
+
+func (t *trash) startPurge(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := t.purge(); err != nil {
+				log.Println("trash purge failed:", err)
+			}
+		}
+	}()
+}
+
+type trashHandler struct {
+	trash  *trash
+	policy *rbac.Policy
+}
+
+func newTrashHandler(t *trash, p *rbac.Policy) *trashHandler {
+	return &trashHandler{
+		trash:  t,
+		policy: p,
+	}
+}
+
+func (h *trashHandler) getTrashedBooks(w http.ResponseWriter, r *http.Request) {
+	dtos, err := h.trash.books.GetDeletedBooks(tenantFromRequest(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	books := make([]trashedBook, 0)
+	for _, dto := range dtos {
+		books = append(books, trashedBook{
+			Book:      model.BookFromDTO(dto),
+			DeletedAt: dto.DeletedAt,
+			PurgeAt:   h.trash.purgeAt(dto.DeletedAt),
+		})
+	}
+
+	body, err := json.Marshal(books)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *trashHandler) restoreBook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("book id is required"))
+		return
+	}
+
+	dto, err := h.trashedBookInTenant(r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("book with id: %s not found in trash, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err = h.trash.books.RestoreBookByID(dto.Id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.trash.audit.record(r, auditBookRestore, "book", dto.Id, nil, model.BookFromDTO(dto))
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "book restored"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *trashHandler) deleteTrashedBook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("book id is required"))
+		return
+	}
+
+	dto, err := h.trashedBookInTenant(r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("book with id: %s not found in trash, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err = h.trash.purgeBook(dto); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.trash.audit.record(r, auditBookPurge, "book", dto.Id, model.BookFromDTO(dto), nil)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "book deleted permanently"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *trashHandler) getTrashedUsers(w http.ResponseWriter, r *http.Request) {
+	dtos, err := h.trash.users.GetDeletedUsers(tenantFromRequest(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	users := make([]trashedUser, 0)
+	for _, dto := range dtos {
+		users = append(users, trashedUser{
+			User:      model.UserFromDTO(dto),
+			DeletedAt: dto.DeletedAt,
+			PurgeAt:   h.trash.purgeAt(dto.DeletedAt),
+		})
+	}
+
+	body, err := json.Marshal(users)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *trashHandler) restoreUser(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("user id is required"))
+		return
+	}
+
+	dto, err := h.trashedUserInTenant(r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("user with id: %s not found in trash, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !h.policy.CanAssign(rolesFromClaims(props), dto.Role) {
+		respondWithError(w, http.StatusForbidden, errors.New("not allowed to restore users with role "+dto.Role))
+		return
+	}
+
+	if err = h.trash.users.RestoreUserByID(dto.Id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.trash.audit.record(r, auditUserRestore, "user", dto.Id, nil, model.UserFromDTO(dto))
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "user restored"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *trashHandler) deleteTrashedUser(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("user id is required"))
+		return
+	}
+
+	dto, err := h.trashedUserInTenant(r, vars["id"])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("user with id: %s not found in trash, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !h.policy.CanAssign(rolesFromClaims(props), dto.Role) {
+		respondWithError(w, http.StatusForbidden, errors.New("not allowed to delete users with role "+dto.Role))
+		return
+	}
+
+	if err = h.trash.users.DeleteUserByID(dto.Id); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.trash.audit.record(r, auditUserPurge, "user", dto.Id, model.UserFromDTO(dto), nil)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "user deleted permanently"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *trashHandler) trashedBookInTenant(r *http.Request, id string) (dbmodel.BookDTO, error) {
+	dto, err := h.trash.books.GetDeletedBookByID(id)
+	if err == nil && dto.TenantId != tenantFromRequest(r) {
+		return dbmodel.BookDTO{}, sql.ErrNoRows
+	}
+	return dto, err
+}
+
+func (h *trashHandler) trashedUserInTenant(r *http.Request, id string) (dbmodel.UserDTO, error) {
+	dto, err := h.trash.users.GetDeletedUserByID(id)
+	if err == nil && dto.TenantId != tenantFromRequest(r) {
+		return dbmodel.UserDTO{}, sql.ErrNoRows
+	}
+	return dto, err
+}
@@ -0,0 +1,507 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/gorilla/mux"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/totp"
+)
+
+const (
+	challengeTokenTTL  = 5 * time.Minute
+	recoveryCodesCount = 10
+)
+
+var errInvalidCode = errors.New("invalid two-factor code")
+
+type challenge struct {
+	ChallengeToken  string `json:"challengeToken,omitempty"`
+	EnrollmentToken string `json:"enrollmentToken,omitempty"`
+	ExpiresIn       int    `json:"expiresIn"`
+}
+
+type twoFactorRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+}
+
+type twoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+}
+
+type enrollment struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"`
+}
+
+type recoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+func (h *authHandler) challengeTwoFactor(w http.ResponseWriter, dto dbmodel.UserDTO, device string) bool {
+	tf, err := h.twoFactor.GetTwoFactor(dto.Id)
+	if err != nil && err != sql.ErrNoRows {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return true
+	}
+	if err == nil && tf.Enabled {
+		h.respondWithChallenge(w, http.StatusAccepted, tokenTypeChallenge, dto, device)
+		return true
+	}
+	if twoFactorRequired(dto.Role) {
+		h.respondWithChallenge(w, http.StatusForbidden, tokenTypeEnrollment, dto, device)
+		return true
+	}
+	return false
+}
+
+func (h *authHandler) respondWithChallenge(w http.ResponseWriter, code int, tokenType string, dto dbmodel.UserDTO, device string) {
+	token, err := h.signToken(dto, challengeTokenTTL, jwt.MapClaims{"typ": tokenType, "device": device})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := challenge{ExpiresIn: int(challengeTokenTTL.Seconds())}
+	if tokenType == tokenTypeEnrollment {
+		resp.EnrollmentToken = token
+	} else {
+		resp.ChallengeToken = token
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, code, body)
+}
+
+func (h *authHandler) signinTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	token, err := jwt.Parse(req.ChallengeToken, h.keyring.Keyfunc)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["typ"] != tokenTypeChallenge {
+		respondWithError(w, http.StatusUnauthorized, errWrongTokenType)
+		return
+	}
+	if err = h.validateClaims(claims); err != nil {
+		if errors.Is(err, errTokenRevoked) {
+			respondWithError(w, http.StatusUnauthorized, err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	userID, _ := claims["id"].(string)
+	username, _ := claims["username"].(string)
+	tenantID, _ := claims["tenant"].(string)
+	keys := h.throttle.keys(r, tenantID, username)
+	if err = h.throttle.attempt(keys...); err != nil {
+		respondWithThrottled(w, err)
+		return
+	}
+
+	if err = h.verifyCode(userID, req.Code, true); err != nil {
+		if errors.Is(err, errInvalidCode) {
+			h.audit.security(r, tenantID, username, userID, auditTwoFactorFailed)
+			if err = h.throttle.fail(keys...); err != nil {
+				respondWithError(w, http.StatusInternalServerError, err)
+				return
+			}
+			respondWithError(w, http.StatusUnauthorized, errInvalidCode)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err = h.throttle.succeed(keys...); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	jti, _ := claims["jti"].(string)
+	if err = h.sessions.RevokeToken(jti, time.Now().Add(challengeTokenTTL)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dto, err := h.storage.GetUserByID(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	device, _ := claims["device"].(string)
+	sessionID, err := h.createSession(dto.Id, device)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.security(r, dto.TenantId, dto.Username, dto.Id, auditSignin)
+
+	h.respondWithTokens(w, http.StatusCreated, dto, sessionID)
+}
+
+func (h *authHandler) getTwoFactor(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+	userID, _ := props["id"].(string)
+	role, _ := props["role"].(string)
+
+	status := twoFactorStatus{Required: twoFactorRequired(role)}
+
+	tf, err := h.twoFactor.GetTwoFactor(userID)
+	if err != nil && err != sql.ErrNoRows {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err == nil && tf.Enabled {
+		status.Enabled = true
+		if status.RecoveryCodesRemaining, err = h.twoFactor.CountRecoveryCodes(userID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	body, err := json.Marshal(status)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) enrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+	userID, _ := props["id"].(string)
+	username, _ := props["username"].(string)
+
+	tf, err := h.twoFactor.GetTwoFactor(userID)
+	if err != nil && err != sql.ErrNoRows {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err == nil && tf.Enabled {
+		respondWithError(w, http.StatusConflict, errors.New("two-factor authentication is already enabled"))
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dto := dbmodel.TwoFactorDTO{
+		UserId:    userID,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	}
+	if err = h.twoFactor.SaveTwoFactor(dto); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := enrollment{
+		Secret: secret,
+		Uri:    totp.ProvisioningURI(twoFactorIssuer(), username, secret),
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, body)
+}
+
+func (h *authHandler) verifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+	userID, _ := props["id"].(string)
+
+	var req twoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	tf, err := h.twoFactor.GetTwoFactor(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, errors.New("two-factor enrollment not started"))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if tf.Enabled {
+		respondWithError(w, http.StatusConflict, errors.New("two-factor authentication is already enabled"))
+		return
+	}
+
+	if !h.verifyThrottledCode(w, r, userID, req.Code, false) {
+		return
+	}
+
+	tf, err = h.twoFactor.GetTwoFactor(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	tf.Enabled = true
+	if err = h.twoFactor.SaveTwoFactor(tf); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respondWithRecoveryCodes(w, userID)
+}
+
+func (h *authHandler) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+	userID, _ := props["id"].(string)
+
+	var req twoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	if !h.verifyThrottledCode(w, r, userID, req.Code, true) {
+		return
+	}
+
+	h.respondWithRecoveryCodes(w, userID)
+}
+
+func (h *authHandler) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	props, _ := r.Context().Value("props").(jwt.MapClaims)
+	userID, _ := props["id"].(string)
+	role, _ := props["role"].(string)
+
+	if twoFactorRequired(role) {
+		respondWithError(w, http.StatusForbidden, fmt.Errorf("two-factor authentication is required for role %s", role))
+		return
+	}
+
+	var req twoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		r.Body.Close()
+		return
+	}
+	defer r.Body.Close()
+
+	if !h.verifyThrottledCode(w, r, userID, req.Code, true) {
+		return
+	}
+
+	if err := h.twoFactor.DeleteTwoFactor(userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "two-factor authentication disabled"}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) resetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if vars["id"] == "" {
+		respondWithError(w, http.StatusBadRequest, errors.New("user id is required"))
+		return
+	}
+
+	if _, err := userInTenant(h.storage, r, vars["id"]); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, fmt.Errorf("user with id: %s not found, %w", vars["id"], err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.twoFactor.DeleteTwoFactor(vars["id"]); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.audit.record(r, auditTwoFactorReset, "user", vars["id"], nil, nil)
+
+	type response struct {
+		Msg string `json:"message"`
+	}
+	resp := response{Msg: "two-factor authentication reset for user with id: " + vars["id"]}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) respondWithRecoveryCodes(w http.ResponseWriter, userID string) {
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+	for i := 0; i < recoveryCodesCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err)
+			return
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+
+	if err := h.twoFactor.SetRecoveryCodes(userID, hashes); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	body, err := json.Marshal(recoveryCodes{RecoveryCodes: codes})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, body)
+}
+
+func (h *authHandler) verifyThrottledCode(w http.ResponseWriter, r *http.Request, userID, code string, enrolled bool) bool {
+	dto, err := h.storage.GetUserByID(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return false
+	}
+
+	keys := h.throttle.keys(r, dto.TenantId, dto.Username)
+	if err := h.throttle.attempt(keys...); err != nil {
+		respondWithThrottled(w, err)
+		return false
+	}
+
+	if err := h.verifyCode(userID, code, enrolled); err != nil {
+		if errors.Is(err, errInvalidCode) {
+			if err = h.throttle.fail(keys...); err != nil {
+				respondWithError(w, http.StatusInternalServerError, err)
+				return false
+			}
+			respondWithError(w, http.StatusUnauthorized, errInvalidCode)
+			return false
+		}
+		respondWithError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	if err := h.throttle.succeed(keys...); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
+
+func (h *authHandler) verifyCode(userID, code string, enrolled bool) error {
+	tf, err := h.twoFactor.GetTwoFactor(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errInvalidCode
+		}
+		return err
+	}
+	if enrolled && !tf.Enabled {
+		return errInvalidCode
+	}
+
+	if step, ok := totp.Validate(tf.Secret, code, time.Now()); ok {
+		fresh, err := h.twoFactor.UseTwoFactorStep(userID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return fmt.Errorf("%w: code has already been used", errInvalidCode)
+		}
+		return nil
+	}
+
+	if enrolled {
+		used, err := h.twoFactor.UseRecoveryCode(userID, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return err
+		}
+		if used {
+			return nil
+		}
+	}
+	return errInvalidCode
+}
+
+func generateRecoveryCode() (string, error) {
+	buff := make([]byte, 5)
+	if _, err := rand.Read(buff); err != nil {
+		return "", fmt.Errorf("unable to generate recovery code: %w", err)
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(buff))
+	return code[:4] + "-" + code[4:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+func twoFactorRequired(role string) bool {
+	for _, required := range splitList(os.Getenv("APP_2FA_REQUIRED_ROLES")) {
+		if required == role {
+			return true
+		}
+	}
+	return false
+}
+
+func twoFactorIssuer() string {
+	if issuer := os.Getenv("APP_2FA_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "cloud-library"
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/mail"
 )
 
 func respondWithJSON(w http.ResponseWriter, code int, payload []byte) {
@@ -12,6 +13,12 @@ func respondWithJSON(w http.ResponseWriter, code int, payload []byte) {
 	w.Write(payload)
 }
 
+func respondWithXML(w http.ResponseWriter, code int, contentType string, payload []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	w.Write(payload)
+}
+
 func respondWithError(w http.ResponseWriter, code int, err error) {
 	type response struct {
 		Msg string `json:"message"`
@@ -25,3 +32,8 @@ func respondWithError(w http.ResponseWriter, code int, err error) {
 
 	respondWithJSON(w, code, body)
 }
+
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
@@ -0,0 +1,470 @@
+package signing
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/google/uuid"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+	"github.com/szwedm/cloud-library/internal/storage"
+)
+
+const (
+	AlgorithmHS256 string = "HS256"
+	AlgorithmRS256 string = "RS256"
+	AlgorithmEdDSA string = "EdDSA"
+)
+
+const (
+	DefaultRotation   = 30 * 24 * time.Hour
+	verificationGrace = time.Hour
+	rsaKeySize        = 2048
+	reloadInterval    = 10 * time.Second
+	encryptedPrefix   = "v1:"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+var ErrEncryptionKeyRequired = errors.New("APP_JWT_KEY_ENCRYPTION_KEY must be set to a base64 encoded 32 byte key for " + AlgorithmRS256 + " and " + AlgorithmEdDSA + " signing")
+
+type key struct {
+	kid        string
+	algorithm  string
+	method     jwt.SigningMethod
+	privateKey interface{}
+	publicKey  interface{}
+	createdAt  time.Time
+	expiresAt  time.Time
+}
+
+type Keyring struct {
+	storage   storage.SigningKeys
+	algorithm string
+	rotation  time.Duration
+	aead      cipher.AEAD
+
+	// loadMu serializes reads of the signing_keys table so a reload
+	// cannot replace the keys with an older snapshot.
+	loadMu sync.Mutex
+	loaded time.Time
+
+	mu   sync.RWMutex
+	keys []key
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// NewKeyring returns a keyring signing with algorithm, HS256 by default.
+// Private keys of the asymmetric algorithms are stored encrypted with
+// encryptionKey, a base64 encoded AES-256 key.
+func NewKeyring(s storage.SigningKeys, algorithm string, rotation time.Duration, encryptionKey string) (*Keyring, error) {
+	switch algorithm {
+	case "":
+		algorithm = AlgorithmHS256
+	case AlgorithmHS256, AlgorithmRS256, AlgorithmEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing algorithm: %s", algorithm)
+	}
+
+	if rotation <= 0 {
+		rotation = DefaultRotation
+	}
+
+	k := &Keyring{
+		storage:   s,
+		algorithm: algorithm,
+		rotation:  rotation,
+	}
+	if algorithm == AlgorithmHS256 {
+		return k, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encryptionKey)
+	if err != nil || len(raw) != 32 {
+		return nil, ErrEncryptionKeyRequired
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	if k.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *Keyring) Rotate() error {
+	if k.algorithm == AlgorithmHS256 {
+		return nil
+	}
+
+	if err := k.storage.DeleteExpiredSigningKeys(); err != nil {
+		return err
+	}
+
+	k.loadMu.Lock()
+	defer k.loadMu.Unlock()
+
+	keys, err := k.load()
+	if err != nil {
+		return err
+	}
+
+	if current, ok := newestKey(keys, k.algorithm); !ok || time.Since(current.createdAt) >= k.rotation {
+		dto, err := k.generateKey()
+		if err != nil {
+			return err
+		}
+		if err = k.storage.CreateSigningKey(dto); err != nil {
+			return err
+		}
+		parsed, err := k.keyFromDTO(dto)
+		if err != nil {
+			return err
+		}
+		keys = append([]key{parsed}, keys...)
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+// reload picks up keys another instance has rotated in, at most once per
+// reloadInterval so tokens with made up kids cannot hammer the database.
+func (k *Keyring) reload() error {
+	k.loadMu.Lock()
+	defer k.loadMu.Unlock()
+
+	if time.Since(k.loaded) < reloadInterval {
+		return nil
+	}
+
+	keys, err := k.load()
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+func (k *Keyring) load() ([]key, error) {
+	dtos, err := k.storage.GetSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+	k.loaded = time.Now()
+
+	keys := make([]key, 0)
+	for _, dto := range dtos {
+		parsed, err := k.keyFromDTO(dto)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, parsed)
+	}
+	return keys, nil
+}
+
+func (k *Keyring) StartRotation(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := k.Rotate(); err != nil {
+				log.Println("signing key rotation failed:", err)
+			}
+		}
+	}()
+}
+
+func (k *Keyring) SigningKey() (string, jwt.SigningMethod, interface{}, error) {
+	if k.algorithm == AlgorithmHS256 {
+		return "", jwt.SigningMethodHS256, []byte(os.Getenv("APP_JWT_SIGN_KEY")), nil
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	current, ok := newestKey(k.keys, k.algorithm)
+	if !ok {
+		return "", nil, nil, ErrUnknownKey
+	}
+	return current.kid, current.method, current.privateKey, nil
+}
+
+func (k *Keyring) Keyfunc(t *jwt.Token) (interface{}, error) {
+	if k.algorithm == AlgorithmHS256 {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %s", t.Header["alg"])
+		}
+		return []byte(os.Getenv("APP_JWT_SIGN_KEY")), nil
+	}
+
+	kid, _ := t.Header["kid"].(string)
+
+	candidate, ok := k.lookup(kid)
+	if !ok {
+		if err := k.reload(); err != nil {
+			log.Println("unable to reload signing keys:", err)
+			return nil, ErrUnknownKey
+		}
+		if candidate, ok = k.lookup(kid); !ok {
+			return nil, ErrUnknownKey
+		}
+	}
+
+	if t.Method.Alg() != candidate.algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %s", t.Header["alg"])
+	}
+	if time.Now().After(candidate.expiresAt) {
+		return nil, ErrUnknownKey
+	}
+	return candidate.publicKey, nil
+}
+
+func (k *Keyring) lookup(kid string) (key, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, candidate := range k.keys {
+		if candidate.kid == kid {
+			return candidate, true
+		}
+	}
+	return key{}, false
+}
+
+func (k *Keyring) JWKS() JSONWebKeySet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JSONWebKeySet{Keys: make([]JSONWebKey, 0)}
+	for _, published := range k.keys {
+		if time.Now().After(published.expiresAt) {
+			continue
+		}
+
+		jwk := JSONWebKey{
+			Kid: published.kid,
+			Use: "sig",
+			Alg: published.algorithm,
+		}
+		switch publicKey := published.publicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func (j JSONWebKey) PublicKey() (interface{}, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus in key %s: %w", j.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent in key %s: %w", j.Kid, err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s in key %s", j.Crv, j.Kid)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate in key %s: %w", j.Kid, err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(j.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate in key %s: %w", j.Kid, err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s in key %s", j.Crv, j.Kid)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Ed25519 key %s: %w", j.Kid, err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size in key %s", j.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s in key %s", j.Kty, j.Kid)
+	}
+}
+
+func (k *Keyring) generateKey() (dbmodel.SigningKeyDTO, error) {
+	var privateKey interface{}
+	var err error
+	switch k.algorithm {
+	case AlgorithmRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, rsaKeySize)
+	case AlgorithmEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return dbmodel.SigningKeyDTO{}, fmt.Errorf("unable to generate signing key: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return dbmodel.SigningKeyDTO{}, fmt.Errorf("unable to encode signing key: %w", err)
+	}
+
+	kid := uuid.NewString()
+	encrypted, err := k.encrypt(kid, der)
+	if err != nil {
+		return dbmodel.SigningKeyDTO{}, fmt.Errorf("unable to encrypt signing key: %w", err)
+	}
+
+	now := time.Now()
+	return dbmodel.SigningKeyDTO{
+		Kid:        kid,
+		Algorithm:  k.algorithm,
+		PrivateKey: encrypted,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(k.rotation + verificationGrace),
+	}, nil
+}
+
+// encrypt seals der with the kid as additional data, so a stored key
+// cannot be moved to another row.
+func (k *Keyring) encrypt(kid string, der []byte) (string, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := k.aead.Seal(nonce, nonce, der, []byte(kid))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *Keyring) decrypt(dto dbmodel.SigningKeyDTO) ([]byte, error) {
+	// keys written before encryption was introduced are plain PEM, they
+	// are accepted until they expire
+	if !strings.HasPrefix(dto.PrivateKey, encryptedPrefix) {
+		block, _ := pem.Decode([]byte(dto.PrivateKey))
+		if block == nil {
+			return nil, fmt.Errorf("signing key %s is not PEM encoded", dto.Kid)
+		}
+		return block.Bytes, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(dto.PrivateKey, encryptedPrefix))
+	if err != nil || len(sealed) < k.aead.NonceSize() {
+		return nil, fmt.Errorf("signing key %s is not encrypted correctly", dto.Kid)
+	}
+	nonce, ciphertext := sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():]
+	der, err := k.aead.Open(nil, nonce, ciphertext, []byte(dto.Kid))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt signing key %s, check APP_JWT_KEY_ENCRYPTION_KEY: %w", dto.Kid, err)
+	}
+	return der, nil
+}
+
+func (k *Keyring) keyFromDTO(dto dbmodel.SigningKeyDTO) (key, error) {
+	der, err := k.decrypt(dto)
+	if err != nil {
+		return key{}, err
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return key{}, fmt.Errorf("unable to parse signing key %s: %w", dto.Kid, err)
+	}
+
+	parsed := key{
+		kid:        dto.Kid,
+		algorithm:  dto.Algorithm,
+		privateKey: privateKey,
+		createdAt:  dto.CreatedAt,
+		expiresAt:  dto.ExpiresAt,
+	}
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		parsed.method = jwt.SigningMethodRS256
+		parsed.publicKey = &privateKey.PublicKey
+	case ed25519.PrivateKey:
+		parsed.method = SigningMethodEdDSA
+		parsed.publicKey = privateKey.Public()
+	default:
+		return key{}, fmt.Errorf("unsupported signing key type %T for key %s", privateKey, dto.Kid)
+	}
+	if parsed.method.Alg() != dto.Algorithm {
+		return key{}, fmt.Errorf("signing key %s does not match algorithm %s", dto.Kid, dto.Algorithm)
+	}
+	return parsed, nil
+}
+
+func newestKey(keys []key, algorithm string) (key, bool) {
+	var newest key
+	found := false
+	for _, candidate := range keys {
+		if candidate.algorithm != algorithm {
+			continue
+		}
+		if !found || candidate.createdAt.After(newest.createdAt) {
+			newest = candidate
+			found = true
+		}
+	}
+	return newest, found
+}
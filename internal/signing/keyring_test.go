@@ -0,0 +1,190 @@
+package signing
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+type fakeSigningKeys struct {
+	mu    sync.Mutex
+	keys  []dbmodel.SigningKeyDTO
+	loads int
+}
+
+func (f *fakeSigningKeys) GetSigningKeys() ([]dbmodel.SigningKeyDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.loads++
+	return append([]dbmodel.SigningKeyDTO(nil), f.keys...), nil
+}
+
+func (f *fakeSigningKeys) CreateSigningKey(dto dbmodel.SigningKeyDTO) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys = append(f.keys, dto)
+	return nil
+}
+
+func (f *fakeSigningKeys) DeleteExpiredSigningKeys() error {
+	return nil
+}
+
+func encryptionKey(t *testing.T) string {
+	t.Helper()
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func signedToken(t *testing.T, k *Keyring) string {
+	t.Helper()
+	kid, method, privateKey, err := k.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwt.NewWithClaims(method, jwt.MapClaims{"id": "alice"})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestNewKeyring(t *testing.T) {
+	tests := []struct {
+		name          string
+		algorithm     string
+		encryptionKey string
+		want          string
+		wantErr       bool
+	}{
+		{name: "default", want: AlgorithmHS256},
+		{name: "eddsa", algorithm: AlgorithmEdDSA, encryptionKey: encryptionKey(t), want: AlgorithmEdDSA},
+		{name: "rs256 without encryption key", algorithm: AlgorithmRS256, wantErr: true},
+		{name: "short encryption key", algorithm: AlgorithmEdDSA, encryptionKey: base64.StdEncoding.EncodeToString([]byte("short")), wantErr: true},
+		{name: "unsupported", algorithm: "none", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := NewKeyring(&fakeSigningKeys{}, tt.algorithm, 0, tt.encryptionKey)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if k.algorithm != tt.want {
+				t.Errorf("algorithm = %s, want %s", k.algorithm, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyringEncryptsPrivateKeys(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			st := &fakeSigningKeys{}
+			secret := encryptionKey(t)
+			k, err := NewKeyring(st, algorithm, 0, secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = k.Rotate(); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(st.keys) != 1 {
+				t.Fatalf("stored %d keys, want 1", len(st.keys))
+			}
+			if strings.Contains(st.keys[0].PrivateKey, "PRIVATE KEY") {
+				t.Error("private key is stored in plain text")
+			}
+
+			restarted, _ := NewKeyring(st, algorithm, 0, secret)
+			if err = restarted.Rotate(); err != nil {
+				t.Fatalf("unable to load the stored key: %v", err)
+			}
+			if _, err = jwt.Parse(signedToken(t, k), restarted.Keyfunc); err != nil {
+				t.Errorf("token of the stored key is rejected: %v", err)
+			}
+
+			wrongKey, _ := NewKeyring(st, algorithm, 0, encryptionKey(t))
+			if err = wrongKey.Rotate(); err == nil {
+				t.Error("stored key was decrypted with another encryption key")
+			}
+		})
+	}
+}
+
+func TestKeyringDecryptRejectsMovedKey(t *testing.T) {
+	st := &fakeSigningKeys{}
+	k, _ := NewKeyring(st, AlgorithmEdDSA, 0, encryptionKey(t))
+	dto, err := k.generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dto.Kid = "another"
+	if _, err = k.keyFromDTO(dto); err == nil {
+		t.Error("key was decrypted under another kid")
+	}
+}
+
+func TestKeyfuncReloadsUnknownKid(t *testing.T) {
+	st := &fakeSigningKeys{}
+	secret := encryptionKey(t)
+	first, _ := NewKeyring(st, AlgorithmEdDSA, time.Hour, secret)
+	second, _ := NewKeyring(st, AlgorithmEdDSA, time.Hour, secret)
+	if err := first.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// another instance rotates in a new key after the reload interval
+	dto, err := first.generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dto.CreatedAt = time.Now().Add(time.Minute)
+	st.CreateSigningKey(dto)
+	first.loaded = time.Time{}
+	if err = first.reload(); err != nil {
+		t.Fatal(err)
+	}
+	token := signedToken(t, first)
+
+	second.loaded = time.Time{}
+	if _, err = jwt.Parse(token, second.Keyfunc); err != nil {
+		t.Fatalf("token of a rotated key is rejected: %v", err)
+	}
+
+	loads := st.loads
+	forged := jwt.NewWithClaims(SigningMethodEdDSA, jwt.MapClaims{"id": "alice"})
+	forged.Header["kid"] = "unknown"
+	for i := 0; i < 3; i++ {
+		_, err = second.Keyfunc(forged)
+		if !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("Keyfunc(unknown kid) = %v, want %v", err, ErrUnknownKey)
+		}
+	}
+	if st.loads != loads {
+		t.Errorf("unknown kids reloaded the keys %d times within the reload interval", st.loads-loads)
+	}
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const (
+	RestrictedBooksTable = "restricted_books"
+	GrantsTable          = "acl_grants"
+)
+
+type acl struct {
+	db *sql.DB
+}
+
+func (a *acl) IsBookRestricted(bookID string) (bool, error) {
+	stmt := "SELECT EXISTS(SELECT 1 FROM " + RestrictedBooksTable + " WHERE book_id=$1)"
+	row := a.db.QueryRow(stmt, bookID)
+
+	var restricted bool
+	err := row.Scan(&restricted)
+	return restricted, err
+}
+
+func (a *acl) SetBookRestricted(bookID string, restricted bool) error {
+	stmt := "DELETE FROM " + RestrictedBooksTable + " WHERE book_id=$1"
+	if restricted {
+		stmt = "INSERT INTO " + RestrictedBooksTable + "(book_id) VALUES($1) ON CONFLICT DO NOTHING"
+	}
+	_, err := a.db.Exec(stmt, bookID)
+	return err
+}
+
+func (a *acl) GetGrants(resourceType, resourceID string) ([]dbmodel.GrantDTO, error) {
+	stmt := "SELECT id, resource_type, resource_id, principal_type, principal_id, created_at FROM " + GrantsTable +
+		" WHERE resource_type=$1 AND resource_id=$2 ORDER BY created_at"
+	rows, err := a.db.Query(stmt, resourceType, resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	dtos := make([]dbmodel.GrantDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.GrantDTO
+		if err := rows.Scan(&dto.Id, &dto.ResourceType, &dto.ResourceId, &dto.PrincipalType, &dto.PrincipalId, &dto.CreatedAt); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
+
+func (a *acl) GetGrantByID(id string) (dbmodel.GrantDTO, error) {
+	stmt := "SELECT id, resource_type, resource_id, principal_type, principal_id, created_at FROM " + GrantsTable + " WHERE id=$1"
+	row := a.db.QueryRow(stmt, id)
+
+	var dto dbmodel.GrantDTO
+	err := row.Scan(&dto.Id, &dto.ResourceType, &dto.ResourceId, &dto.PrincipalType, &dto.PrincipalId, &dto.CreatedAt)
+	if err != nil {
+		return dbmodel.GrantDTO{}, err
+	}
+	return dto, nil
+}
+
+func (a *acl) CreateGrant(dto dbmodel.GrantDTO) (string, error) {
+	stmt := "INSERT INTO " + GrantsTable + "(id, resource_type, resource_id, principal_type, principal_id, created_at) " +
+		"VALUES($1, $2, $3, $4, $5, $6) RETURNING id"
+	row := a.db.QueryRow(stmt, dto.Id, dto.ResourceType, dto.ResourceId, dto.PrincipalType, dto.PrincipalId, dto.CreatedAt)
+
+	var newGrantID string
+	err := row.Scan(&newGrantID)
+	if err != nil {
+		return "", err
+	}
+	return newGrantID, nil
+}
+
+func (a *acl) DeleteGrantByID(id string) error {
+	stmt := "DELETE FROM " + GrantsTable + " WHERE id=$1"
+	_, err := a.db.Exec(stmt, id)
+	return err
+}
+
+func (a *acl) GetHiddenBookIDs(bookIDs []string, userID string, groups []string) ([]string, error) {
+	if len(bookIDs) == 0 {
+		return []string{}, nil
+	}
+
+	// a direct grant opens the book, otherwise a directly restricted book stays
+	// hidden and every restricted collection holding it needs its own grant
+	granted := "((g.principal_type='" + dbmodel.GrantPrincipalUser + "' AND g.principal_id=$2) " +
+		"OR (g.principal_type='" + dbmodel.GrantPrincipalGroup + "' AND g.principal_id=ANY($3)))"
+	stmt := "SELECT b.id FROM unnest($1::uuid[]) AS b(id) WHERE " +
+		"NOT EXISTS(SELECT 1 FROM " + GrantsTable + " g " +
+		"WHERE g.resource_type='" + dbmodel.GrantResourceBook + "' AND g.resource_id=b.id AND " + granted + ") " +
+		"AND (EXISTS(SELECT 1 FROM " + RestrictedBooksTable + " r WHERE r.book_id=b.id) " +
+		"OR EXISTS(SELECT 1 FROM " + BookCollectionsTable + " bc JOIN " + CollectionsTable + " c ON c.id=bc.collection_id " +
+		"WHERE bc.book_id=b.id AND c.restricted AND NOT EXISTS(SELECT 1 FROM " + GrantsTable + " g " +
+		"WHERE g.resource_type='" + dbmodel.GrantResourceCollection + "' AND g.resource_id=c.id AND " + granted + ")))"
+	rows, err := a.db.Query(stmt, pq.Array(bookIDs), userID, pq.Array(groups))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	hidden := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		hidden = append(hidden, id)
+	}
+	return hidden, rows.Err()
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+var aclSchema = []string{
+	"CREATE TABLE " + CollectionsTable + " (id uuid PRIMARY KEY, name text, description text, restricted boolean, tenant_id uuid)",
+	"CREATE TABLE " + BookCollectionsTable + " (book_id uuid, collection_id uuid, PRIMARY KEY (book_id, collection_id))",
+	"CREATE TABLE " + RestrictedBooksTable + " (book_id uuid PRIMARY KEY)",
+	"CREATE TABLE " + GrantsTable + " (id uuid PRIMARY KEY, resource_type text, resource_id uuid, principal_type text, principal_id uuid, created_at timestamptz)",
+}
+
+func TestGetHiddenBookIDs(t *testing.T) {
+	p := testPostgres(t, aclSchema...)
+	acl := p.NewACLStorage()
+	collections := p.NewCollectionsStorage()
+
+	userID := uuid.NewString()
+	groupID := uuid.NewString()
+
+	collection := func(restricted bool, bookIDs ...string) string {
+		id, err := collections.CreateCollection(dbmodel.CollectionDTO{Id: uuid.NewString(), Name: "c", Restricted: restricted, TenantId: dbmodel.DefaultTenantId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = collections.AddBooksToCollection(id, bookIDs); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	grant := func(resourceType, resourceID, principalType, principalID string) {
+		_, err := acl.CreateGrant(dbmodel.GrantDTO{Id: uuid.NewString(), ResourceType: resourceType, ResourceId: resourceID, PrincipalType: principalType, PrincipalId: principalID, CreatedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	restrict := func(bookID string) {
+		if err := acl.SetBookRestricted(bookID, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		setup  func(bookID string)
+		hidden bool
+	}{
+		{name: "unrestricted", setup: func(string) {}},
+		{name: "restricted book", setup: restrict, hidden: true},
+		{name: "restricted book with user grant", setup: func(id string) {
+			restrict(id)
+			grant(dbmodel.GrantResourceBook, id, dbmodel.GrantPrincipalUser, userID)
+		}},
+		{name: "restricted book with group grant", setup: func(id string) {
+			restrict(id)
+			grant(dbmodel.GrantResourceBook, id, dbmodel.GrantPrincipalGroup, groupID)
+		}},
+		{name: "restricted book with grant for someone else", setup: func(id string) {
+			restrict(id)
+			grant(dbmodel.GrantResourceBook, id, dbmodel.GrantPrincipalUser, uuid.NewString())
+		}, hidden: true},
+		{name: "restricted collection", setup: func(id string) { collection(true, id) }, hidden: true},
+		{name: "restricted collection with grant", setup: func(id string) {
+			grant(dbmodel.GrantResourceCollection, collection(true, id), dbmodel.GrantPrincipalUser, userID)
+		}},
+		{name: "grant on one of two restricted collections", setup: func(id string) {
+			grant(dbmodel.GrantResourceCollection, collection(true, id), dbmodel.GrantPrincipalUser, userID)
+			collection(true, id)
+		}, hidden: true},
+		{name: "grants on both restricted collections", setup: func(id string) {
+			grant(dbmodel.GrantResourceCollection, collection(true, id), dbmodel.GrantPrincipalUser, userID)
+			grant(dbmodel.GrantResourceCollection, collection(true, id), dbmodel.GrantPrincipalGroup, groupID)
+		}},
+		{name: "grant on an open collection", setup: func(id string) {
+			collection(true, id)
+			grant(dbmodel.GrantResourceCollection, collection(false, id), dbmodel.GrantPrincipalUser, userID)
+		}, hidden: true},
+		{name: "collection grant on a restricted book", setup: func(id string) {
+			restrict(id)
+			grant(dbmodel.GrantResourceCollection, collection(true, id), dbmodel.GrantPrincipalUser, userID)
+		}, hidden: true},
+		{name: "book grant inside restricted collections", setup: func(id string) {
+			collection(true, id)
+			collection(true, id)
+			grant(dbmodel.GrantResourceBook, id, dbmodel.GrantPrincipalUser, userID)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bookID := uuid.NewString()
+			tt.setup(bookID)
+
+			hidden, err := acl.GetHiddenBookIDs([]string{bookID}, userID, []string{groupID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(hidden) == 1; got != tt.hidden {
+				t.Errorf("hidden = %v, want %v", got, tt.hidden)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const APIKeysTable = "api_keys"
+
+const apiKeyColumns = "id, user_id, name, prefix, hash, scopes, created_at, last_used_at, expires_at, revoked"
+
+type apiKeys struct {
+	db *sql.DB
+}
+
+func (a *apiKeys) GetAPIKeysByUserID(userID string) ([]dbmodel.APIKeyDTO, error) {
+	stmt := "SELECT " + apiKeyColumns + " FROM " + APIKeysTable + " WHERE user_id=$1 ORDER BY created_at DESC"
+	rows, err := a.db.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	dtos := make([]dbmodel.APIKeyDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.APIKeyDTO
+		if err := rows.Scan(&dto.Id, &dto.UserId, &dto.Name, &dto.Prefix, &dto.Hash, pq.Array(&dto.Scopes),
+			&dto.CreatedAt, &dto.LastUsedAt, &dto.ExpiresAt, &dto.Revoked); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
+
+func (a *apiKeys) GetAPIKeyByID(id string) (dbmodel.APIKeyDTO, error) {
+	stmt := "SELECT " + apiKeyColumns + " FROM " + APIKeysTable + " WHERE id=$1"
+	return a.scanAPIKey(a.db.QueryRow(stmt, id))
+}
+
+func (a *apiKeys) GetAPIKeyByHash(hash string) (dbmodel.APIKeyDTO, error) {
+	stmt := "SELECT " + apiKeyColumns + " FROM " + APIKeysTable + " WHERE hash=$1"
+	return a.scanAPIKey(a.db.QueryRow(stmt, hash))
+}
+
+func (a *apiKeys) CreateAPIKey(dto dbmodel.APIKeyDTO) (string, error) {
+	stmt := "INSERT INTO " + APIKeysTable + "(" + apiKeyColumns + ") " +
+		"VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id"
+	row := a.db.QueryRow(stmt, dto.Id, dto.UserId, dto.Name, dto.Prefix, dto.Hash, pq.Array(dto.Scopes),
+		dto.CreatedAt, dto.LastUsedAt, dto.ExpiresAt, dto.Revoked)
+
+	var newAPIKeyID string
+	err := row.Scan(&newAPIKeyID)
+	if err != nil {
+		return "", err
+	}
+	return newAPIKeyID, nil
+}
+
+func (a *apiKeys) TouchAPIKey(id string, usedAt time.Time) error {
+	stmt := "UPDATE " + APIKeysTable + " SET last_used_at=$2 WHERE id=$1"
+	_, err := a.db.Exec(stmt, id, usedAt)
+	return err
+}
+
+func (a *apiKeys) RevokeAPIKey(id string) error {
+	stmt := "UPDATE " + APIKeysTable + " SET revoked=true WHERE id=$1"
+	_, err := a.db.Exec(stmt, id)
+	return err
+}
+
+func (a *apiKeys) RevokeAPIKeysByUserID(userID string) error {
+	stmt := "UPDATE " + APIKeysTable + " SET revoked=true WHERE user_id=$1"
+	_, err := a.db.Exec(stmt, userID)
+	return err
+}
+
+func (a *apiKeys) scanAPIKey(row *sql.Row) (dbmodel.APIKeyDTO, error) {
+	var dto dbmodel.APIKeyDTO
+	err := row.Scan(&dto.Id, &dto.UserId, &dto.Name, &dto.Prefix, &dto.Hash, pq.Array(&dto.Scopes),
+		&dto.CreatedAt, &dto.LastUsedAt, &dto.ExpiresAt, &dto.Revoked)
+	if err != nil {
+		return dbmodel.APIKeyDTO{}, err
+	}
+	return dto, nil
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const AuditLogTable = "audit_log"
+
+const auditColumns = "id, tenant_id, actor_id, actor_name, action, target_type, target_id, changes, ip, created_at"
+
+type audit struct {
+	db *sql.DB
+}
+
+func (a *audit) GetAuditEvents(filter dbmodel.AuditFilter) ([]dbmodel.AuditEventDTO, error) {
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if filter.TenantId != "" {
+		addCondition("tenant_id=?", filter.TenantId)
+	}
+	if filter.ActorId != "" {
+		addCondition("actor_id=?", filter.ActorId)
+	}
+	if filter.Action != "" {
+		addCondition("action LIKE ? || '%'", filter.Action)
+	}
+	if filter.TargetType != "" {
+		addCondition("target_type=?", filter.TargetType)
+	}
+	if filter.TargetId != "" {
+		addCondition("target_id=?", filter.TargetId)
+	}
+	if !filter.From.IsZero() {
+		addCondition("created_at>=?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("created_at<?", filter.To)
+	}
+
+	stmt := "SELECT " + auditColumns + " FROM " + AuditLogTable
+	if len(conditions) > 0 {
+		stmt += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	stmt += " ORDER BY created_at DESC"
+	if filter.Limit > 0 {
+		stmt += " LIMIT " + strconv.Itoa(filter.Limit)
+	}
+	rows, err := a.db.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	dtos := make([]dbmodel.AuditEventDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.AuditEventDTO
+		var changes []byte
+		if err := rows.Scan(&dto.Id, &dto.TenantId, &dto.ActorId, &dto.ActorName, &dto.Action,
+			&dto.TargetType, &dto.TargetId, &changes, &dto.Ip, &dto.CreatedAt); err != nil {
+			return nil, err
+		}
+		dto.Changes = changes
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
+
+func (a *audit) CreateAuditEvent(dto dbmodel.AuditEventDTO) error {
+	var changes interface{}
+	if len(dto.Changes) > 0 {
+		changes = string(dto.Changes)
+	}
+
+	stmt := "INSERT INTO " + AuditLogTable + "(" + auditColumns + ") " +
+		"VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)"
+	_, err := a.db.Exec(stmt, dto.Id, dto.TenantId, dto.ActorId, dto.ActorName, dto.Action,
+		dto.TargetType, dto.TargetId, changes, dto.Ip, dto.CreatedAt)
+	return err
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const (
+	AuthorsTable     = "authors"
+	BookAuthorsTable = "book_authors"
+)
+
+type AuthorNotFoundErr struct{}
+
+func (e *AuthorNotFoundErr) Error() string {
+	return "author not found"
+}
+
+type authors struct {
+	db *sql.DB
+}
+
+func (a *authors) GetAuthors(tenantID string) ([]dbmodel.AuthorDTO, error) {
+	stmt := "SELECT id, name, tenant_id FROM " + AuthorsTable + " WHERE tenant_id=$1 ORDER BY name"
+	rows, err := a.db.Query(stmt, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanAuthors(rows)
+}
+
+func (a *authors) GetAuthorByID(id string) (dbmodel.AuthorDTO, error) {
+	stmt := "SELECT id, name, tenant_id FROM " + AuthorsTable + " WHERE id=$1"
+	row := a.db.QueryRow(stmt, id)
+
+	var dto dbmodel.AuthorDTO
+	err := row.Scan(&dto.Id, &dto.Name, &dto.TenantId)
+	if err != nil {
+		return dbmodel.AuthorDTO{}, err
+	}
+	return dto, nil
+}
+
+func (a *authors) GetAuthorByName(tenantID, name string) (dbmodel.AuthorDTO, error) {
+	stmt := "SELECT id, name, tenant_id FROM " + AuthorsTable + " WHERE tenant_id=$1 AND lower(name)=lower($2)"
+	row := a.db.QueryRow(stmt, tenantID, name)
+
+	var dto dbmodel.AuthorDTO
+	err := row.Scan(&dto.Id, &dto.Name, &dto.TenantId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dbmodel.AuthorDTO{}, &AuthorNotFoundErr{}
+		}
+		return dbmodel.AuthorDTO{}, err
+	}
+	return dto, nil
+}
+
+func (a *authors) GetAuthorsByBookID(bookID string) ([]dbmodel.AuthorDTO, error) {
+	stmt := "SELECT a.id, a.name, a.tenant_id FROM " + AuthorsTable + " a " +
+		"JOIN " + BookAuthorsTable + " ba ON ba.author_id=a.id WHERE ba.book_id=$1 ORDER BY a.name"
+	rows, err := a.db.Query(stmt, bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanAuthors(rows)
+}
+
+func (a *authors) CreateAuthor(dto dbmodel.AuthorDTO) (string, error) {
+	stmt := "INSERT INTO " + AuthorsTable + "(id, name, tenant_id) " +
+		"VALUES($1, $2, $3) RETURNING id"
+	row := a.db.QueryRow(stmt, dto.Id, dto.Name, dto.TenantId)
+
+	var newAuthorID string
+	err := row.Scan(&newAuthorID)
+	if err != nil {
+		return "", err
+	}
+	return newAuthorID, nil
+}
+
+func (a *authors) SetBookAuthors(bookID string, authorIDs []string) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM "+BookAuthorsTable+" WHERE book_id=$1", bookID); err != nil {
+		return err
+	}
+
+	stmt := "INSERT INTO " + BookAuthorsTable + "(book_id, author_id) VALUES($1, $2) ON CONFLICT DO NOTHING"
+	for _, authorID := range authorIDs {
+		if _, err := tx.Exec(stmt, bookID, authorID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (a *authors) MergeAuthors(tenantID, targetID string, sourceIDs []string) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sources := "SELECT id FROM " + AuthorsTable + " WHERE id = ANY($1) AND tenant_id=$2"
+	stmt := "INSERT INTO " + BookAuthorsTable + "(book_id, author_id) " +
+		"SELECT book_id, $3 FROM " + BookAuthorsTable + " WHERE author_id IN (" + sources + ") ON CONFLICT DO NOTHING"
+	if _, err := tx.Exec(stmt, pq.Array(sourceIDs), tenantID, targetID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM "+BookAuthorsTable+" WHERE author_id IN ("+sources+")", pq.Array(sourceIDs), tenantID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM "+AuthorsTable+" WHERE id = ANY($1) AND tenant_id=$2", pq.Array(sourceIDs), tenantID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func scanAuthors(rows *sql.Rows) ([]dbmodel.AuthorDTO, error) {
+	dtos := make([]dbmodel.AuthorDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.AuthorDTO
+		if err := rows.Scan(&dto.Id, &dto.Name, &dto.TenantId); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
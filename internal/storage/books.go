@@ -2,52 +2,146 @@ package storage
 
 import (
 	"database/sql"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/szwedm/cloud-library/internal/dbmodel"
 )
 
 const BooksTable = "books"
 
+const bookColumns = "id, title, isbn10, isbn13, publisher, publication_year, edition, language, series, series_index, description, tenant_id, file_size, uploaded_by"
+
 type books struct {
 	db *sql.DB
 }
 
-func (b *books) GetBooks() ([]dbmodel.BookDTO, error) {
-	stmt := "SELECT * FROM " + BooksTable
-	rows, err := b.db.Query(stmt)
+func (b *books) GetBooks(filter dbmodel.BookFilter) ([]dbmodel.BookDTO, error) {
+	conditions := []string{"deleted_at IS NULL"}
+	args := make([]interface{}, 0)
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if filter.TenantId != "" {
+		addCondition("tenant_id=?", filter.TenantId)
+	}
+	if filter.Title != "" {
+		addCondition("title ILIKE '%' || ? || '%'", filter.Title)
+	}
+	if filter.Isbn != "" {
+		addCondition("(isbn10=? OR isbn13=?)", filter.Isbn)
+	}
+	if filter.Publisher != "" {
+		addCondition("publisher ILIKE '%' || ? || '%'", filter.Publisher)
+	}
+	if filter.PublicationYear != 0 {
+		addCondition("publication_year=?", filter.PublicationYear)
+	}
+	if filter.Edition != "" {
+		addCondition("edition ILIKE ?", filter.Edition)
+	}
+	if filter.Language != "" {
+		addCondition("language=?", filter.Language)
+	}
+	if filter.Series != "" {
+		addCondition("series ILIKE '%' || ? || '%'", filter.Series)
+	}
+	if filter.SeriesIndex != 0 {
+		addCondition("series_index=?", filter.SeriesIndex)
+	}
+	if filter.Description != "" {
+		addCondition("description ILIKE '%' || ? || '%'", filter.Description)
+	}
+
+	stmt := "SELECT " + bookColumns + " FROM " + BooksTable + " WHERE " + strings.Join(conditions, " AND ")
+	rows, err := b.db.Query(stmt, args...)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	dtos := make([]dbmodel.BookDTO, 0)
-	for rows.Next() {
-		var dto dbmodel.BookDTO
-		if err := rows.Scan(&dto.Id, &dto.Title, &dto.Author, &dto.Subject); err != nil {
-			return nil, err
-		}
-		dtos = append(dtos, dto)
-	}
-	return dtos, nil
+	return scanBooks(rows)
 }
 
 func (b *books) GetBookByID(id string) (dbmodel.BookDTO, error) {
-	stmt := "SELECT * FROM " + BooksTable + " WHERE id=$1"
+	stmt := "SELECT " + bookColumns + " FROM " + BooksTable + " WHERE id=$1 AND deleted_at IS NULL"
 	row := b.db.QueryRow(stmt, id)
 
-	var dto dbmodel.BookDTO
-	err := row.Scan(&dto.Id, &dto.Title, &dto.Author, &dto.Subject)
+	dto, err := scanBook(row)
 	if err != nil {
 		return dbmodel.BookDTO{}, err
 	}
 	return dto, nil
 }
 
+func (b *books) GetBooksByAuthorID(authorID string) ([]dbmodel.BookDTO, error) {
+	stmt := "SELECT " + bookColumns + " FROM " + BooksTable +
+		" WHERE deleted_at IS NULL AND id IN (SELECT book_id FROM " + BookAuthorsTable + " WHERE author_id=$1)"
+	rows, err := b.db.Query(stmt, authorID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanBooks(rows)
+}
+
+func (b *books) GetBooksBySubjectID(subjectID string, withDescendants bool) ([]dbmodel.BookDTO, error) {
+	stmt := "SELECT " + bookColumns + " FROM " + BooksTable +
+		" WHERE deleted_at IS NULL AND id IN (SELECT book_id FROM " + BookSubjectsTable + " WHERE subject_id=$1)"
+	if withDescendants {
+		stmt = "WITH RECURSIVE tree AS (" +
+			"SELECT id FROM " + SubjectsTable + " WHERE id=$1 " +
+			"UNION SELECT s.id FROM " + SubjectsTable + " s JOIN tree t ON s.parent_id=t.id" +
+			") SELECT " + bookColumns + " FROM " + BooksTable +
+			" WHERE deleted_at IS NULL AND id IN (SELECT book_id FROM " + BookSubjectsTable + " WHERE subject_id IN (SELECT id FROM tree))"
+	}
+	rows, err := b.db.Query(stmt, subjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanBooks(rows)
+}
+
+func (b *books) GetBooksByCollectionID(collectionID string) ([]dbmodel.BookDTO, error) {
+	stmt := "SELECT " + bookColumns + " FROM " + BooksTable +
+		" WHERE deleted_at IS NULL AND id IN (SELECT book_id FROM " + BookCollectionsTable + " WHERE collection_id=$1)"
+	rows, err := b.db.Query(stmt, collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanBooks(rows)
+}
+
+func (b *books) GetBooksByTagID(tagID string) ([]dbmodel.BookDTO, error) {
+	stmt := "SELECT " + bookColumns + " FROM " + BooksTable +
+		" WHERE deleted_at IS NULL AND id IN (SELECT book_id FROM " + BookTagsTable + " WHERE tag_id=$1)"
+	rows, err := b.db.Query(stmt, tagID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanBooks(rows)
+}
+
 func (b *books) CreateBook(dto dbmodel.BookDTO) (string, error) {
-	stmt := "INSERT INTO " + BooksTable + "(id, title, author, subject) " +
-		"VALUES($1, $2, $3, $4) RETURNING id"
-	row := b.db.QueryRow(stmt, dto.Id, dto.Title, dto.Author, dto.Subject)
+	stmt := "INSERT INTO " + BooksTable + "(" + bookColumns + ") " +
+		"VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING id"
+	row := b.db.QueryRow(stmt, dto.Id, dto.Title, dto.Isbn10, dto.Isbn13, dto.Publisher, dto.PublicationYear,
+		dto.Edition, dto.Language, dto.Series, dto.SeriesIndex, dto.Description, dto.TenantId, dto.FileSize, dto.UploadedBy)
 
 	var newBookID string
 	err := row.Scan(&newBookID)
@@ -58,13 +152,169 @@ func (b *books) CreateBook(dto dbmodel.BookDTO) (string, error) {
 }
 
 func (b *books) UpdateBook(dto dbmodel.BookDTO) error {
-	stmt := "UPDATE " + BooksTable + " SET title=$1, author=$2, subject=$3 WHERE id=$4"
-	_, err := b.db.Exec(stmt, dto.Title, dto.Author, dto.Subject, dto.Id)
+	stmt := "UPDATE " + BooksTable + " SET title=$1, isbn10=$2, isbn13=$3, publisher=$4, publication_year=$5, " +
+		"edition=$6, language=$7, series=$8, series_index=$9, description=$10 WHERE id=$11"
+	_, err := b.db.Exec(stmt, dto.Title, dto.Isbn10, dto.Isbn13, dto.Publisher, dto.PublicationYear,
+		dto.Edition, dto.Language, dto.Series, dto.SeriesIndex, dto.Description, dto.Id)
 	return err
 }
 
-func (b *books) DeleteBookByID(id string) error {
-	stmt := "DELETE FROM " + BooksTable + " WHERE id=$1"
+func (b *books) GetDeletedBooks(tenantID string) ([]dbmodel.BookDTO, error) {
+	stmt := "SELECT " + bookColumns + ", deleted_at FROM " + BooksTable +
+		" WHERE tenant_id=$1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC"
+	rows, err := b.db.Query(stmt, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanDeletedBooks(rows)
+}
+
+func (b *books) GetDeletedBookByID(id string) (dbmodel.BookDTO, error) {
+	stmt := "SELECT " + bookColumns + ", deleted_at FROM " + BooksTable + " WHERE id=$1 AND deleted_at IS NOT NULL"
+	row := b.db.QueryRow(stmt, id)
+
+	dto, err := scanDeletedBook(row)
+	if err != nil {
+		return dbmodel.BookDTO{}, err
+	}
+	return dto, nil
+}
+
+func (b *books) GetBooksDeletedBefore(before time.Time) ([]dbmodel.BookDTO, error) {
+	stmt := "SELECT " + bookColumns + ", deleted_at FROM " + BooksTable + " WHERE deleted_at < $1"
+	rows, err := b.db.Query(stmt, before)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanDeletedBooks(rows)
+}
+
+func (b *books) TrashBookByID(id string, deletedAt time.Time) error {
+	stmt := "UPDATE " + BooksTable + " SET deleted_at=$2 WHERE id=$1"
+	_, err := b.db.Exec(stmt, id, deletedAt)
+	return err
+}
+
+func (b *books) RestoreBookByID(id string) error {
+	stmt := "UPDATE " + BooksTable + " SET deleted_at=NULL WHERE id=$1"
 	_, err := b.db.Exec(stmt, id)
 	return err
 }
+
+func (b *books) DeleteBookByID(id string) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{BookAuthorsTable, BookSubjectsTable, BookTagsTable, BookCollectionsTable, RestrictedBooksTable, BookRevisionsTable} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE book_id=$1", id); err != nil {
+			return err
+		}
+	}
+	grants := "DELETE FROM " + GrantsTable + " WHERE resource_type=$1 AND resource_id=$2"
+	if _, err := tx.Exec(grants, dbmodel.GrantResourceBook, id); err != nil {
+		return err
+	}
+
+	stmt := "DELETE FROM " + BooksTable + " WHERE id=$1"
+	if _, err := tx.Exec(stmt, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (b *books) GetStorageUsage(tenantID string) (int64, error) {
+	stmt := "SELECT COALESCE(SUM(file_size), 0) FROM " + BooksTable + " WHERE tenant_id=$1"
+	row := b.db.QueryRow(stmt, tenantID)
+
+	var bytes int64
+	if err := row.Scan(&bytes); err != nil {
+		return 0, err
+	}
+	return bytes, nil
+}
+
+func (b *books) GetUploaderStorageUsage(userID string) (int64, error) {
+	stmt := "SELECT COALESCE(SUM(file_size), 0) FROM " + BooksTable + " WHERE uploaded_by=$1"
+	row := b.db.QueryRow(stmt, userID)
+
+	var bytes int64
+	if err := row.Scan(&bytes); err != nil {
+		return 0, err
+	}
+	return bytes, nil
+}
+
+func (b *books) GetStorageUsageByUploader(tenantID string) ([]dbmodel.StorageUsageDTO, error) {
+	stmt := "SELECT uploaded_by, COUNT(*), COALESCE(SUM(file_size), 0) FROM " + BooksTable +
+		" WHERE tenant_id=$1 GROUP BY uploaded_by ORDER BY 3 DESC"
+	rows, err := b.db.Query(stmt, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	dtos := make([]dbmodel.StorageUsageDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.StorageUsageDTO
+		if err := rows.Scan(&dto.UserId, &dto.Books, &dto.Bytes); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func bookFields(dto *dbmodel.BookDTO) []interface{} {
+	return []interface{}{&dto.Id, &dto.Title, &dto.Isbn10, &dto.Isbn13, &dto.Publisher, &dto.PublicationYear,
+		&dto.Edition, &dto.Language, &dto.Series, &dto.SeriesIndex, &dto.Description, &dto.TenantId, &dto.FileSize, &dto.UploadedBy}
+}
+
+func scanBook(row rowScanner) (dbmodel.BookDTO, error) {
+	var dto dbmodel.BookDTO
+	err := row.Scan(bookFields(&dto)...)
+	return dto, err
+}
+
+func scanDeletedBook(row rowScanner) (dbmodel.BookDTO, error) {
+	var dto dbmodel.BookDTO
+	err := row.Scan(append(bookFields(&dto), &dto.DeletedAt)...)
+	return dto, err
+}
+
+func scanBooks(rows *sql.Rows) ([]dbmodel.BookDTO, error) {
+	dtos := make([]dbmodel.BookDTO, 0)
+	for rows.Next() {
+		dto, err := scanBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
+
+func scanDeletedBooks(rows *sql.Rows) ([]dbmodel.BookDTO, error) {
+	dtos := make([]dbmodel.BookDTO, 0)
+	for rows.Next() {
+		dto, err := scanDeletedBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
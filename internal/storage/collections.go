@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const (
+	CollectionsTable     = "collections"
+	BookCollectionsTable = "book_collections"
+)
+
+type collections struct {
+	db *sql.DB
+}
+
+func (c *collections) GetCollections(tenantID string) ([]dbmodel.CollectionDTO, error) {
+	stmt := "SELECT id, name, description, restricted, tenant_id FROM " + CollectionsTable + " WHERE tenant_id=$1 ORDER BY name"
+	rows, err := c.db.Query(stmt, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanCollections(rows)
+}
+
+func (c *collections) GetCollectionByID(id string) (dbmodel.CollectionDTO, error) {
+	stmt := "SELECT id, name, description, restricted, tenant_id FROM " + CollectionsTable + " WHERE id=$1"
+	row := c.db.QueryRow(stmt, id)
+
+	var dto dbmodel.CollectionDTO
+	err := row.Scan(&dto.Id, &dto.Name, &dto.Description, &dto.Restricted, &dto.TenantId)
+	if err != nil {
+		return dbmodel.CollectionDTO{}, err
+	}
+	return dto, nil
+}
+
+func (c *collections) GetCollectionsByBookID(bookID string) ([]dbmodel.CollectionDTO, error) {
+	stmt := "SELECT id, name, description, restricted, tenant_id FROM " + CollectionsTable +
+		" WHERE id IN (SELECT collection_id FROM " + BookCollectionsTable + " WHERE book_id=$1) ORDER BY name"
+	rows, err := c.db.Query(stmt, bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanCollections(rows)
+}
+
+func (c *collections) CreateCollection(dto dbmodel.CollectionDTO) (string, error) {
+	stmt := "INSERT INTO " + CollectionsTable + "(id, name, description, restricted, tenant_id) " +
+		"VALUES($1, $2, $3, $4, $5) RETURNING id"
+	row := c.db.QueryRow(stmt, dto.Id, dto.Name, dto.Description, dto.Restricted, dto.TenantId)
+
+	var newCollectionID string
+	err := row.Scan(&newCollectionID)
+	if err != nil {
+		return "", err
+	}
+	return newCollectionID, nil
+}
+
+func (c *collections) UpdateCollection(dto dbmodel.CollectionDTO) error {
+	stmt := "UPDATE " + CollectionsTable + " SET name=$1, description=$2, restricted=$3 WHERE id=$4"
+	_, err := c.db.Exec(stmt, dto.Name, dto.Description, dto.Restricted, dto.Id)
+	return err
+}
+
+func (c *collections) DeleteCollectionByID(id string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM "+BookCollectionsTable+" WHERE collection_id=$1", id); err != nil {
+		return err
+	}
+	stmt := "DELETE FROM " + GrantsTable + " WHERE resource_type=$1 AND resource_id=$2"
+	if _, err = tx.Exec(stmt, dbmodel.GrantResourceCollection, id); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM "+CollectionsTable+" WHERE id=$1", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *collections) AddBooksToCollection(collectionID string, bookIDs []string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, bookID := range bookIDs {
+		stmt := "INSERT INTO " + BookCollectionsTable + "(book_id, collection_id) VALUES($1, $2) ON CONFLICT DO NOTHING"
+		if _, err = tx.Exec(stmt, bookID, collectionID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (c *collections) RemoveBookFromCollection(collectionID, bookID string) error {
+	stmt := "DELETE FROM " + BookCollectionsTable + " WHERE collection_id=$1 AND book_id=$2"
+	_, err := c.db.Exec(stmt, collectionID, bookID)
+	return err
+}
+
+func scanCollections(rows *sql.Rows) ([]dbmodel.CollectionDTO, error) {
+	dtos := make([]dbmodel.CollectionDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.CollectionDTO
+		if err := rows.Scan(&dto.Id, &dto.Name, &dto.Description, &dto.Restricted, &dto.TenantId); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const EmailVerificationsTable = "email_verifications"
+
+type emailVerifications struct {
+	db *sql.DB
+}
+
+func (e *emailVerifications) CreateEmailVerification(dto dbmodel.EmailVerificationDTO) error {
+	if _, err := e.db.Exec("DELETE FROM "+EmailVerificationsTable+" WHERE expires_at < $1", time.Now()); err != nil {
+		return err
+	}
+
+	stmt := "INSERT INTO " + EmailVerificationsTable + "(hash, user_id, email, used, expires_at) VALUES($1, $2, $3, $4, $5)"
+	_, err := e.db.Exec(stmt, dto.Hash, dto.UserId, dto.Email, dto.Used, dto.ExpiresAt)
+	return err
+}
+
+func (e *emailVerifications) UseEmailVerification(hash string) (dbmodel.EmailVerificationDTO, error) {
+	stmt := "UPDATE " + EmailVerificationsTable + " SET used=true WHERE hash=$1 AND used=false AND expires_at > $2 " +
+		"RETURNING hash, user_id, email, used, expires_at"
+	row := e.db.QueryRow(stmt, hash, time.Now())
+
+	var dto dbmodel.EmailVerificationDTO
+	err := row.Scan(&dto.Hash, &dto.UserId, &dto.Email, &dto.Used, &dto.ExpiresAt)
+	if err != nil {
+		return dbmodel.EmailVerificationDTO{}, err
+	}
+	return dto, nil
+}
+
+func (e *emailVerifications) DeleteEmailVerificationsByUserID(userID string) error {
+	stmt := "DELETE FROM " + EmailVerificationsTable + " WHERE user_id=$1"
+	_, err := e.db.Exec(stmt, userID)
+	return err
+}
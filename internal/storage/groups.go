@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const (
+	GroupsTable       = "groups"
+	GroupMembersTable = "group_members"
+)
+
+type GroupNotFoundErr struct{}
+
+func (e *GroupNotFoundErr) Error() string {
+	return "group not found"
+}
+
+type groups struct {
+	db *sql.DB
+}
+
+func (g *groups) GetGroups(tenantID string) ([]dbmodel.GroupDTO, error) {
+	stmt := "SELECT id, name, description, role, tenant_id FROM " + GroupsTable + " WHERE tenant_id=$1 ORDER BY name"
+	rows, err := g.db.Query(stmt, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanGroups(rows)
+}
+
+func (g *groups) GetGroupByID(id string) (dbmodel.GroupDTO, error) {
+	stmt := "SELECT id, name, description, role, tenant_id FROM " + GroupsTable + " WHERE id=$1"
+	row := g.db.QueryRow(stmt, id)
+
+	var dto dbmodel.GroupDTO
+	err := row.Scan(&dto.Id, &dto.Name, &dto.Description, &dto.Role, &dto.TenantId)
+	if err != nil {
+		return dbmodel.GroupDTO{}, err
+	}
+	return dto, nil
+}
+
+func (g *groups) GetGroupByName(tenantID, name string) (dbmodel.GroupDTO, error) {
+	stmt := "SELECT id, name, description, role, tenant_id FROM " + GroupsTable + " WHERE tenant_id=$1 AND lower(name)=lower($2)"
+	row := g.db.QueryRow(stmt, tenantID, name)
+
+	var dto dbmodel.GroupDTO
+	err := row.Scan(&dto.Id, &dto.Name, &dto.Description, &dto.Role, &dto.TenantId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dbmodel.GroupDTO{}, &GroupNotFoundErr{}
+		}
+		return dbmodel.GroupDTO{}, err
+	}
+	return dto, nil
+}
+
+func (g *groups) GetGroupsByUserID(userID string) ([]dbmodel.GroupDTO, error) {
+	stmt := "SELECT g.id, g.name, g.description, g.role, g.tenant_id FROM " + GroupsTable + " g " +
+		"JOIN " + GroupMembersTable + " gm ON gm.group_id=g.id WHERE gm.user_id=$1 ORDER BY g.name"
+	rows, err := g.db.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanGroups(rows)
+}
+
+func (g *groups) CreateGroup(dto dbmodel.GroupDTO) (string, error) {
+	stmt := "INSERT INTO " + GroupsTable + "(id, name, description, role, tenant_id) " +
+		"VALUES($1, $2, $3, $4, $5) RETURNING id"
+	row := g.db.QueryRow(stmt, dto.Id, dto.Name, dto.Description, dto.Role, dto.TenantId)
+
+	var newGroupID string
+	err := row.Scan(&newGroupID)
+	if err != nil {
+		return "", err
+	}
+	return newGroupID, nil
+}
+
+func (g *groups) UpdateGroup(dto dbmodel.GroupDTO) error {
+	stmt := "UPDATE " + GroupsTable + " SET name=$2, description=$3, role=$4 WHERE id=$1"
+	_, err := g.db.Exec(stmt, dto.Id, dto.Name, dto.Description, dto.Role)
+	return err
+}
+
+func (g *groups) DeleteGroupByID(id string) error {
+	tx, err := g.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM "+GroupMembersTable+" WHERE group_id=$1", id); err != nil {
+		return err
+	}
+	stmt := "DELETE FROM " + GrantsTable + " WHERE principal_type=$1 AND principal_id=$2"
+	if _, err = tx.Exec(stmt, dbmodel.GrantPrincipalGroup, id); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM "+GroupsTable+" WHERE id=$1", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (g *groups) GetGroupMembers(groupID string) ([]dbmodel.UserDTO, error) {
+	stmt := "SELECT " + userColumns + " FROM " + UsersTable +
+		" WHERE deleted_at IS NULL AND id IN (SELECT user_id FROM " + GroupMembersTable + " WHERE group_id=$1) ORDER BY username"
+	rows, err := g.db.Query(stmt, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	dtos := make([]dbmodel.UserDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.UserDTO
+		if err := rows.Scan(&dto.Id, &dto.Username, &dto.Password, &dto.Role, &dto.TokenVersion, &dto.Email, &dto.Status, &dto.TenantId); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
+
+func (g *groups) AddGroupMembers(groupID string, userIDs []string) error {
+	stmt := "INSERT INTO " + GroupMembersTable + "(group_id, user_id) " +
+		"SELECT $1, unnest($2::uuid[]) ON CONFLICT DO NOTHING"
+	_, err := g.db.Exec(stmt, groupID, pq.Array(userIDs))
+	return err
+}
+
+func (g *groups) RemoveGroupMember(groupID, userID string) error {
+	stmt := "DELETE FROM " + GroupMembersTable + " WHERE group_id=$1 AND user_id=$2"
+	_, err := g.db.Exec(stmt, groupID, userID)
+	return err
+}
+
+func scanGroups(rows *sql.Rows) ([]dbmodel.GroupDTO, error) {
+	dtos := make([]dbmodel.GroupDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.GroupDTO
+		if err := rows.Scan(&dto.Id, &dto.Name, &dto.Description, &dto.Role, &dto.TenantId); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
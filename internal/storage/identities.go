@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const (
+	IdentitiesTable  = "identities"
+	LoginStatesTable = "login_states"
+)
+
+type identities struct {
+	db *sql.DB
+}
+
+func (i *identities) GetIdentity(issuer, subject string) (dbmodel.IdentityDTO, error) {
+	stmt := "SELECT id, user_id, issuer, subject, email, created_at FROM " + IdentitiesTable + " WHERE issuer=$1 AND subject=$2"
+	row := i.db.QueryRow(stmt, issuer, subject)
+
+	var dto dbmodel.IdentityDTO
+	err := row.Scan(&dto.Id, &dto.UserId, &dto.Issuer, &dto.Subject, &dto.Email, &dto.CreatedAt)
+	if err != nil {
+		return dbmodel.IdentityDTO{}, err
+	}
+	return dto, nil
+}
+
+func (i *identities) GetIdentityByID(id string) (dbmodel.IdentityDTO, error) {
+	stmt := "SELECT id, user_id, issuer, subject, email, created_at FROM " + IdentitiesTable + " WHERE id=$1"
+	row := i.db.QueryRow(stmt, id)
+
+	var dto dbmodel.IdentityDTO
+	err := row.Scan(&dto.Id, &dto.UserId, &dto.Issuer, &dto.Subject, &dto.Email, &dto.CreatedAt)
+	if err != nil {
+		return dbmodel.IdentityDTO{}, err
+	}
+	return dto, nil
+}
+
+func (i *identities) GetIdentitiesByUserID(userID string) ([]dbmodel.IdentityDTO, error) {
+	stmt := "SELECT id, user_id, issuer, subject, email, created_at FROM " + IdentitiesTable + " WHERE user_id=$1 ORDER BY created_at"
+	rows, err := i.db.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	dtos := make([]dbmodel.IdentityDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.IdentityDTO
+		if err := rows.Scan(&dto.Id, &dto.UserId, &dto.Issuer, &dto.Subject, &dto.Email, &dto.CreatedAt); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
+
+func (i *identities) CreateIdentity(dto dbmodel.IdentityDTO) (string, error) {
+	stmt := "INSERT INTO " + IdentitiesTable + "(id, user_id, issuer, subject, email, created_at) VALUES($1, $2, $3, $4, $5, $6) RETURNING id"
+	row := i.db.QueryRow(stmt, dto.Id, dto.UserId, dto.Issuer, dto.Subject, dto.Email, dto.CreatedAt)
+
+	var newIdentityID string
+	err := row.Scan(&newIdentityID)
+	if err != nil {
+		return "", err
+	}
+	return newIdentityID, nil
+}
+
+func (i *identities) DeleteIdentityByID(id string) error {
+	stmt := "DELETE FROM " + IdentitiesTable + " WHERE id=$1"
+	_, err := i.db.Exec(stmt, id)
+	return err
+}
+
+func (i *identities) CreateLoginState(dto dbmodel.LoginStateDTO) error {
+	if _, err := i.db.Exec("DELETE FROM "+LoginStatesTable+" WHERE expires_at < $1", time.Now()); err != nil {
+		return err
+	}
+
+	stmt := "INSERT INTO " + LoginStatesTable + "(state, nonce, verifier, user_id, expires_at) VALUES($1, $2, $3, NULLIF($4, '')::uuid, $5)"
+	_, err := i.db.Exec(stmt, dto.State, dto.Nonce, dto.Verifier, dto.UserId, dto.ExpiresAt)
+	return err
+}
+
+func (i *identities) ConsumeLoginState(state string) (dbmodel.LoginStateDTO, error) {
+	stmt := "DELETE FROM " + LoginStatesTable + " WHERE state=$1 AND expires_at > $2 " +
+		"RETURNING state, nonce, verifier, COALESCE(user_id::text, ''), expires_at"
+	row := i.db.QueryRow(stmt, state, time.Now())
+
+	var dto dbmodel.LoginStateDTO
+	err := row.Scan(&dto.State, &dto.Nonce, &dto.Verifier, &dto.UserId, &dto.ExpiresAt)
+	if err != nil {
+		return dbmodel.LoginStateDTO{}, err
+	}
+	return dto, nil
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const (
+	ImportsTable    = "imports"
+	ImportRowsTable = "import_rows"
+)
+
+type imports struct {
+	db *sql.DB
+}
+
+func (i *imports) GetImportByID(id string) (dbmodel.ImportDTO, error) {
+	stmt := "SELECT id, status, total, imported, failed, tenant_id FROM " + ImportsTable + " WHERE id=$1"
+	row := i.db.QueryRow(stmt, id)
+
+	var dto dbmodel.ImportDTO
+	err := row.Scan(&dto.Id, &dto.Status, &dto.Total, &dto.Imported, &dto.Failed, &dto.TenantId)
+	if err != nil {
+		return dbmodel.ImportDTO{}, err
+	}
+	return dto, nil
+}
+
+func (i *imports) CreateImport(dto dbmodel.ImportDTO) (string, error) {
+	stmt := "INSERT INTO " + ImportsTable + "(id, status, total, imported, failed, tenant_id) " +
+		"VALUES($1, $2, $3, $4, $5, $6) RETURNING id"
+	row := i.db.QueryRow(stmt, dto.Id, dto.Status, dto.Total, dto.Imported, dto.Failed, dto.TenantId)
+
+	var newImportID string
+	err := row.Scan(&newImportID)
+	if err != nil {
+		return "", err
+	}
+	return newImportID, nil
+}
+
+func (i *imports) UpdateImport(dto dbmodel.ImportDTO) error {
+	stmt := "UPDATE " + ImportsTable + " SET status=$1, total=$2, imported=$3, failed=$4 WHERE id=$5"
+	_, err := i.db.Exec(stmt, dto.Status, dto.Total, dto.Imported, dto.Failed, dto.Id)
+	return err
+}
+
+func (i *imports) GetImportRows(importID string) ([]dbmodel.ImportRowDTO, error) {
+	stmt := "SELECT import_id, row, book_id, status, error FROM " + ImportRowsTable +
+		" WHERE import_id=$1 ORDER BY row"
+	rows, err := i.db.Query(stmt, importID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	dtos := make([]dbmodel.ImportRowDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.ImportRowDTO
+		if err := rows.Scan(&dto.ImportId, &dto.Row, &dto.BookId, &dto.Status, &dto.Error); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
+
+func (i *imports) SaveImportRow(dto dbmodel.ImportRowDTO) error {
+	stmt := "INSERT INTO " + ImportRowsTable + "(import_id, row, book_id, status, error) " +
+		"VALUES($1, $2, $3, $4, $5) " +
+		"ON CONFLICT (import_id, row) DO UPDATE SET book_id=$3, status=$4, error=$5"
+	_, err := i.db.Exec(stmt, dto.ImportId, dto.Row, dto.BookId, dto.Status, dto.Error)
+	return err
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const LoginAttemptsTable = "login_attempts"
+
+type loginAttempts struct {
+	db *sql.DB
+}
+
+func (l *loginAttempts) GetLoginAttempt(key string) (dbmodel.LoginAttemptDTO, error) {
+	stmt := "SELECT key, failures, last_failure_at, locked_until FROM " + LoginAttemptsTable + " WHERE key=$1"
+	row := l.db.QueryRow(stmt, key)
+
+	var dto dbmodel.LoginAttemptDTO
+	err := row.Scan(&dto.Key, &dto.Failures, &dto.LastFailureAt, &dto.LockedUntil)
+	if err != nil {
+		return dbmodel.LoginAttemptDTO{}, err
+	}
+	return dto, nil
+}
+
+func (l *loginAttempts) GetLockedLoginAttempts(now time.Time) ([]dbmodel.LoginAttemptDTO, error) {
+	stmt := "SELECT key, failures, last_failure_at, locked_until FROM " + LoginAttemptsTable + " WHERE locked_until > $1 ORDER BY locked_until DESC"
+	rows, err := l.db.Query(stmt, now)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	dtos := make([]dbmodel.LoginAttemptDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.LoginAttemptDTO
+		if err := rows.Scan(&dto.Key, &dto.Failures, &dto.LastFailureAt, &dto.LockedUntil); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
+
+func (l *loginAttempts) RecordLoginFailure(key string, at time.Time, resetBefore time.Time) (dbmodel.LoginAttemptDTO, error) {
+	stmt := "INSERT INTO " + LoginAttemptsTable + " AS a (key, failures, last_failure_at, locked_until) VALUES($1, 1, $2, $3) " +
+		"ON CONFLICT (key) DO UPDATE SET failures=CASE WHEN a.last_failure_at < $4 THEN 1 ELSE a.failures + 1 END, last_failure_at=$2 " +
+		"RETURNING key, failures, last_failure_at, locked_until"
+	row := l.db.QueryRow(stmt, key, at, time.Time{}, resetBefore)
+
+	var dto dbmodel.LoginAttemptDTO
+	err := row.Scan(&dto.Key, &dto.Failures, &dto.LastFailureAt, &dto.LockedUntil)
+	if err != nil {
+		return dbmodel.LoginAttemptDTO{}, err
+	}
+	return dto, nil
+}
+
+func (l *loginAttempts) ForgiveLoginAttempt(key string) error {
+	stmt := "UPDATE " + LoginAttemptsTable + " SET failures=GREATEST(failures - 1, 0) WHERE key=$1"
+	_, err := l.db.Exec(stmt, key)
+	return err
+}
+
+func (l *loginAttempts) LockLoginAttempt(key string, until time.Time) error {
+	stmt := "UPDATE " + LoginAttemptsTable + " SET locked_until=$1 WHERE key=$2"
+	_, err := l.db.Exec(stmt, until, key)
+	return err
+}
+
+func (l *loginAttempts) DeleteLoginAttempt(key string) error {
+	stmt := "DELETE FROM " + LoginAttemptsTable + " WHERE key=$1"
+	_, err := l.db.Exec(stmt, key)
+	return err
+}
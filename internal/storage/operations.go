@@ -1,20 +1,209 @@
 package storage
 
-import "github.com/szwedm/cloud-library/internal/dbmodel"
+import (
+	"time"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
 
 type Books interface {
-	GetBooks() ([]dbmodel.BookDTO, error)
+	GetBooks(filter dbmodel.BookFilter) ([]dbmodel.BookDTO, error)
 	GetBookByID(id string) (dbmodel.BookDTO, error)
+	GetBooksByAuthorID(authorID string) ([]dbmodel.BookDTO, error)
+	GetBooksBySubjectID(subjectID string, withDescendants bool) ([]dbmodel.BookDTO, error)
+	GetBooksByTagID(tagID string) ([]dbmodel.BookDTO, error)
+	GetBooksByCollectionID(collectionID string) ([]dbmodel.BookDTO, error)
 	CreateBook(dto dbmodel.BookDTO) (string, error)
 	UpdateBook(dto dbmodel.BookDTO) error
 	DeleteBookByID(id string) error
+	GetDeletedBooks(tenantID string) ([]dbmodel.BookDTO, error)
+	GetDeletedBookByID(id string) (dbmodel.BookDTO, error)
+	GetBooksDeletedBefore(before time.Time) ([]dbmodel.BookDTO, error)
+	TrashBookByID(id string, deletedAt time.Time) error
+	RestoreBookByID(id string) error
+	GetStorageUsage(tenantID string) (int64, error)
+	GetUploaderStorageUsage(userID string) (int64, error)
+	GetStorageUsageByUploader(tenantID string) ([]dbmodel.StorageUsageDTO, error)
+}
+
+type Authors interface {
+	GetAuthors(tenantID string) ([]dbmodel.AuthorDTO, error)
+	GetAuthorByID(id string) (dbmodel.AuthorDTO, error)
+	GetAuthorByName(tenantID, name string) (dbmodel.AuthorDTO, error)
+	GetAuthorsByBookID(bookID string) ([]dbmodel.AuthorDTO, error)
+	CreateAuthor(dto dbmodel.AuthorDTO) (string, error)
+	SetBookAuthors(bookID string, authorIDs []string) error
+	MergeAuthors(tenantID, targetID string, sourceIDs []string) error
+}
+
+type Subjects interface {
+	GetSubjects(tenantID string) ([]dbmodel.SubjectDTO, error)
+	GetSubjectByID(id string) (dbmodel.SubjectDTO, error)
+	GetSubjectByName(tenantID, name string) (dbmodel.SubjectDTO, error)
+	GetSubjectByCode(tenantID, code string) (dbmodel.SubjectDTO, error)
+	GetSubjectsByBookID(bookID string) ([]dbmodel.SubjectDTO, error)
+	GetSubjectAncestorIDs(id string) ([]string, error)
+	CreateSubject(dto dbmodel.SubjectDTO) (string, error)
+	UpdateSubject(dto dbmodel.SubjectDTO) error
+	SetBookSubjects(bookID string, subjectIDs []string) error
+	MergeSubjects(tenantID, targetID string, sourceIDs []string) error
+}
+
+type Tags interface {
+	GetTags(tenantID string) ([]dbmodel.TagDTO, error)
+	GetTagByID(id string) (dbmodel.TagDTO, error)
+	GetTagByName(tenantID, name string) (dbmodel.TagDTO, error)
+	GetTagsByBookID(bookID string) ([]dbmodel.TagDTO, error)
+	CreateTag(dto dbmodel.TagDTO) (string, error)
+	SetBookTags(bookID string, tagIDs []string) error
+	MergeTags(tenantID, targetID string, sourceIDs []string) error
+}
+
+type Imports interface {
+	GetImportByID(id string) (dbmodel.ImportDTO, error)
+	CreateImport(dto dbmodel.ImportDTO) (string, error)
+	UpdateImport(dto dbmodel.ImportDTO) error
+	GetImportRows(importID string) ([]dbmodel.ImportRowDTO, error)
+	SaveImportRow(dto dbmodel.ImportRowDTO) error
 }
 
 type Users interface {
-	GetUsers() ([]dbmodel.UserDTO, error)
+	GetUsers(tenantID string) ([]dbmodel.UserDTO, error)
 	GetUserByID(id string) (dbmodel.UserDTO, error)
-	GetUserByUsername(username string) (dbmodel.UserDTO, error)
+	GetUserByUsername(tenantID, username string) (dbmodel.UserDTO, error)
+	GetUserByEmail(tenantID, email string) (dbmodel.UserDTO, error)
 	CreateUser(dto dbmodel.UserDTO) (string, error)
 	UpdateUser(dto dbmodel.UserDTO) error
 	DeleteUserByID(id string) error
+	GetDeletedUsers(tenantID string) ([]dbmodel.UserDTO, error)
+	GetDeletedUserByID(id string) (dbmodel.UserDTO, error)
+	GetUsersDeletedBefore(before time.Time) ([]dbmodel.UserDTO, error)
+	TrashUserByID(id string, deletedAt time.Time) error
+	RestoreUserByID(id string) error
+}
+
+type Sessions interface {
+	GetSessionsByUserID(userID string) ([]dbmodel.SessionDTO, error)
+	GetSessionByID(id string) (dbmodel.SessionDTO, error)
+	CreateSession(dto dbmodel.SessionDTO) (string, error)
+	UpdateSession(dto dbmodel.SessionDTO) error
+	RevokeSessionsByUserID(userID string) error
+	DeleteExpiredSessions(before time.Time) error
+	GetRefreshToken(hash string) (dbmodel.RefreshTokenDTO, error)
+	CreateRefreshToken(dto dbmodel.RefreshTokenDTO) error
+	UseRefreshToken(hash string) (bool, error)
+	RevokeToken(jti string, expiresAt time.Time) error
+	IsTokenRevoked(jti string) (bool, error)
+}
+
+type SigningKeys interface {
+	GetSigningKeys() ([]dbmodel.SigningKeyDTO, error)
+	CreateSigningKey(dto dbmodel.SigningKeyDTO) error
+	DeleteExpiredSigningKeys() error
+}
+
+type Identities interface {
+	GetIdentity(issuer, subject string) (dbmodel.IdentityDTO, error)
+	GetIdentityByID(id string) (dbmodel.IdentityDTO, error)
+	GetIdentitiesByUserID(userID string) ([]dbmodel.IdentityDTO, error)
+	CreateIdentity(dto dbmodel.IdentityDTO) (string, error)
+	DeleteIdentityByID(id string) error
+	CreateLoginState(dto dbmodel.LoginStateDTO) error
+	ConsumeLoginState(state string) (dbmodel.LoginStateDTO, error)
+}
+
+type TwoFactor interface {
+	GetTwoFactor(userID string) (dbmodel.TwoFactorDTO, error)
+	SaveTwoFactor(dto dbmodel.TwoFactorDTO) error
+	UseTwoFactorStep(userID string, step int64) (bool, error)
+	DeleteTwoFactor(userID string) error
+	SetRecoveryCodes(userID string, hashes []string) error
+	UseRecoveryCode(userID, hash string) (bool, error)
+	CountRecoveryCodes(userID string) (int, error)
+}
+
+type LoginAttempts interface {
+	GetLoginAttempt(key string) (dbmodel.LoginAttemptDTO, error)
+	GetLockedLoginAttempts(now time.Time) ([]dbmodel.LoginAttemptDTO, error)
+	RecordLoginFailure(key string, at time.Time, resetBefore time.Time) (dbmodel.LoginAttemptDTO, error)
+	ForgiveLoginAttempt(key string) error
+	LockLoginAttempt(key string, until time.Time) error
+	DeleteLoginAttempt(key string) error
+}
+
+type PasswordResets interface {
+	CreatePasswordReset(dto dbmodel.PasswordResetDTO) error
+	GetPasswordReset(hash string) (dbmodel.PasswordResetDTO, error)
+	UsePasswordReset(hash string) (dbmodel.PasswordResetDTO, error)
+	DeletePasswordResetsByUserID(userID string) error
+}
+
+type EmailVerifications interface {
+	CreateEmailVerification(dto dbmodel.EmailVerificationDTO) error
+	UseEmailVerification(hash string) (dbmodel.EmailVerificationDTO, error)
+	DeleteEmailVerificationsByUserID(userID string) error
+}
+
+type Collections interface {
+	GetCollections(tenantID string) ([]dbmodel.CollectionDTO, error)
+	GetCollectionByID(id string) (dbmodel.CollectionDTO, error)
+	GetCollectionsByBookID(bookID string) ([]dbmodel.CollectionDTO, error)
+	CreateCollection(dto dbmodel.CollectionDTO) (string, error)
+	UpdateCollection(dto dbmodel.CollectionDTO) error
+	DeleteCollectionByID(id string) error
+	AddBooksToCollection(collectionID string, bookIDs []string) error
+	RemoveBookFromCollection(collectionID, bookID string) error
+}
+
+type ACL interface {
+	IsBookRestricted(bookID string) (bool, error)
+	SetBookRestricted(bookID string, restricted bool) error
+	GetGrants(resourceType, resourceID string) ([]dbmodel.GrantDTO, error)
+	GetGrantByID(id string) (dbmodel.GrantDTO, error)
+	CreateGrant(dto dbmodel.GrantDTO) (string, error)
+	DeleteGrantByID(id string) error
+	GetHiddenBookIDs(bookIDs []string, userID string, groups []string) ([]string, error)
+}
+
+type Groups interface {
+	GetGroups(tenantID string) ([]dbmodel.GroupDTO, error)
+	GetGroupByID(id string) (dbmodel.GroupDTO, error)
+	GetGroupByName(tenantID, name string) (dbmodel.GroupDTO, error)
+	GetGroupsByUserID(userID string) ([]dbmodel.GroupDTO, error)
+	CreateGroup(dto dbmodel.GroupDTO) (string, error)
+	UpdateGroup(dto dbmodel.GroupDTO) error
+	DeleteGroupByID(id string) error
+	GetGroupMembers(groupID string) ([]dbmodel.UserDTO, error)
+	AddGroupMembers(groupID string, userIDs []string) error
+	RemoveGroupMember(groupID, userID string) error
+}
+
+type APIKeys interface {
+	GetAPIKeysByUserID(userID string) ([]dbmodel.APIKeyDTO, error)
+	GetAPIKeyByID(id string) (dbmodel.APIKeyDTO, error)
+	GetAPIKeyByHash(hash string) (dbmodel.APIKeyDTO, error)
+	CreateAPIKey(dto dbmodel.APIKeyDTO) (string, error)
+	TouchAPIKey(id string, usedAt time.Time) error
+	RevokeAPIKey(id string) error
+	RevokeAPIKeysByUserID(userID string) error
+}
+
+type Tenants interface {
+	GetTenants() ([]dbmodel.TenantDTO, error)
+	GetTenantByID(id string) (dbmodel.TenantDTO, error)
+	GetTenantBySlug(slug string) (dbmodel.TenantDTO, error)
+	CreateTenant(dto dbmodel.TenantDTO) (string, error)
+	UpdateTenant(dto dbmodel.TenantDTO) error
+	DeleteTenantByID(id string) error
+}
+
+type Audit interface {
+	GetAuditEvents(filter dbmodel.AuditFilter) ([]dbmodel.AuditEventDTO, error)
+	CreateAuditEvent(dto dbmodel.AuditEventDTO) error
+}
+
+type BookRevisions interface {
+	GetBookRevisions(bookID string) ([]dbmodel.BookRevisionDTO, error)
+	GetBookRevision(bookID string, revision int) (dbmodel.BookRevisionDTO, error)
+	CreateBookRevision(dto dbmodel.BookRevisionDTO) (int, error)
 }
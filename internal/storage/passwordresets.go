@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const PasswordResetsTable = "password_resets"
+
+type passwordResets struct {
+	db *sql.DB
+}
+
+func (p *passwordResets) CreatePasswordReset(dto dbmodel.PasswordResetDTO) error {
+	if _, err := p.db.Exec("DELETE FROM "+PasswordResetsTable+" WHERE expires_at < $1", time.Now()); err != nil {
+		return err
+	}
+
+	stmt := "INSERT INTO " + PasswordResetsTable + "(hash, user_id, used, expires_at) VALUES($1, $2, $3, $4)"
+	_, err := p.db.Exec(stmt, dto.Hash, dto.UserId, dto.Used, dto.ExpiresAt)
+	return err
+}
+
+func (p *passwordResets) GetPasswordReset(hash string) (dbmodel.PasswordResetDTO, error) {
+	stmt := "SELECT hash, user_id, used, expires_at FROM " + PasswordResetsTable + " WHERE hash=$1 AND used=false AND expires_at > $2"
+	row := p.db.QueryRow(stmt, hash, time.Now())
+
+	var dto dbmodel.PasswordResetDTO
+	err := row.Scan(&dto.Hash, &dto.UserId, &dto.Used, &dto.ExpiresAt)
+	if err != nil {
+		return dbmodel.PasswordResetDTO{}, err
+	}
+	return dto, nil
+}
+
+func (p *passwordResets) UsePasswordReset(hash string) (dbmodel.PasswordResetDTO, error) {
+	stmt := "UPDATE " + PasswordResetsTable + " SET used=true WHERE hash=$1 AND used=false AND expires_at > $2 " +
+		"RETURNING hash, user_id, used, expires_at"
+	row := p.db.QueryRow(stmt, hash, time.Now())
+
+	var dto dbmodel.PasswordResetDTO
+	err := row.Scan(&dto.Hash, &dto.UserId, &dto.Used, &dto.ExpiresAt)
+	if err != nil {
+		return dbmodel.PasswordResetDTO{}, err
+	}
+	return dto, nil
+}
+
+func (p *passwordResets) DeletePasswordResetsByUserID(userID string) error {
+	stmt := "DELETE FROM " + PasswordResetsTable + " WHERE user_id=$1"
+	_, err := p.db.Exec(stmt, userID)
+	return err
+}
@@ -43,8 +43,116 @@ func (p *postgres) NewBooksStorage() *books {
 	}
 }
 
+func (p *postgres) NewAuthorsStorage() *authors {
+	return &authors{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewSubjectsStorage() *subjects {
+	return &subjects{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewTagsStorage() *tags {
+	return &tags{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewImportsStorage() *imports {
+	return &imports{
+		db: p.db,
+	}
+}
+
 func (p *postgres) NewUsersStorage() *users {
 	return &users{
 		db: p.db,
 	}
 }
+
+func (p *postgres) NewSessionsStorage() *sessions {
+	return &sessions{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewSigningKeysStorage() *signingKeys {
+	return &signingKeys{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewIdentitiesStorage() *identities {
+	return &identities{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewTwoFactorStorage() *twoFactor {
+	return &twoFactor{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewLoginAttemptsStorage() *loginAttempts {
+	return &loginAttempts{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewPasswordResetsStorage() *passwordResets {
+	return &passwordResets{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewEmailVerificationsStorage() *emailVerifications {
+	return &emailVerifications{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewCollectionsStorage() *collections {
+	return &collections{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewACLStorage() *acl {
+	return &acl{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewGroupsStorage() *groups {
+	return &groups{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewAPIKeysStorage() *apiKeys {
+	return &apiKeys{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewTenantsStorage() *tenants {
+	return &tenants{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewAuditStorage() *audit {
+	return &audit{
+		db: p.db,
+	}
+}
+
+func (p *postgres) NewBookRevisionsStorage() *bookRevisions {
+	return &bookRevisions{
+		db: p.db,
+	}
+}
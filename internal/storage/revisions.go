@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const BookRevisionsTable = "book_revisions"
+
+const bookRevisionColumns = "id, book_id, revision, snapshot, changed_by, changed_by_name, created_at"
+
+type bookRevisions struct {
+	db *sql.DB
+}
+
+func (b *bookRevisions) GetBookRevisions(bookID string) ([]dbmodel.BookRevisionDTO, error) {
+	stmt := "SELECT " + bookRevisionColumns + " FROM " + BookRevisionsTable + " WHERE book_id=$1 ORDER BY revision"
+	rows, err := b.db.Query(stmt, bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	dtos := make([]dbmodel.BookRevisionDTO, 0)
+	for rows.Next() {
+		dto, err := scanBookRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
+
+func (b *bookRevisions) GetBookRevision(bookID string, revision int) (dbmodel.BookRevisionDTO, error) {
+	stmt := "SELECT " + bookRevisionColumns + " FROM " + BookRevisionsTable + " WHERE book_id=$1 AND revision=$2"
+	row := b.db.QueryRow(stmt, bookID, revision)
+
+	dto, err := scanBookRevision(row)
+	if err != nil {
+		return dbmodel.BookRevisionDTO{}, err
+	}
+	return dto, nil
+}
+
+func (b *bookRevisions) CreateBookRevision(dto dbmodel.BookRevisionDTO) (int, error) {
+	stmt := "INSERT INTO " + BookRevisionsTable + "(" + bookRevisionColumns + ") " +
+		"SELECT $1, $2, COALESCE(MAX(revision), 0) + 1, $3, $4, $5, $6 FROM " + BookRevisionsTable + " WHERE book_id=$2 " +
+		"RETURNING revision"
+	row := b.db.QueryRow(stmt, dto.Id, dto.BookId, string(dto.Snapshot), dto.ChangedBy, dto.ChangedByName, dto.CreatedAt)
+
+	var revision int
+	if err := row.Scan(&revision); err != nil {
+		return 0, err
+	}
+	return revision, nil
+}
+
+func scanBookRevision(row rowScanner) (dbmodel.BookRevisionDTO, error) {
+	var dto dbmodel.BookRevisionDTO
+	var snapshot []byte
+	err := row.Scan(&dto.Id, &dto.BookId, &dto.Revision, &snapshot, &dto.ChangedBy, &dto.ChangedByName, &dto.CreatedAt)
+	dto.Snapshot = snapshot
+	return dto, err
+}
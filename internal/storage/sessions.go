@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const (
+	SessionsTable      = "sessions"
+	RefreshTokensTable = "refresh_tokens"
+	RevokedTokensTable = "revoked_tokens"
+)
+
+type sessions struct {
+	db *sql.DB
+}
+
+func (s *sessions) GetSessionsByUserID(userID string) ([]dbmodel.SessionDTO, error) {
+	stmt := "SELECT id, user_id, device, created_at, last_used_at, expires_at, revoked FROM " + SessionsTable +
+		" WHERE user_id=$1 ORDER BY last_used_at DESC"
+	rows, err := s.db.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	dtos := make([]dbmodel.SessionDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.SessionDTO
+		if err := rows.Scan(&dto.Id, &dto.UserId, &dto.Device, &dto.CreatedAt, &dto.LastUsedAt, &dto.ExpiresAt, &dto.Revoked); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
+
+func (s *sessions) GetSessionByID(id string) (dbmodel.SessionDTO, error) {
+	stmt := "SELECT id, user_id, device, created_at, last_used_at, expires_at, revoked FROM " + SessionsTable + " WHERE id=$1"
+	row := s.db.QueryRow(stmt, id)
+
+	var dto dbmodel.SessionDTO
+	err := row.Scan(&dto.Id, &dto.UserId, &dto.Device, &dto.CreatedAt, &dto.LastUsedAt, &dto.ExpiresAt, &dto.Revoked)
+	if err != nil {
+		return dbmodel.SessionDTO{}, err
+	}
+	return dto, nil
+}
+
+func (s *sessions) CreateSession(dto dbmodel.SessionDTO) (string, error) {
+	stmt := "INSERT INTO " + SessionsTable + "(id, user_id, device, created_at, last_used_at, expires_at, revoked) " +
+		"VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id"
+	row := s.db.QueryRow(stmt, dto.Id, dto.UserId, dto.Device, dto.CreatedAt, dto.LastUsedAt, dto.ExpiresAt, dto.Revoked)
+
+	var newSessionID string
+	err := row.Scan(&newSessionID)
+	if err != nil {
+		return "", err
+	}
+	return newSessionID, nil
+}
+
+func (s *sessions) UpdateSession(dto dbmodel.SessionDTO) error {
+	stmt := "UPDATE " + SessionsTable + " SET device=$1, last_used_at=$2, expires_at=$3, revoked=$4 WHERE id=$5"
+	_, err := s.db.Exec(stmt, dto.Device, dto.LastUsedAt, dto.ExpiresAt, dto.Revoked, dto.Id)
+	return err
+}
+
+func (s *sessions) RevokeSessionsByUserID(userID string) error {
+	stmt := "UPDATE " + SessionsTable + " SET revoked=true WHERE user_id=$1"
+	if _, err := s.db.Exec(stmt, userID); err != nil {
+		return err
+	}
+
+	stmt = "UPDATE " + RefreshTokensTable + " SET used=true WHERE session_id IN (SELECT id FROM " + SessionsTable + " WHERE user_id=$1)"
+	_, err := s.db.Exec(stmt, userID)
+	return err
+}
+
+func (s *sessions) DeleteExpiredSessions(before time.Time) error {
+	stmt := "DELETE FROM " + RefreshTokensTable + " WHERE expires_at < $1 " +
+		"OR session_id IN (SELECT id FROM " + SessionsTable + " WHERE expires_at < $1)"
+	if _, err := s.db.Exec(stmt, before); err != nil {
+		return err
+	}
+
+	stmt = "DELETE FROM " + SessionsTable + " WHERE expires_at < $1"
+	_, err := s.db.Exec(stmt, before)
+	return err
+}
+
+func (s *sessions) GetRefreshToken(hash string) (dbmodel.RefreshTokenDTO, error) {
+	stmt := "SELECT hash, session_id, used, expires_at FROM " + RefreshTokensTable + " WHERE hash=$1"
+	row := s.db.QueryRow(stmt, hash)
+
+	var dto dbmodel.RefreshTokenDTO
+	err := row.Scan(&dto.Hash, &dto.SessionId, &dto.Used, &dto.ExpiresAt)
+	if err != nil {
+		return dbmodel.RefreshTokenDTO{}, err
+	}
+	return dto, nil
+}
+
+func (s *sessions) CreateRefreshToken(dto dbmodel.RefreshTokenDTO) error {
+	stmt := "INSERT INTO " + RefreshTokensTable + "(hash, session_id, used, expires_at) VALUES($1, $2, $3, $4)"
+	_, err := s.db.Exec(stmt, dto.Hash, dto.SessionId, dto.Used, dto.ExpiresAt)
+	return err
+}
+
+func (s *sessions) UseRefreshToken(hash string) (bool, error) {
+	stmt := "UPDATE " + RefreshTokensTable + " SET used=true WHERE hash=$1 AND used=false"
+	result, err := s.db.Exec(stmt, hash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (s *sessions) RevokeToken(jti string, expiresAt time.Time) error {
+	if _, err := s.db.Exec("DELETE FROM " + RevokedTokensTable + " WHERE expires_at < now()"); err != nil {
+		return err
+	}
+
+	stmt := "INSERT INTO " + RevokedTokensTable + "(jti, expires_at) VALUES($1, $2) ON CONFLICT DO NOTHING"
+	_, err := s.db.Exec(stmt, jti, expiresAt)
+	return err
+}
+
+func (s *sessions) IsTokenRevoked(jti string) (bool, error) {
+	stmt := "SELECT EXISTS(SELECT 1 FROM " + RevokedTokensTable + " WHERE jti=$1)"
+	row := s.db.QueryRow(stmt, jti)
+
+	var revoked bool
+	err := row.Scan(&revoked)
+	return revoked, err
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const SigningKeysTable = "signing_keys"
+
+type signingKeys struct {
+	db *sql.DB
+}
+
+func (k *signingKeys) GetSigningKeys() ([]dbmodel.SigningKeyDTO, error) {
+	stmt := "SELECT kid, algorithm, private_key, created_at, expires_at FROM " + SigningKeysTable +
+		" WHERE expires_at > now() ORDER BY created_at DESC"
+	rows, err := k.db.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	dtos := make([]dbmodel.SigningKeyDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.SigningKeyDTO
+		if err := rows.Scan(&dto.Kid, &dto.Algorithm, &dto.PrivateKey, &dto.CreatedAt, &dto.ExpiresAt); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
+
+func (k *signingKeys) CreateSigningKey(dto dbmodel.SigningKeyDTO) error {
+	stmt := "INSERT INTO " + SigningKeysTable + "(kid, algorithm, private_key, created_at, expires_at) " +
+		"VALUES($1, $2, $3, $4, $5)"
+	_, err := k.db.Exec(stmt, dto.Kid, dto.Algorithm, dto.PrivateKey, dto.CreatedAt, dto.ExpiresAt)
+	return err
+}
+
+func (k *signingKeys) DeleteExpiredSigningKeys() error {
+	stmt := "DELETE FROM " + SigningKeysTable + " WHERE expires_at <= now()"
+	_, err := k.db.Exec(stmt)
+	return err
+}
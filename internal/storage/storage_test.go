@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// testPostgres connects to the database in APP_TEST_DB, a key=value
+// connection string, and gives the test a schema of its own.
+func testPostgres(t *testing.T, schema ...string) *postgres {
+	t.Helper()
+	connStr := os.Getenv("APP_TEST_DB")
+	if connStr == "" {
+		t.Skip("APP_TEST_DB is not set")
+	}
+
+	admin, err := sql.Open("postgres", connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err = admin.Exec("CREATE SCHEMA " + name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + name + " CASCADE")
+		admin.Close()
+	})
+
+	p := NewPostgres(connStr + " search_path=" + name)
+	t.Cleanup(p.CloseConnection)
+	for _, stmt := range schema {
+		if _, err = p.db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	return p
+}
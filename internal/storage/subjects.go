@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const (
+	SubjectsTable     = "subjects"
+	BookSubjectsTable = "book_subjects"
+)
+
+const subjectColumns = "id, name, COALESCE(code, ''), COALESCE(parent_id::text, ''), tenant_id"
+
+type SubjectNotFoundErr struct{}
+
+func (e *SubjectNotFoundErr) Error() string {
+	return "subject not found"
+}
+
+type subjects struct {
+	db *sql.DB
+}
+
+func (s *subjects) GetSubjects(tenantID string) ([]dbmodel.SubjectDTO, error) {
+	stmt := "SELECT " + subjectColumns + " FROM " + SubjectsTable + " WHERE tenant_id=$1 ORDER BY code, name"
+	rows, err := s.db.Query(stmt, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanSubjects(rows)
+}
+
+func (s *subjects) GetSubjectByID(id string) (dbmodel.SubjectDTO, error) {
+	stmt := "SELECT " + subjectColumns + " FROM " + SubjectsTable + " WHERE id=$1"
+	row := s.db.QueryRow(stmt, id)
+
+	var dto dbmodel.SubjectDTO
+	err := row.Scan(&dto.Id, &dto.Name, &dto.Code, &dto.ParentId, &dto.TenantId)
+	if err != nil {
+		return dbmodel.SubjectDTO{}, err
+	}
+	return dto, nil
+}
+
+func (s *subjects) GetSubjectByName(tenantID, name string) (dbmodel.SubjectDTO, error) {
+	stmt := "SELECT " + subjectColumns + " FROM " + SubjectsTable + " WHERE tenant_id=$1 AND lower(name)=lower($2)"
+	row := s.db.QueryRow(stmt, tenantID, name)
+
+	var dto dbmodel.SubjectDTO
+	err := row.Scan(&dto.Id, &dto.Name, &dto.Code, &dto.ParentId, &dto.TenantId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dbmodel.SubjectDTO{}, &SubjectNotFoundErr{}
+		}
+		return dbmodel.SubjectDTO{}, err
+	}
+	return dto, nil
+}
+
+func (s *subjects) GetSubjectByCode(tenantID, code string) (dbmodel.SubjectDTO, error) {
+	stmt := "SELECT " + subjectColumns + " FROM " + SubjectsTable + " WHERE tenant_id=$1 AND code=$2"
+	row := s.db.QueryRow(stmt, tenantID, code)
+
+	var dto dbmodel.SubjectDTO
+	err := row.Scan(&dto.Id, &dto.Name, &dto.Code, &dto.ParentId, &dto.TenantId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dbmodel.SubjectDTO{}, &SubjectNotFoundErr{}
+		}
+		return dbmodel.SubjectDTO{}, err
+	}
+	return dto, nil
+}
+
+func (s *subjects) GetSubjectsByBookID(bookID string) ([]dbmodel.SubjectDTO, error) {
+	stmt := "SELECT " + subjectColumns + " FROM " + SubjectsTable +
+		" WHERE id IN (SELECT subject_id FROM " + BookSubjectsTable + " WHERE book_id=$1) ORDER BY name"
+	rows, err := s.db.Query(stmt, bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanSubjects(rows)
+}
+
+func (s *subjects) GetSubjectAncestorIDs(id string) ([]string, error) {
+	stmt := "WITH RECURSIVE ancestors AS (" +
+		"SELECT parent_id FROM " + SubjectsTable + " WHERE id=$1 " +
+		"UNION SELECT s.parent_id FROM " + SubjectsTable + " s JOIN ancestors a ON s.id=a.parent_id" +
+		") SELECT parent_id::text FROM ancestors WHERE parent_id IS NOT NULL"
+	rows, err := s.db.Query(stmt, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var ancestorID string
+		if err := rows.Scan(&ancestorID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, ancestorID)
+	}
+	return ids, rows.Err()
+}
+
+func (s *subjects) CreateSubject(dto dbmodel.SubjectDTO) (string, error) {
+	stmt := "INSERT INTO " + SubjectsTable + "(id, name, code, parent_id, tenant_id) " +
+		"VALUES($1, $2, NULLIF($3, ''), NULLIF($4, '')::uuid, $5) RETURNING id"
+	row := s.db.QueryRow(stmt, dto.Id, dto.Name, dto.Code, dto.ParentId, dto.TenantId)
+
+	var newSubjectID string
+	err := row.Scan(&newSubjectID)
+	if err != nil {
+		return "", err
+	}
+	return newSubjectID, nil
+}
+
+func (s *subjects) UpdateSubject(dto dbmodel.SubjectDTO) error {
+	stmt := "UPDATE " + SubjectsTable + " SET name=$1, code=NULLIF($2, ''), parent_id=NULLIF($3, '')::uuid WHERE id=$4"
+	_, err := s.db.Exec(stmt, dto.Name, dto.Code, dto.ParentId, dto.Id)
+	return err
+}
+
+func (s *subjects) SetBookSubjects(bookID string, subjectIDs []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM "+BookSubjectsTable+" WHERE book_id=$1", bookID); err != nil {
+		return err
+	}
+
+	stmt := "INSERT INTO " + BookSubjectsTable + "(book_id, subject_id) VALUES($1, $2) ON CONFLICT DO NOTHING"
+	for _, subjectID := range subjectIDs {
+		if _, err := tx.Exec(stmt, bookID, subjectID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *subjects) MergeSubjects(tenantID, targetID string, sourceIDs []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sources := "SELECT id FROM " + SubjectsTable + " WHERE id = ANY($1) AND tenant_id=$2"
+	stmt := "INSERT INTO " + BookSubjectsTable + "(book_id, subject_id) " +
+		"SELECT book_id, $3 FROM " + BookSubjectsTable + " WHERE subject_id IN (" + sources + ") ON CONFLICT DO NOTHING"
+	if _, err := tx.Exec(stmt, pq.Array(sourceIDs), tenantID, targetID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM "+BookSubjectsTable+" WHERE subject_id IN ("+sources+")", pq.Array(sourceIDs), tenantID); err != nil {
+		return err
+	}
+	stmt = "UPDATE " + SubjectsTable + " SET parent_id=$3 WHERE parent_id IN (" + sources + ")"
+	if _, err := tx.Exec(stmt, pq.Array(sourceIDs), tenantID, targetID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM "+SubjectsTable+" WHERE id = ANY($1) AND tenant_id=$2", pq.Array(sourceIDs), tenantID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func scanSubjects(rows *sql.Rows) ([]dbmodel.SubjectDTO, error) {
+	dtos := make([]dbmodel.SubjectDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.SubjectDTO
+		if err := rows.Scan(&dto.Id, &dto.Name, &dto.Code, &dto.ParentId, &dto.TenantId); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const (
+	TagsTable     = "tags"
+	BookTagsTable = "book_tags"
+)
+
+type TagNotFoundErr struct{}
+
+func (e *TagNotFoundErr) Error() string {
+	return "tag not found"
+}
+
+type tags struct {
+	db *sql.DB
+}
+
+func (t *tags) GetTags(tenantID string) ([]dbmodel.TagDTO, error) {
+	stmt := "SELECT id, name, tenant_id FROM " + TagsTable + " WHERE tenant_id=$1 ORDER BY name"
+	rows, err := t.db.Query(stmt, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanTags(rows)
+}
+
+func (t *tags) GetTagByID(id string) (dbmodel.TagDTO, error) {
+	stmt := "SELECT id, name, tenant_id FROM " + TagsTable + " WHERE id=$1"
+	row := t.db.QueryRow(stmt, id)
+
+	var dto dbmodel.TagDTO
+	err := row.Scan(&dto.Id, &dto.Name, &dto.TenantId)
+	if err != nil {
+		return dbmodel.TagDTO{}, err
+	}
+	return dto, nil
+}
+
+func (t *tags) GetTagByName(tenantID, name string) (dbmodel.TagDTO, error) {
+	stmt := "SELECT id, name, tenant_id FROM " + TagsTable + " WHERE tenant_id=$1 AND lower(name)=lower($2)"
+	row := t.db.QueryRow(stmt, tenantID, name)
+
+	var dto dbmodel.TagDTO
+	err := row.Scan(&dto.Id, &dto.Name, &dto.TenantId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dbmodel.TagDTO{}, &TagNotFoundErr{}
+		}
+		return dbmodel.TagDTO{}, err
+	}
+	return dto, nil
+}
+
+func (t *tags) GetTagsByBookID(bookID string) ([]dbmodel.TagDTO, error) {
+	stmt := "SELECT t.id, t.name, t.tenant_id FROM " + TagsTable + " t " +
+		"JOIN " + BookTagsTable + " bt ON bt.tag_id=t.id WHERE bt.book_id=$1 ORDER BY t.name"
+	rows, err := t.db.Query(stmt, bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanTags(rows)
+}
+
+func (t *tags) CreateTag(dto dbmodel.TagDTO) (string, error) {
+	stmt := "INSERT INTO " + TagsTable + "(id, name, tenant_id) " +
+		"VALUES($1, $2, $3) RETURNING id"
+	row := t.db.QueryRow(stmt, dto.Id, dto.Name, dto.TenantId)
+
+	var newTagID string
+	err := row.Scan(&newTagID)
+	if err != nil {
+		return "", err
+	}
+	return newTagID, nil
+}
+
+func (t *tags) SetBookTags(bookID string, tagIDs []string) error {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM "+BookTagsTable+" WHERE book_id=$1", bookID); err != nil {
+		return err
+	}
+
+	stmt := "INSERT INTO " + BookTagsTable + "(book_id, tag_id) VALUES($1, $2) ON CONFLICT DO NOTHING"
+	for _, tagID := range tagIDs {
+		if _, err := tx.Exec(stmt, bookID, tagID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (t *tags) MergeTags(tenantID, targetID string, sourceIDs []string) error {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sources := "SELECT id FROM " + TagsTable + " WHERE id = ANY($1) AND tenant_id=$2"
+	stmt := "INSERT INTO " + BookTagsTable + "(book_id, tag_id) " +
+		"SELECT book_id, $3 FROM " + BookTagsTable + " WHERE tag_id IN (" + sources + ") ON CONFLICT DO NOTHING"
+	if _, err := tx.Exec(stmt, pq.Array(sourceIDs), tenantID, targetID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM "+BookTagsTable+" WHERE tag_id IN ("+sources+")", pq.Array(sourceIDs), tenantID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM "+TagsTable+" WHERE id = ANY($1) AND tenant_id=$2", pq.Array(sourceIDs), tenantID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func scanTags(rows *sql.Rows) ([]dbmodel.TagDTO, error) {
+	dtos := make([]dbmodel.TagDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.TagDTO
+		if err := rows.Scan(&dto.Id, &dto.Name, &dto.TenantId); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
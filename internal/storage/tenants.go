@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const TenantsTable = "tenants"
+
+type TenantNotFoundErr struct{}
+
+func (e *TenantNotFoundErr) Error() string {
+	return "tenant not found"
+}
+
+type tenants struct {
+	db *sql.DB
+}
+
+func (t *tenants) GetTenants() ([]dbmodel.TenantDTO, error) {
+	stmt := "SELECT id, slug, name, status, quota_bytes, created_at FROM " + TenantsTable + " ORDER BY slug"
+	rows, err := t.db.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	dtos := make([]dbmodel.TenantDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.TenantDTO
+		if err := rows.Scan(&dto.Id, &dto.Slug, &dto.Name, &dto.Status, &dto.QuotaBytes, &dto.CreatedAt); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}
+
+func (t *tenants) GetTenantByID(id string) (dbmodel.TenantDTO, error) {
+	stmt := "SELECT id, slug, name, status, quota_bytes, created_at FROM " + TenantsTable + " WHERE id=$1"
+	row := t.db.QueryRow(stmt, id)
+
+	var dto dbmodel.TenantDTO
+	err := row.Scan(&dto.Id, &dto.Slug, &dto.Name, &dto.Status, &dto.QuotaBytes, &dto.CreatedAt)
+	if err != nil {
+		return dbmodel.TenantDTO{}, err
+	}
+	return dto, nil
+}
+
+func (t *tenants) GetTenantBySlug(slug string) (dbmodel.TenantDTO, error) {
+	stmt := "SELECT id, slug, name, status, quota_bytes, created_at FROM " + TenantsTable + " WHERE slug=lower($1)"
+	row := t.db.QueryRow(stmt, slug)
+
+	var dto dbmodel.TenantDTO
+	err := row.Scan(&dto.Id, &dto.Slug, &dto.Name, &dto.Status, &dto.QuotaBytes, &dto.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dbmodel.TenantDTO{}, &TenantNotFoundErr{}
+		}
+		return dbmodel.TenantDTO{}, err
+	}
+	return dto, nil
+}
+
+func (t *tenants) CreateTenant(dto dbmodel.TenantDTO) (string, error) {
+	stmt := "INSERT INTO " + TenantsTable + "(id, slug, name, status, quota_bytes, created_at) " +
+		"VALUES($1, $2, $3, $4, $5, $6) RETURNING id"
+	row := t.db.QueryRow(stmt, dto.Id, dto.Slug, dto.Name, dto.Status, dto.QuotaBytes, dto.CreatedAt)
+
+	var newTenantID string
+	err := row.Scan(&newTenantID)
+	if err != nil {
+		return "", err
+	}
+	return newTenantID, nil
+}
+
+func (t *tenants) UpdateTenant(dto dbmodel.TenantDTO) error {
+	stmt := "UPDATE " + TenantsTable + " SET slug=$1, name=$2, status=$3, quota_bytes=$4 WHERE id=$5"
+	_, err := t.db.Exec(stmt, dto.Slug, dto.Name, dto.Status, dto.QuotaBytes, dto.Id)
+	return err
+}
+
+func (t *tenants) DeleteTenantByID(id string) error {
+	stmt := "DELETE FROM " + TenantsTable + " WHERE id=$1"
+	_, err := t.db.Exec(stmt, id)
+	return err
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/szwedm/cloud-library/internal/dbmodel"
+)
+
+const (
+	TwoFactorTable     = "two_factor"
+	RecoveryCodesTable = "recovery_codes"
+)
+
+type twoFactor struct {
+	db *sql.DB
+}
+
+func (t *twoFactor) GetTwoFactor(userID string) (dbmodel.TwoFactorDTO, error) {
+	stmt := "SELECT user_id, secret, enabled, last_step, created_at FROM " + TwoFactorTable + " WHERE user_id=$1"
+	row := t.db.QueryRow(stmt, userID)
+
+	var dto dbmodel.TwoFactorDTO
+	err := row.Scan(&dto.UserId, &dto.Secret, &dto.Enabled, &dto.LastStep, &dto.CreatedAt)
+	if err != nil {
+		return dbmodel.TwoFactorDTO{}, err
+	}
+	return dto, nil
+}
+
+func (t *twoFactor) SaveTwoFactor(dto dbmodel.TwoFactorDTO) error {
+	stmt := "INSERT INTO " + TwoFactorTable + "(user_id, secret, enabled, last_step, created_at) VALUES($1, $2, $3, $4, $5) " +
+		"ON CONFLICT (user_id) DO UPDATE SET secret=EXCLUDED.secret, enabled=EXCLUDED.enabled, last_step=EXCLUDED.last_step, created_at=EXCLUDED.created_at"
+	_, err := t.db.Exec(stmt, dto.UserId, dto.Secret, dto.Enabled, dto.LastStep, dto.CreatedAt)
+	return err
+}
+
+func (t *twoFactor) UseTwoFactorStep(userID string, step int64) (bool, error) {
+	stmt := "UPDATE " + TwoFactorTable + " SET last_step=$1 WHERE user_id=$2 AND last_step < $1"
+	result, err := t.db.Exec(stmt, step, userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (t *twoFactor) DeleteTwoFactor(userID string) error {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM "+RecoveryCodesTable+" WHERE user_id=$1", userID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM "+TwoFactorTable+" WHERE user_id=$1", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (t *twoFactor) SetRecoveryCodes(userID string, hashes []string) error {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM "+RecoveryCodesTable+" WHERE user_id=$1", userID); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		stmt := "INSERT INTO " + RecoveryCodesTable + "(user_id, hash, used) VALUES($1, $2, false)"
+		if _, err = tx.Exec(stmt, userID, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (t *twoFactor) UseRecoveryCode(userID, hash string) (bool, error) {
+	stmt := "UPDATE " + RecoveryCodesTable + " SET used=true WHERE user_id=$1 AND hash=$2 AND used=false"
+	result, err := t.db.Exec(stmt, userID, hash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (t *twoFactor) CountRecoveryCodes(userID string) (int, error) {
+	stmt := "SELECT COUNT(*) FROM " + RecoveryCodesTable + " WHERE user_id=$1 AND used=false"
+	row := t.db.QueryRow(stmt, userID)
+
+	var count int
+	err := row.Scan(&count)
+	return count, err
+}
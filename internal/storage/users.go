@@ -3,12 +3,15 @@ package storage
 import (
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/szwedm/cloud-library/internal/dbmodel"
 )
 
 const UsersTable = "users"
 
+const userColumns = "id, username, password, role, token_version, email, status, tenant_id"
+
 type UserNotFoundErr struct{}
 
 func (e *UserNotFoundErr) Error() string {
@@ -19,9 +22,9 @@ type users struct {
 	db *sql.DB
 }
 
-func (u *users) GetUsers() ([]dbmodel.UserDTO, error) {
-	stmt := "SELECT * FROM " + UsersTable
-	rows, err := u.db.Query(stmt)
+func (u *users) GetUsers(tenantID string) ([]dbmodel.UserDTO, error) {
+	stmt := "SELECT " + userColumns + " FROM " + UsersTable + " WHERE tenant_id=$1 AND deleted_at IS NULL"
+	rows, err := u.db.Query(stmt, tenantID)
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +34,7 @@ func (u *users) GetUsers() ([]dbmodel.UserDTO, error) {
 	dtos := make([]dbmodel.UserDTO, 0)
 	for rows.Next() {
 		var dto dbmodel.UserDTO
-		if err := rows.Scan(&dto.Id, &dto.Username, &dto.Password, &dto.Role); err != nil {
+		if err := rows.Scan(&dto.Id, &dto.Username, &dto.Password, &dto.Role, &dto.TokenVersion, &dto.Email, &dto.Status, &dto.TenantId); err != nil {
 			return nil, err
 		}
 		dtos = append(dtos, dto)
@@ -40,23 +43,38 @@ func (u *users) GetUsers() ([]dbmodel.UserDTO, error) {
 }
 
 func (u *users) GetUserByID(id string) (dbmodel.UserDTO, error) {
-	stmt := "SELECT * FROM " + UsersTable + " WHERE id=$1"
+	stmt := "SELECT " + userColumns + " FROM " + UsersTable + " WHERE id=$1 AND deleted_at IS NULL"
 	row := u.db.QueryRow(stmt, id)
 
 	var dto dbmodel.UserDTO
-	err := row.Scan(&dto.Id, &dto.Username, &dto.Password, &dto.Role)
+	err := row.Scan(&dto.Id, &dto.Username, &dto.Password, &dto.Role, &dto.TokenVersion, &dto.Email, &dto.Status, &dto.TenantId)
 	if err != nil {
 		return dbmodel.UserDTO{}, err
 	}
 	return dto, nil
 }
 
-func (u *users) GetUserByUsername(username string) (dbmodel.UserDTO, error) {
-	stmt := "SELECT * FROM " + UsersTable + " WHERE username=$1"
-	row := u.db.QueryRow(stmt, username)
+func (u *users) GetUserByUsername(tenantID, username string) (dbmodel.UserDTO, error) {
+	stmt := "SELECT " + userColumns + " FROM " + UsersTable + " WHERE tenant_id=$1 AND username=$2 AND deleted_at IS NULL"
+	row := u.db.QueryRow(stmt, tenantID, username)
 
 	var dto dbmodel.UserDTO
-	err := row.Scan(&dto.Id, &dto.Username, &dto.Password, &dto.Role)
+	err := row.Scan(&dto.Id, &dto.Username, &dto.Password, &dto.Role, &dto.TokenVersion, &dto.Email, &dto.Status, &dto.TenantId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dbmodel.UserDTO{}, &UserNotFoundErr{}
+		}
+		return dbmodel.UserDTO{}, err
+	}
+	return dto, nil
+}
+
+func (u *users) GetUserByEmail(tenantID, email string) (dbmodel.UserDTO, error) {
+	stmt := "SELECT " + userColumns + " FROM " + UsersTable + " WHERE tenant_id=$1 AND email <> '' AND lower(email)=lower($2) AND deleted_at IS NULL"
+	row := u.db.QueryRow(stmt, tenantID, email)
+
+	var dto dbmodel.UserDTO
+	err := row.Scan(&dto.Id, &dto.Username, &dto.Password, &dto.Role, &dto.TokenVersion, &dto.Email, &dto.Status, &dto.TenantId)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return dbmodel.UserDTO{}, &UserNotFoundErr{}
@@ -67,9 +85,9 @@ func (u *users) GetUserByUsername(username string) (dbmodel.UserDTO, error) {
 }
 
 func (u *users) CreateUser(dto dbmodel.UserDTO) (string, error) {
-	stmt := "INSERT INTO " + UsersTable + "(id, username, password, role) " +
-		"VALUES($1, $2, $3, $4) RETURNING id"
-	row := u.db.QueryRow(stmt, dto.Id, dto.Username, dto.Password, dto.Role)
+	stmt := "INSERT INTO " + UsersTable + "(" + userColumns + ") " +
+		"VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
+	row := u.db.QueryRow(stmt, dto.Id, dto.Username, dto.Password, dto.Role, dto.TokenVersion, dto.Email, dto.Status, dto.TenantId)
 
 	var newUserID string
 	err := row.Scan(&newUserID)
@@ -80,13 +98,88 @@ func (u *users) CreateUser(dto dbmodel.UserDTO) (string, error) {
 }
 
 func (u *users) UpdateUser(dto dbmodel.UserDTO) error {
-	stmt := "UPDATE " + UsersTable + " SET username=$1, password=$2, role=$3 WHERE id=$4"
-	_, err := u.db.Exec(stmt, dto.Username, dto.Password, dto.Role, dto.Id)
+	stmt := "UPDATE " + UsersTable + " SET username=$1, password=$2, role=$3, token_version=$4, email=$5, status=$6 WHERE id=$7"
+	_, err := u.db.Exec(stmt, dto.Username, dto.Password, dto.Role, dto.TokenVersion, dto.Email, dto.Status, dto.Id)
 	return err
 }
 
-func (u *users) DeleteUserByID(id string) error {
-	stmt := "DELETE FROM " + UsersTable + " WHERE id=$1"
+func (u *users) GetDeletedUsers(tenantID string) ([]dbmodel.UserDTO, error) {
+	stmt := "SELECT " + userColumns + ", deleted_at FROM " + UsersTable +
+		" WHERE tenant_id=$1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC"
+	rows, err := u.db.Query(stmt, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanDeletedUsers(rows)
+}
+
+func (u *users) GetDeletedUserByID(id string) (dbmodel.UserDTO, error) {
+	stmt := "SELECT " + userColumns + ", deleted_at FROM " + UsersTable + " WHERE id=$1 AND deleted_at IS NOT NULL"
+	row := u.db.QueryRow(stmt, id)
+
+	var dto dbmodel.UserDTO
+	err := row.Scan(&dto.Id, &dto.Username, &dto.Password, &dto.Role, &dto.TokenVersion, &dto.Email, &dto.Status, &dto.TenantId, &dto.DeletedAt)
+	if err != nil {
+		return dbmodel.UserDTO{}, err
+	}
+	return dto, nil
+}
+
+func (u *users) GetUsersDeletedBefore(before time.Time) ([]dbmodel.UserDTO, error) {
+	stmt := "SELECT " + userColumns + ", deleted_at FROM " + UsersTable + " WHERE deleted_at < $1"
+	rows, err := u.db.Query(stmt, before)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanDeletedUsers(rows)
+}
+
+func (u *users) TrashUserByID(id string, deletedAt time.Time) error {
+	stmt := "UPDATE " + UsersTable + " SET deleted_at=$2 WHERE id=$1"
+	_, err := u.db.Exec(stmt, id, deletedAt)
+	return err
+}
+
+func (u *users) RestoreUserByID(id string) error {
+	stmt := "UPDATE " + UsersTable + " SET deleted_at=NULL WHERE id=$1"
 	_, err := u.db.Exec(stmt, id)
 	return err
 }
+
+func (u *users) DeleteUserByID(id string) error {
+	tx, err := u.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM "+GroupMembersTable+" WHERE user_id=$1", id); err != nil {
+		return err
+	}
+	stmt := "DELETE FROM " + GrantsTable + " WHERE principal_type=$1 AND principal_id=$2"
+	if _, err = tx.Exec(stmt, dbmodel.GrantPrincipalUser, id); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM "+UsersTable+" WHERE id=$1", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func scanDeletedUsers(rows *sql.Rows) ([]dbmodel.UserDTO, error) {
+	dtos := make([]dbmodel.UserDTO, 0)
+	for rows.Next() {
+		var dto dbmodel.UserDTO
+		if err := rows.Scan(&dto.Id, &dto.Username, &dto.Password, &dto.Role, &dto.TokenVersion, &dto.Email, &dto.Status, &dto.TenantId, &dto.DeletedAt); err != nil {
+			return nil, err
+		}
+		dtos = append(dtos, dto)
+	}
+	return dtos, rows.Err()
+}